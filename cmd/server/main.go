@@ -3,85 +3,331 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
 	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/backfill"
+	"Dexcelerate_swap_stats/internal/bloom"
+	"Dexcelerate_swap_stats/internal/cluster"
 	"Dexcelerate_swap_stats/internal/config"
+	"Dexcelerate_swap_stats/internal/deadletter"
+	"Dexcelerate_swap_stats/internal/dedupe"
 	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/grpcApi"
 	"Dexcelerate_swap_stats/internal/httpApi"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/leader"
 	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/reconcile"
+	"Dexcelerate_swap_stats/internal/replica"
 	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+	"Dexcelerate_swap_stats/internal/validation"
 	"Dexcelerate_swap_stats/internal/webSocket"
 
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
 )
 
 // supported tokens
 var tokens = []string{"ETH", "BTC", "SOL"}
 
 func main() {
+	restorePath := flag.String("restore", "", "restore engine state from a snapshot file instead of loading every series from redis")
+	flag.Parse()
+
 	log.Println("[boot] Starting server")
 	cfg := config.GetConfig()
+	var isReader bool
+	switch cfg.Role {
+	case "writer":
+	case "reader":
+		isReader = true
+	default:
+		log.Fatal("[fatal err] Unknown role:", cfg.Role)
+	}
 
 	// start redis
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.RedisURL,
 		Password: cfg.RedisPassword,
 		DB:       cfg.RedisDB,
+		// REDIS_*_TIMEOUT bound calls through their contexts
+		ContextTimeoutEnabled: true,
 	})
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
 		log.Fatal("[fatal err] Can't start redis:", err)
 	}
+	migrator := redisStorage.NewMigrator(rdb, "token_set")
+	if flag.Arg(0) == "migrate" {
+		runMigrate(migrator, flag.Args()[1:])
+		return
+	}
+	if err := migrator.EnsureSchema(context.Background(), !isReader); err != nil {
+		log.Fatal("[fatal err] Unsupported redis schema:", err)
+	}
 
 	// initialize all parts
-	wsHub := webSocket.NewHub()
-	store := redisStorage.NewStore(rdb, "token_set", cfg.DedupeTTL)
-	eng := engine.NewEngine(store, wsHub)
+	policy, err := webSocket.ParseOverflowPolicy(cfg.WSOverflowPolicy)
+	if err != nil {
+		log.Fatal("[fatal err] Bad WebSocket config:", err)
+	}
+	// with fanout seq is numbered in Redis, so every instance names it with the same epoch
+	epoch := webSocket.NewEpoch()
+	if cfg.WSFanout && !isReader {
+		if epoch, err = webSocket.SharedEpoch(context.Background(), rdb, "stats:"); err != nil {
+			log.Fatal("[fatal err] Can't read WebSocket epoch:", err)
+		}
+	}
+	wsHub := webSocket.NewHub(
+		webSocket.WithEpoch(epoch),
+		webSocket.WithQueueSize(cfg.WSQueueSize),
+		webSocket.WithOverflowPolicy(policy),
+		webSocket.WithWriteTimeout(cfg.WSWriteTimeout),
+		webSocket.WithKeepalive(cfg.WSPingInterval, cfg.WSPongTimeout),
+		webSocket.WithReplaySize(cfg.WSReplaySize),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	var bg sync.WaitGroup // background jobs which clean up when ctx is cancelled
+
+	// with fanout every instance relays updates of all instances to its clients,
+	// readers push updates they replay themselves
+	var broadcaster engine.Broadcaster = wsHub
+	if cfg.WSFanout && !isReader {
+		fanout := webSocket.NewFanout(rdb, wsHub, "stats:", webSocket.WithPublishTimeout(cfg.RedisWriteTimeout))
+		background(&bg, "WebSocket fanout", func() error { return fanout.Run(ctx) })
+		broadcaster = fanout
+		log.Println("[boot] WebSocket fanout via Redis enabled")
+	}
+
+	dedupeKey, err := dedupe.New(cfg.DedupeKey)
+	if err != nil {
+		log.Fatal("[fatal err] Bad dedupe config:", err)
+	}
+	filterCfg := bloom.Config{
+		Window:     cfg.DedupeTTL,
+		Partitions: cfg.DedupeFilterPartitions,
+		Capacity:   uint64(cfg.DedupeFilterCapacity),
+		FPRate:     cfg.DedupeFilterFPRate,
+	}
+	var filter bloom.Filter
+	if cfg.DedupeFilter != "off" {
+		if err := filterCfg.Validate(); err != nil {
+			log.Fatal("[fatal err] Bad dedupe filter config:", err)
+		}
+	}
+	switch cfg.DedupeFilter {
+	case "off":
+	case "memory":
+		// tokens taken over in a rebalance were applied by another instance, which this filter never saw
+		if cfg.ClusterEnabled {
+			log.Fatal("[fatal err] DEDUPE_FILTER=memory can't be used with CLUSTER_ENABLED, use redis")
+		}
+		filter = bloom.NewMemory(filterCfg)
+	case "redis":
+		redisFilter := bloom.NewRedis(rdb, "bloom:", filterCfg)
+		if err := redisFilter.Start(ctx); err != nil {
+			log.Fatal("[fatal err] Can't start dedupe filter:", err)
+		}
+		filter = redisFilter
+	default:
+		log.Fatal("[fatal err] Unknown dedupe filter:", cfg.DedupeFilter)
+	}
+	store := redisStorage.NewStore(rdb, "token_set", cfg.DedupeTTL,
+		redisStorage.WithConfirmations(cfg.ReorgConfirmations),
+		redisStorage.WithDedupeKey(dedupeKey),
+		redisStorage.WithDedupeFilter(filter),
+		redisStorage.WithUpdateStream(cfg.ReplicaStream, int64(cfg.ReplicaStreamMaxLen)),
+		redisStorage.WithTimeouts(cfg.RedisReadTimeout, cfg.RedisWriteTimeout, cfg.RedisLoadTimeout),
+	)
+	expvar.Publish("dedupe_filter", expvar.Func(func() any { return store.DedupeFilterStats() }))
+	validator := validation.New(validation.Rules{
+		MaxUSD:        cfg.ValidateMaxUSD,
+		RateTolerance: cfg.ValidateRateTolerance,
+		AllowedTokens: cfg.ValidateTokens,
+		DedupeKey:     dedupeKey,
+	})
+	var dlStore deadletter.Store
+	switch cfg.DeadLetterBackend {
+	case "redis":
+		dlStore = deadletter.NewRedisStore(rdb, cfg.DeadLetterStream, int64(cfg.DeadLetterMaxLen))
+	case "file":
+		fileStore, err := deadletter.OpenFileStore(cfg.DeadLetterFile)
+		if err != nil {
+			log.Fatal("[fatal err] Can't open dead-letter file:", err)
+		}
+		defer fileStore.Close()
+		dlStore = fileStore
+	default:
+		log.Fatal("[fatal err] Unknown dead-letter backend:", cfg.DeadLetterBackend)
+	}
+	deadLetters := deadletter.NewQueue(dlStore, 2*time.Second)
+	engineOpts := []engine.Option{
+		engine.WithFlushInterval(cfg.WSFlushInterval),
+		engine.WithValidator(validator),
+		engine.WithDeadLetter(deadLetters),
+		engine.WithConfirmations(cfg.ReorgConfirmations),
+	}
+	// any writer of a cluster may get a retraction or confirmation,
+	// owners of the block tokens replay it from the relay
+	var blockRelay *cluster.BlockRelay
+	if cfg.ClusterEnabled && !isReader {
+		blockRelay = cluster.NewBlockRelay(rdb, "cluster:blocks", cfg.InstanceID)
+		engineOpts = append(engineOpts, engine.WithBlockFanout(blockRelay))
+	}
+	eng := engine.NewEngine(store, broadcaster, engineOpts...)
 
-	//try to load data from redis
-	if err := eng.Load(); err != nil {
-		log.Println("[boot] Error loading data from redis:", err)
+	// a reader builds its state from redis and follows writers,
+	// a writer loads the state once and applies events itself
+	var reader *replica.Reader
+	if isReader {
+		reader = replica.NewReader(store, eng, replica.WithMaxLag(cfg.ReplicaMaxLag))
+		background(&bg, "Replica", func() error { return reader.Run(ctx) })
+		log.Println("[boot] Running as reader replica")
 	} else {
-		log.Println("[boot] Data loaded from redis")
+		// a snapshot is caught up with the update stream, a stale or broken one falls back to a full load
+		restored := false
+		if *restorePath != "" {
+			info, err := eng.RestoreFile(ctx, *restorePath, replica.NewLog(store))
+			if err != nil {
+				log.Println("[boot] Can't restore snapshot, loading from redis:", err)
+			} else {
+				restored = true
+				log.Printf("[boot] Restored %d token series from snapshot of %s, caught up to update %s",
+					info.Tokens, info.CreatedAt.Format(time.RFC3339), info.CaughtUpTo)
+			}
+		}
+		//try to load data from redis
+		if !restored {
+			if err := eng.Load(ctx); err != nil {
+				log.Println("[boot] Error loading data from redis:", err)
+			} else {
+				log.Println("[boot] Data loaded from redis")
+			}
+		}
+	}
+
+	// with cluster every instance processes only tokens it owns,
+	// tokens are warmed from redis when they move here
+	var node *cluster.Node
+	if cfg.ClusterEnabled && !isReader {
+		node = cluster.NewNode(rdb, "cluster:", cluster.Member{ID: cfg.InstanceID, Addr: cfg.AdvertiseAddr},
+			cluster.WithLease(cfg.ClusterHeartbeat, cfg.ClusterLease),
+			cluster.WithVirtualNodes(cfg.ClusterVirtualNodes),
+			cluster.WithRebalancer(eng, store.Tokens),
+		)
+		if err := node.Join(ctx); err != nil {
+			log.Fatal("[fatal err] Can't join cluster:", err)
+		}
+		background(&bg, "Cluster membership", func() error { return node.Run(ctx) })
+		background(&bg, "Cluster block relay", func() error { return blockRelay.Run(ctx, eng) })
+		expvar.Publish("cluster", expvar.Func(func() any { return node.Members() }))
+		log.Println("[boot] Joined cluster as", cfg.InstanceID)
+	}
+
+	// singleton jobs run on the leader among writers
+	var elector *leader.Elector
+	if !isReader {
+		elector = leader.NewElector(rdb, "leader:", cfg.InstanceID, leader.WithTTL(cfg.LeaderTTL))
+		elector.Register("compact", leader.Every(cfg.CompactInterval, func(ctx context.Context, fence uint64) error {
+			// an hour of margin for late events and clock skew
+			cutoff := time.Now().UTC().Unix()/60 - 25*60
+			removed, err := store.Compact(ctx, cutoff, fence)
+			if err != nil {
+				return err
+			}
+			log.Printf("[leader] Compacted %d old bucket fields", removed)
+			return nil
+		}))
+		background(&bg, "Leader election", func() error { return elector.Run(ctx) })
 	}
 
-	// start periodic updates for WebSocket clients
+	// writers compare memory with redis, a cluster member only has owned tokens in memory
+	if cfg.ReconcileInterval > 0 && !isReader {
+		opts := []reconcile.Option{reconcile.WithInterval(cfg.ReconcileInterval), reconcile.WithHeal(cfg.ReconcileHeal)}
+		if node == nil {
+			opts = append(opts, reconcile.WithTokens(store.Tokens))
+		}
+		reconciler := reconcile.New(eng, opts...)
+		background(&bg, "Reconciler", func() error { return reconciler.Run(ctx) })
+		expvar.Publish("reconcile", expvar.Func(func() any { return reconciler.Stats() }))
+	}
+
+	// start periodic updates for WebSocket clients, not a leader job:
+	// every writer pushes the tokens it has in memory, which the leader doesn't have
 	log.Println("[boot] Starting periodic WebSocket updates")
-	eng.StartPeriodicUpdates()
+	eng.StartPeriodicUpdates(ctx)
 
-	// consumer loop to simulate reading from kafka
-	events := make(chan model.SwapEvent, 8192) // buffer size 2^13
-	log.Println("[boot] Starting demo producer")
-	ctx, cancel := context.WithCancel(context.Background())
-	go DemoProducer(ctx, events)
+	// readers never consume events, intake is stopped first on shutdown
+	// and the consumer applies everything already buffered
+	intakeCtx, stopIntake := context.WithCancel(ctx)
+	drained := make(chan struct{})
+	if isReader {
+		close(drained)
+	} else {
+		// consumer loop to simulate reading from kafka
+		events := make(chan model.SwapEvent, 8192) // buffer size 2^13
+		log.Println("[boot] Starting demo producer")
+		go DemoProducer(intakeCtx, events)
 
-	//main loop
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case ev := <-events:
-				applied, err := eng.Apply(ev)
+		//main loop, ends when the producer closes the channel
+		go func() {
+			defer close(drained)
+			for ev := range events {
+				// a partitioned source only delivers owned tokens, the demo one delivers all
+				if node != nil && !node.Owns(ev.TokenID) {
+					continue
+				}
+				applied, err := eng.Apply(ctx, ev)
 				if err != nil {
+					// the event is kept in the dead-letter queue by the engine
 					log.Println("[error] Failed to apply event:", err)
 				} else if !applied {
 					log.Println("[info] Event is duplicate, not applied:", ev.EventID)
 				}
 			}
-		}
-	}()
+		}()
+	}
 
 	// start webSocket reaper
 	go wsHub.ReapDead()
 
+	// producers may also push events directly through HTTP and gRPC
+	var ingestOpts []ingest.Option
+	serverOpts := []httpApi.Option{httpApi.WithDeadLetters(deadLetters)}
+	var snapshots *engine.SnapshotFile
+	if cfg.SnapshotPath != "" && !isReader {
+		snapshots = engine.NewSnapshotFile(eng, cfg.SnapshotPath, replica.NewLog(store))
+		serverOpts = append(serverOpts, httpApi.WithSnapshots(snapshots))
+	}
+	if cfg.BackfillFile != "" && !isReader {
+		backfiller := backfill.New(backfill.NewFileSource(cfg.BackfillFile), eng,
+			backfill.WithValidator(validator), backfill.WithDedupeKey(dedupeKey))
+		serverOpts = append(serverOpts, httpApi.WithBackfill(backfiller))
+	}
+	if node != nil {
+		ingestOpts = append(ingestOpts, ingest.WithRouter(node))
+		serverOpts = append(serverOpts, httpApi.WithCluster(node))
+	}
+	var ingestor *ingest.Ingestor
+	if isReader {
+		serverOpts = append(serverOpts, httpApi.WithReadOnly(), httpApi.WithReadiness("replica", reader.Check))
+	} else {
+		serverOpts = append(serverOpts, httpApi.WithReadiness("leader", elector.Check))
+		ingestor = ingest.New(eng, cfg.IngestMaxInFlight, cfg.IngestWaitTimeout, ingestOpts...)
+	}
+
 	//start http server
-	server := httpApi.NewServer(eng, wsHub)
+	server := httpApi.NewServer(eng, wsHub, ingestor, serverOpts...)
 	srv := &http.Server{
 		Addr:         cfg.HttpAddr,
 		Handler:      server,
@@ -95,40 +341,174 @@ func main() {
 		}
 	}()
 
+	//start grpc server
+	var grpcOpts []grpcApi.Option
+	if node != nil {
+		grpcOpts = append(grpcOpts, grpcApi.WithCluster(node))
+	}
+	grpcSrv := grpcApi.NewServer(eng, wsHub, ingestor, grpcOpts...)
+	lis, err := net.Listen("tcp", cfg.GrpcAddr)
+	if err != nil {
+		log.Fatal("[fatal err] Can't listen for gRPC:", err)
+	}
+	go func() {
+		log.Println("[boot] Starting grpc server on", cfg.GrpcAddr)
+		if err := grpcSrv.Serve(lis); err != nil {
+			log.Fatal("[fatal err] gRPC server failed:", err)
+		}
+	}()
+
 	//graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 	log.Println("[shutdown] Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// no new events, no new clients. Running requests finish in the background,
+	// SSE and gRPC streams end once the hub closes them below
+	stopIntake()
+	httpStopped := make(chan error, 1)
+	go func() { httpStopped <- srv.Shutdown(shutdownCtx) }()
+	grpcStopped := make(chan struct{})
+	go func() {
+		stopGRPC(shutdownCtx, grpcSrv)
+		close(grpcStopped)
+	}()
+
+	// apply what is buffered, push the last state to clients, then persist
+	select {
+	case <-drained:
+		log.Println("[shutdown] Event channel drained")
+	case <-shutdownCtx.Done():
+		log.Println("[shutdown] Event channel not drained in time")
+	}
+	eng.StopPeriodicUpdates(shutdownCtx)
+	if !isReader {
+		if err := eng.Checkpoint(shutdownCtx); err != nil {
+			log.Println("[shutdown] Failed to save checkpoint:", err)
+		} else {
+			log.Println("[shutdown] Checkpoint saved")
+		}
+	}
+	if snapshots != nil {
+		if info, err := snapshots.Save(shutdownCtx); err != nil {
+			log.Println("[shutdown] Failed to save snapshot:", err)
+		} else {
+			log.Printf("[shutdown] Snapshot of %d token series saved to %s", info.Tokens, snapshots.Path())
+		}
+	}
+
+	// clients write the final flush still queued, then get close frames
+	log.Printf("[shutdown] Closed %d WebSocket and stream clients", wsHub.Shutdown(shutdownCtx))
+	if err := <-httpStopped; err != nil {
+		log.Println("[shutdown] HTTP server did not stop in time:", err)
+	}
+	<-grpcStopped
+
+	// leave cluster, resign leadership, stop fanout and replica
 	cancel()
+	if !waitTimeout(shutdownCtx, &bg) {
+		log.Println("[shutdown] Background jobs did not stop in time")
+	}
 	log.Println("[shutdown] Shutdown complete")
 }
 
-// DemoProducer generates swap events and sends them to the provided channel at a fixed interval using a ticker.
-func DemoProducer(_ context.Context, out chan model.SwapEvent) {
+// background runs fn in a goroutine which shutdown waits for, fn returns when ctx is cancelled
+func background(wg *sync.WaitGroup, name string, fn func() error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := fn(); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("[error] %s stopped: %v", name, err)
+		}
+	}()
+}
+
+// stopGRPC waits for running calls, long ingest streams are cut when ctx is done
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("[shutdown] gRPC server did not stop in time, closing connections")
+		srv.Stop()
+		<-done
+	}
+}
+
+func waitTimeout(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// DemoProducer generates swap events and sends them to the provided channel at a fixed interval using a ticker,
+// the channel is closed when ctx is done
+func DemoProducer(ctx context.Context, out chan model.SwapEvent) {
 	t := time.NewTicker(1 * time.Millisecond) //1000 swap/sec
 	defer t.Stop()
+	defer close(out)
 
 	id := 0
+	// tx hashes of a run start with its start time, so a restarted producer never reuses the dedupe keys of the previous run
+	run := time.Now().UnixNano()
 	var ev model.SwapEvent
 
-	for now := range t.C {
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-t.C:
+		}
 		id++
+		amount := rand.Float64() + 2.0
+		rate := 2222.2 + float64(id%100)
 		ev = model.SwapEvent{
-			EventID:    "ev:" + now.Format(time.RFC3339Nano) + ":" + []string{"a", "b", "c", "d", "f"}[id%5],
 			TokenID:    tokens[id%len(tokens)],
-			Amount:     rand.Float64() + 2.0,
-			USD:        1111.1 + float64(id%100),
+			Amount:     amount,
+			USD:        amount * rate,
 			Side:       model.Sides[id%2],
-			Rate:       2222.2 + float64(id%100),
+			Rate:       rate,
 			CreatedAt:  now.Add(-time.Second * time.Duration(id%100)),
 			ExecutedAt: now,
+			Chain:      "demo",
+			TxHash:     fmt.Sprintf("0x%016x%048x", run, id/4+1),
+			LogIndex:   uint32(id % 4),
+		}
+		// id is derived from the swap, so a resent swap is a duplicate whatever the dedupe strategy
+		ev.EventID = dedupe.EventID(ev)
+		if !send(ctx, out, ev) {
+			return
 		}
-		out <- ev
 
 		//simulate duplicates
-		if id%12345 == 0 {
-			out <- ev
+		if id%12345 == 0 && !send(ctx, out, ev) {
+			return
 		}
 	}
 }
+
+// send blocks while the consumer is behind, false if ctx is done first
+func send(ctx context.Context, out chan<- model.SwapEvent, ev model.SwapEvent) bool {
+	select {
+	case out <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+)
+
+// runMigrate upgrades the redis schema, "server migrate -dry-run" only lists pending migrations
+func runMigrate(migrator *redisStorage.Migrator, args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list pending migrations without applying them")
+	_ = fs.Parse(args)
+
+	ctx := context.Background()
+	version, _, err := migrator.Version(ctx)
+	if err != nil {
+		log.Fatal("[fatal err] Can't read schema version:", err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		log.Fatal("[fatal err] Can't migrate:", err)
+	}
+	log.Printf("[migrate] Schema version %d, %d pending migrations", version, len(pending))
+	if *dryRun {
+		for _, m := range pending {
+			log.Printf("[migrate] Pending %d %s", m.Version, m.Name)
+		}
+		return
+	}
+
+	applied, err := migrator.Migrate(ctx)
+	for _, m := range applied {
+		log.Printf("[migrate] Applied %d %s", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatal("[fatal err] Migration failed:", err)
+	}
+	log.Printf("[migrate] Schema is at version %d", redisStorage.SchemaVersion)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/url"
+	"strings"
+)
+
+// runBackfill asks a writer to recompute a range from its history source, so its memory is replaced too
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	base := fs.String("url", "http://localhost:8080", "base url of the writer")
+	token := fs.String("token", "", "token to recompute")
+	from := fs.String("from", "", "start of the range, RFC 3339")
+	to := fs.String("to", "", "end of the range, RFC 3339, the current minute by default")
+	_ = fs.Parse(args)
+	if *token == "" || *from == "" {
+		return errors.New("-token and -from required")
+	}
+
+	q := url.Values{"token": {*token}, "from": {*from}}
+	if *to != "" {
+		q.Set("to", *to)
+	}
+	return postAdmin(ctx, strings.TrimRight(*base, "/")+"/admin/backfill?"+q.Encode())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+func runDedupe(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errors.New("list or clear expected")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("dedupe list", flag.ExitOnError)
+		match := fs.String("match", "*", "glob pattern of the key after the dedupe: prefix")
+		limit := fs.Int("limit", 100, "max keys to list, 0 lists all")
+		_ = fs.Parse(args[1:])
+
+		keys, err := e.store.DedupeKeys(ctx, *match, *limit)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			fmt.Printf("%s\t%s\n", k.Key, k.TTL)
+		}
+		return nil
+	case "clear":
+		fs := flag.NewFlagSet("dedupe clear", flag.ExitOnError)
+		match := fs.String("match", "", "glob pattern of the keys after the dedupe: prefix")
+		_ = fs.Parse(args[1:])
+
+		var deleted int64
+		var err error
+		switch {
+		case *match != "" && fs.NArg() > 0:
+			return errors.New("either -match or keys expected")
+		case *match != "":
+			deleted, err = e.store.ClearDedupeMatching(ctx, *match)
+		case fs.NArg() > 0:
+			deleted, err = e.store.ClearDedupe(ctx, fs.Args()...)
+		default:
+			return errors.New("-match or keys required")
+		}
+		fmt.Printf("deleted %d dedupe keys\n", deleted)
+		return err
+	}
+	return fmt.Errorf("unknown dedupe command %q", args[0])
+}
@@ -0,0 +1,112 @@
+// Command swapctl inspects and repairs the state kept in Redis, it reads the same environment as the server
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"Dexcelerate_swap_stats/internal/config"
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const usage = `usage: swapctl <command> [flags]
+
+commands:
+  stats     -token BTC [-view pending|confirmed]       stats of a token computed from Redis
+  diff      [-url http://localhost:8080] [-token BTC]  compare stats served by an instance with Redis
+  dedupe    list [-match pattern] [-limit n]           list dedupe keys
+  dedupe    clear [-match pattern] [key...]            delete dedupe keys, events are applied again
+  rebuild   -token BTC -file events.ndjson [-force]    replace a series with the sum of events of a file,
+                                                       writers must be stopped
+  snapshot  dump -out file                             write a snapshot of the state in Redis
+  snapshot  inspect -in file                           print what a snapshot holds
+  snapshot  save|restore [-url http://localhost:8080]  save or restore the snapshot of an instance
+  backfill  -token BTC -from 2026-01-02T15:00:00Z [-to time] [-url http://localhost:8080]
+                                                       recompute a range of a token from history on a writer
+
+Redis is configured with REDIS_URL, REDIS_PASSWORD, REDIS_DB and DEDUPE_KEY like the server.
+`
+
+// env is what every command works with
+type env struct {
+	cfg   config.Config
+	rdb   *redis.Client
+	store *redisStorage.Store
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "stats":
+		err = runStats(ctx, connect(ctx), args)
+	case "diff":
+		err = runDiff(ctx, connect(ctx), args)
+	case "dedupe":
+		err = runDedupe(ctx, connect(ctx), args)
+	case "rebuild":
+		err = runRebuild(ctx, connect(ctx), args)
+	case "snapshot":
+		err = runSnapshot(ctx, args)
+	case "backfill":
+		err = runBackfill(ctx, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("[error] %s: %v", cmd, err)
+	}
+}
+
+// connect opens Redis and refuses to work with a schema this build doesn't know
+func connect(ctx context.Context) *env {
+	cfg := config.GetConfig()
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisURL,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatal("[fatal err] Can't connect to redis: ", err)
+	}
+	if err := redisStorage.NewMigrator(rdb, "token_set").EnsureSchema(ctx, false); err != nil {
+		log.Fatal("[fatal err] Unsupported redis schema: ", err)
+	}
+	dedupeKey, err := dedupe.New(cfg.DedupeKey)
+	if err != nil {
+		log.Fatal("[fatal err] Bad dedupe config: ", err)
+	}
+	store := redisStorage.NewStore(rdb, "token_set", cfg.DedupeTTL,
+		redisStorage.WithConfirmations(cfg.ReorgConfirmations),
+		redisStorage.WithDedupeKey(dedupeKey),
+		redisStorage.WithTimeouts(cfg.RedisReadTimeout, cfg.RedisWriteTimeout, cfg.RedisLoadTimeout),
+		redisStorage.WithUpdateStream(cfg.ReplicaStream, int64(cfg.ReplicaStreamMaxLen)),
+	)
+	return &env{cfg: cfg, rdb: rdb, store: store}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/leader"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
+)
+
+func runRebuild(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	token := fs.String("token", "", "token whose series is replaced")
+	file := fs.String("file", "", "NDJSON file with swap events, - reads stdin")
+	dryRun := fs.Bool("dry-run", false, "read and check the file without writing")
+	force := fs.Bool("force", false, "rebuild even though writers are running")
+	_ = fs.Parse(args)
+	if *token == "" || *file == "" {
+		return errors.New("-token and -file required")
+	}
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	keyer, err := dedupe.New(e.cfg.DedupeKey)
+	if err != nil {
+		return err
+	}
+	events, err := readEvents(in, *token, validation.New(validation.Rules{DedupeKey: keyer}))
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d events of %s, nothing written\n", len(events), *token)
+		return nil
+	}
+
+	// writers don't follow the updates stream, one running now would keep the old series in memory
+	// and write on top of it, a range of a running writer is replaced with backfill instead
+	holder, err := leader.Holder(ctx, e.rdb, "leader:")
+	if err != nil {
+		return err
+	}
+	if holder != "" && !*force {
+		return fmt.Errorf("writer %s is running, stop the writers or use swapctl backfill", holder)
+	}
+
+	n, err := e.store.RebuildSeries(ctx, *token, events)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rebuilt %s from %d events, replicas follow it from the updates stream\n", *token, n)
+	return nil
+}
+
+// readEvents returns valid events of token, a broken or invalid line fails the whole file
+func readEvents(r io.Reader, token string, v *validation.Validator) ([]model.SwapEvent, error) {
+	var events []model.SwapEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev model.SwapEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.TokenID != token {
+			continue
+		}
+		if err := v.Validate(ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events, sc.Err()
+}
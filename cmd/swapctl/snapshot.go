@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+func runSnapshot(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("dump, inspect, save or restore expected")
+	}
+	switch args[0] {
+	case "dump":
+		fs := flag.NewFlagSet("snapshot dump", flag.ExitOnError)
+		out := fs.String("out", "", "snapshot file to write")
+		_ = fs.Parse(args[1:])
+		if *out == "" {
+			return errors.New("-out required")
+		}
+		e := connect(ctx)
+		// series, blocks and the update stream position are read in one transaction,
+		// a swap applied meanwhile is either in the state or replayed after restore
+		all, blocks, updateID, err := e.store.Snapshot(ctx)
+		if err != nil {
+			return err
+		}
+		store := &pinnedStore{Store: e.store, updateID: updateID}
+		eng := engine.NewEngine(store, webSocket.NewHub(), engine.WithConfirmations(e.cfg.ReorgConfirmations))
+		eng.Reset(all, blocks)
+		info, err := eng.SaveSnapshot(ctx, *out)
+		if err != nil {
+			return err
+		}
+		return printJSON(info)
+	case "inspect":
+		fs := flag.NewFlagSet("snapshot inspect", flag.ExitOnError)
+		in := fs.String("in", "", "snapshot file to read")
+		_ = fs.Parse(args[1:])
+		if *in == "" {
+			return errors.New("-in required")
+		}
+		// decoded into a throwaway engine, it checks the whole file
+		info, err := engine.NewEngine(nil, webSocket.NewHub()).RestoreFile(ctx, *in, nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(info)
+	case "save", "restore":
+		fs := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+		base := fs.String("url", "http://localhost:8080", "base url of the writer")
+		_ = fs.Parse(args[1:])
+		endpoint := "/admin/snapshot"
+		if args[0] == "restore" {
+			endpoint = "/admin/restore"
+		}
+		return postAdmin(ctx, strings.TrimRight(*base, "/")+endpoint)
+	}
+	return fmt.Errorf("unknown snapshot command %q", args[0])
+}
+
+// pinnedStore reports the update stream position of the state it was read with
+type pinnedStore struct {
+	*redisStorage.Store
+	updateID string
+}
+
+func (s *pinnedStore) LastUpdateID(context.Context) (string, error) {
+	return s.updateID, nil
+}
+
+// postAdmin calls an admin endpoint of an instance and prints its answer
+func postAdmin(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return printJSON(json.RawMessage(body))
+}
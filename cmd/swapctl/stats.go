@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+var errDrift = errors.New("stats differ")
+
+// fromRedis builds an engine with series of tokens exactly as a restarted writer would
+func fromRedis(ctx context.Context, e *env, tokens []string) (*engine.Engine, error) {
+	eng := engine.NewEngine(e.store, webSocket.NewHub(), engine.WithConfirmations(e.cfg.ReorgConfirmations))
+	if err := eng.Warm(ctx, tokens); err != nil {
+		return nil, err
+	}
+	return eng, nil
+}
+
+func runStats(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	token := fs.String("token", "", "token to show")
+	rawView := fs.String("view", "pending", "pending or confirmed")
+	_ = fs.Parse(args)
+	if *token == "" {
+		return errors.New("-token required")
+	}
+	view, err := model.ParseView(*rawView)
+	if err != nil {
+		return err
+	}
+
+	eng, err := fromRedis(ctx, e, []string{*token})
+	if err != nil {
+		return err
+	}
+	return printJSON(eng.StatsView(*token, view, eng.Now()))
+}
+
+func runDiff(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	base := fs.String("url", "http://localhost:8080", "base url of the instance")
+	token := fs.String("token", "", "token to compare, every token in Redis by default")
+	rawView := fs.String("view", "pending", "pending or confirmed")
+	_ = fs.Parse(args)
+	view, err := model.ParseView(*rawView)
+	if err != nil {
+		return err
+	}
+
+	tokens := []string{*token}
+	if *token == "" {
+		if tokens, err = e.store.Tokens(ctx); err != nil {
+			return err
+		}
+		slices.Sort(tokens)
+	}
+	eng, err := fromRedis(ctx, e, tokens)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	drifted := 0
+	for _, t := range tokens {
+		served, err := fetchStats(ctx, client, *base, t, view)
+		if err != nil {
+			return err
+		}
+		diffs := diffStats(eng.StatsView(t, view, eng.Now()), served)
+		for _, d := range diffs {
+			fmt.Printf("%s\t%s\n", t, d)
+		}
+		if len(diffs) > 0 {
+			drifted++
+		} else {
+			fmt.Printf("%s\tok\n", t)
+		}
+	}
+	if drifted > 0 {
+		// buckets may also differ when the minute turned between the two reads, run it again to be sure
+		return fmt.Errorf("%w for %d of %d tokens", errDrift, drifted, len(tokens))
+	}
+	return nil
+}
+
+func fetchStats(ctx context.Context, client *http.Client, base, token string, view model.View) (model.Stats, error) {
+	var st model.Stats
+	q := url.Values{"token": {token}, "view": {string(view)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/stats?"+q.Encode(), nil)
+	if err != nil {
+		return st, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return st, fmt.Errorf("stats of %s: %s", token, resp.Status)
+	}
+	return st, json.NewDecoder(resp.Body).Decode(&st)
+}
+
+// diffStats describes every bucket value which differs, Redis sums floats with a different precision
+func diffStats(redis, served model.Stats) []string {
+	var out []string
+	for _, b := range []struct {
+		name      string
+		want, got model.Bucket
+	}{
+		{"5m", redis.BucketMinutes5, served.BucketMinutes5},
+		{"1h", redis.BucketHours1, served.BucketHours1},
+		{"24h", redis.BucketHours24, served.BucketHours24},
+	} {
+		if b.want.Count != b.got.Count {
+			out = append(out, fmt.Sprintf("%s count: redis %d, served %d", b.name, b.want.Count, b.got.Count))
+		}
+		if !closeEnough(b.want.USD, b.got.USD) {
+			out = append(out, fmt.Sprintf("%s usd: redis %g, served %g", b.name, b.want.USD, b.got.USD))
+		}
+		if !closeEnough(b.want.Quantity, b.got.Quantity) {
+			out = append(out, fmt.Sprintf("%s quantity: redis %g, served %g", b.name, b.want.Quantity, b.got.Quantity))
+		}
+	}
+	return out
+}
+
+func closeEnough(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
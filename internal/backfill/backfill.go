@@ -0,0 +1,165 @@
+// Package backfill recomputes series of a token from the swap history kept by the producer,
+// when the Redis hash of the token is corrupted or lost
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
+)
+
+const defaultMaxRange = 24 * time.Hour
+
+// ErrBadRange means the requested range is empty, reversed or too long
+var ErrBadRange = errors.New("backfill: bad range")
+
+// HistorySource queries swaps persisted by the producer
+type HistorySource interface {
+	// Swaps calls fn for every swap of token executed in [from, to), in any order,
+	// an error of fn stops the query and is returned
+	Swaps(ctx context.Context, token string, from, to time.Time, fn func(model.SwapEvent) error) error
+}
+
+// Target swaps recomputed buckets in, implemented by engine.Engine
+type Target interface {
+	ReplaceRange(ctx context.Context, token string, from, to int64, buckets []model.MinuteBucket, dedupeKeys []string) error
+}
+
+// Result describes a finished backfill
+type Result struct {
+	Token   string    `json:"token"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Swaps   int       `json:"swaps"`
+	Skipped int       `json:"skipped"` // invalid, repeated or out of range swaps
+	Minutes int       `json:"minutes"` // minutes with at least one swap
+}
+
+type Backfiller struct {
+	source    HistorySource
+	target    Target
+	validator *validation.Validator
+	keyer     *dedupe.Keyer
+	maxRange  time.Duration
+}
+
+type Option func(*Backfiller)
+
+// WithValidator skips swaps it rejects, only structural checks are done by default
+func WithValidator(v *validation.Validator) Option {
+	return func(b *Backfiller) {
+		if v != nil {
+			b.validator = v
+		}
+	}
+}
+
+// WithDedupeKey drops repeated swaps by the key the writer dedupes live swaps on,
+// raw event ids by default
+func WithDedupeKey(k *dedupe.Keyer) Option {
+	return func(b *Backfiller) {
+		if k != nil {
+			b.keyer = k
+		}
+	}
+}
+
+// WithMaxRange bounds a single backfill, 24h by default: older buckets are compacted away anyway
+func WithMaxRange(d time.Duration) Option {
+	return func(b *Backfiller) {
+		if d > 0 {
+			b.maxRange = d
+		}
+	}
+}
+
+func New(source HistorySource, target Target, opts ...Option) *Backfiller {
+	b := &Backfiller{
+		source:    source,
+		target:    target,
+		validator: validation.New(validation.Rules{}),
+		keyer:     dedupe.ByEventID(),
+		maxRange:  defaultMaxRange,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Run recomputes buckets of token from swaps in [from, to) widened to whole minutes
+// and replaces the range at once. Dedupe keys of the summed swaps are set with the normal TTL,
+// so a swap of the range delivered again later is not counted on top. The totals include swaps
+// of blocks which are not final yet, they go straight to the confirmed view and a reorg can't retract them.
+// Swaps applied live while the history is read are replaced by what the source returned,
+// so the range should end before the minute the producer is still writing.
+func (b *Backfiller) Run(ctx context.Context, token string, from, to time.Time) (Result, error) {
+	from, to = from.UTC().Truncate(time.Minute), ceilMinute(to.UTC())
+	res := Result{Token: token, From: from, To: to}
+	switch {
+	case token == "":
+		return res, fmt.Errorf("%w: token required", ErrBadRange)
+	case !from.Before(to):
+		return res, fmt.Errorf("%w: %s is not before %s", ErrBadRange, from, to)
+	case to.Sub(from) > b.maxRange:
+		return res, fmt.Errorf("%w: %s is longer than %s", ErrBadRange, to.Sub(from), b.maxRange)
+	}
+
+	sums := make(map[int64]*model.Bucket)
+	seen := make(map[string]struct{})
+	err := b.source.Swaps(ctx, token, from, to, func(ev model.SwapEvent) error {
+		key, err := b.keyer.Key(ev)
+		_, repeated := seen[key]
+		if err != nil || repeated || ev.TokenID != token || ev.ExecutedAt.Before(from) || !ev.ExecutedAt.Before(to) ||
+			b.validator.Validate(ev) != nil {
+			res.Skipped++
+			return nil
+		}
+		seen[key] = struct{}{}
+
+		minute := ev.ExecutedAt.UTC().Unix() / 60
+		sum, ok := sums[minute]
+		if !ok {
+			sum = &model.Bucket{}
+			sums[minute] = sum
+		}
+		sum.Count++
+		sum.USD += ev.USD
+		sum.Quantity += ev.Amount
+		res.Swaps++
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("read history of %s: %w", token, err)
+	}
+
+	buckets := make([]model.MinuteBucket, 0, len(sums))
+	for minute, sum := range sums {
+		buckets = append(buckets, model.MinuteBucket{Minute: minute, Bucket: *sum})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Minute < buckets[j].Minute })
+	res.Minutes = len(buckets)
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := b.target.ReplaceRange(ctx, token, from.Unix()/60, to.Unix()/60, buckets, keys); err != nil {
+		return res, fmt.Errorf("replace buckets of %s: %w", token, err)
+	}
+	return res, nil
+}
+
+func ceilMinute(t time.Time) time.Time {
+	if tr := t.Truncate(time.Minute); tr.Before(t) {
+		return tr.Add(time.Minute)
+	}
+	return t
+}
@@ -0,0 +1,166 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+type fakeTarget struct {
+	token    string
+	from, to int64
+	buckets  []model.MinuteBucket
+	keys     []string
+	err      error
+}
+
+func (f *fakeTarget) ReplaceRange(_ context.Context, token string, from, to int64, buckets []model.MinuteBucket, keys []string) error {
+	f.token, f.from, f.to, f.buckets, f.keys = token, from, to, buckets, keys
+	return f.err
+}
+
+func writeHistory(t *testing.T, events []model.SwapEvent) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.ndjson")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	return path
+}
+
+func TestBackfill(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	swap := func(id, token string, usd float64, executed time.Time) model.SwapEvent {
+		return model.SwapEvent{EventID: id, TokenID: token, Side: model.Buy, Amount: 1, USD: usd, ExecutedAt: executed}
+	}
+	path := writeHistory(t, []model.SwapEvent{
+		swap("a", "BTC", 10, at.Add(5*time.Second)),
+		swap("b", "BTC", 20, at.Add(50*time.Second)),
+		swap("a", "BTC", 10, at.Add(5*time.Second)), // written twice by the producer
+		swap("c", "BTC", 5, at.Add(2*time.Minute)),
+		swap("d", "BTC", -1, at.Add(3*time.Minute)), // invalid
+		swap("e", "ETH", 7, at.Add(time.Minute)),
+		swap("f", "BTC", 9, at.Add(-time.Minute)), // before the range
+		swap("g", "BTC", 9, at.Add(10*time.Minute)),
+	})
+
+	target := &fakeTarget{}
+	// widened to [12:00, 12:05)
+	res, err := New(NewFileSource(path), target).Run(context.Background(), "BTC", at.Add(20*time.Second), at.Add(4*time.Minute+time.Second))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Swaps != 3 || res.Skipped != 2 || res.Minutes != 2 {
+		t.Errorf("Expected 3 swaps in 2 minutes and 2 skipped, got %+v", res)
+	}
+	minute := at.Unix() / 60
+	if target.token != "BTC" || target.from != minute || target.to != minute+5 {
+		t.Errorf("Expected BTC [%d, %d), got %s [%d, %d)", minute, minute+5, target.token, target.from, target.to)
+	}
+	expected := []model.MinuteBucket{
+		{Minute: minute, Bucket: model.Bucket{Count: 2, USD: 30, Quantity: 2}},
+		{Minute: minute + 2, Bucket: model.Bucket{Count: 1, USD: 5, Quantity: 1}},
+	}
+	if len(target.buckets) != len(expected) {
+		t.Fatalf("Expected buckets %+v, got %+v", expected, target.buckets)
+	}
+	for i := range expected {
+		if target.buckets[i] != expected[i] {
+			t.Errorf("Expected bucket %+v, got %+v", expected[i], target.buckets[i])
+		}
+	}
+	// marked as seen, so the writer doesn't count them again when they are redelivered
+	if !slices.Equal(target.keys, []string{"dedupe:a", "dedupe:b", "dedupe:c"}) {
+		t.Errorf("Expected dedupe keys of the summed swaps, got %v", target.keys)
+	}
+}
+
+func TestBackfillDedupeKey(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	swap := func(id, tx string) model.SwapEvent {
+		return model.SwapEvent{EventID: id, TokenID: "BTC", Chain: "eth", TxHash: tx, Side: model.Buy,
+			Amount: 1, USD: 10, ExecutedAt: at.Add(time.Second)}
+	}
+	// the producer retried the same swap under a new event id
+	path := writeHistory(t, []model.SwapEvent{swap("a", "0x1"), swap("b", "0x1"), swap("c", "0x2")})
+	keyer, err := dedupe.New(dedupe.StrategyTx)
+	if err != nil {
+		t.Fatalf("dedupe.New: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		swaps   int
+		skipped int
+	}{
+		{"event id", nil, 3, 0},
+		{"tx", []Option{WithDedupeKey(keyer)}, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := New(NewFileSource(path), &fakeTarget{}, tt.opts...).Run(context.Background(), "BTC", at, at.Add(time.Minute))
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if res.Swaps != tt.swaps || res.Skipped != tt.skipped {
+				t.Errorf("Expected %d swaps and %d skipped, got %+v", tt.swaps, tt.skipped, res)
+			}
+		})
+	}
+}
+
+func TestBackfillErrors(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	path := writeHistory(t, nil)
+	broken := filepath.Join(t.TempDir(), "broken.ndjson")
+	if err := os.WriteFile(broken, []byte("{not json\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	replaceErr := errors.New("redis is down")
+
+	tests := []struct {
+		name     string
+		source   string
+		token    string
+		from, to time.Time
+		target   error
+		want     error
+		replaced bool
+	}{
+		{"no token", path, "", at, at.Add(time.Hour), nil, ErrBadRange, false},
+		{"reversed", path, "BTC", at, at.Add(-time.Hour), nil, ErrBadRange, false},
+		{"too long", path, "BTC", at, at.Add(25 * time.Hour), nil, ErrBadRange, false},
+		{"missing file", path + ".missing", "BTC", at, at.Add(time.Hour), nil, os.ErrNotExist, false},
+		{"broken file", broken, "BTC", at, at.Add(time.Hour), nil, nil, false},
+		{"target fails", path, "BTC", at, at.Add(time.Hour), replaceErr, replaceErr, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &fakeTarget{err: tt.target}
+			_, err := New(NewFileSource(tt.source), target).Run(context.Background(), tt.token, tt.from, tt.to)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if replaced := target.token != ""; replaced != tt.replaced {
+				t.Errorf("Expected replaced %v, got %v", tt.replaced, replaced)
+			}
+		})
+	}
+}
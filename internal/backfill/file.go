@@ -0,0 +1,52 @@
+package backfill
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// FileSource reads history from an NDJSON file of swap events, the format of /ingest.
+// It scans the whole file on every query, it is meant for offline repairs and tests.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Swaps(ctx context.Context, token string, from, to time.Time, fn func(model.SwapEvent) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if line%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev model.SwapEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		if ev.TokenID != token || ev.ExecutedAt.Before(from) || !ev.ExecutedAt.Before(to) {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
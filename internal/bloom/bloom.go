@@ -0,0 +1,128 @@
+// Package bloom has time-partitioned Bloom filters used in front of the exact Redis dedupe.
+// A filter never forgets a key during its window, so "not seen" is certain,
+// "maybe seen" has to be confirmed by the exact check.
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Filter remembers keys of the last window
+type Filter interface {
+	// TestAndAdd adds key and reports whether it may have been added before
+	TestAndAdd(ctx context.Context, key string) (bool, error)
+	// Complete reports whether the filter has seen every key of the last window,
+	// only then "not seen" may skip the exact check
+	Complete(ctx context.Context) (bool, error)
+	Stats() Stats
+}
+
+// Stats is reported in metrics
+type Stats struct {
+	Backend         string  `json:"backend"`
+	MemoryBytes     uint64  `json:"memory_bytes"`
+	Partitions      int     `json:"partitions"`
+	Capacity        uint64  `json:"capacity"`          // keys per window the filter is sized for
+	TargetFPRate    float64 `json:"target_fp_rate"`    // configured false positive rate
+	EstimatedFPRate float64 `json:"estimated_fp_rate"` // from the current fill, 0 if unknown
+	Added           uint64  `json:"added"`
+}
+
+// Config sizes a filter
+type Config struct {
+	Window     time.Duration // how long keys are remembered, the dedupe TTL
+	Partitions int           // window is split into that many rotating parts
+	Capacity   uint64        // expected keys per window
+	FPRate     float64       // target false positive rate
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.Window <= 0:
+		return errors.New("bloom: window must be positive")
+	case c.Partitions <= 0 || time.Duration(c.Partitions) > c.Window:
+		return fmt.Errorf("bloom: bad partitions %d", c.Partitions)
+	case c.Capacity == 0:
+		return errors.New("bloom: capacity must be positive")
+	case c.FPRate <= 0 || c.FPRate >= 1:
+		return fmt.Errorf("bloom: false positive rate %v out of (0, 1)", c.FPRate)
+	}
+	return nil
+}
+
+func (c Config) period() time.Duration {
+	return c.Window / time.Duration(c.Partitions)
+}
+
+// live partitions: the current one plus enough older ones to cover the window
+func (c Config) live() int {
+	return c.Partitions + 1
+}
+
+// size returns bits and hash functions of one partition
+func (c Config) size() (m uint64, k uint32) {
+	n := float64(c.Capacity) / float64(c.Partitions)
+	if n < 1 {
+		n = 1
+	}
+	// the estimate below is for one partition, every key is tested against all of them
+	p := c.FPRate / float64(c.live())
+	m = uint64(math.Ceil(-n * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k = uint32(math.Max(1, math.Round(float64(m)/n*math.Ln2)))
+	return m, k
+}
+
+// positions returns k bit positions of key in m bits using double hashing
+func positions(key string, m uint64, k uint32) []uint64 {
+	h1 := fnv.New64a()
+	_, _ = h1.Write([]byte(key))
+	a := h1.Sum64()
+	h2 := fnv.New64()
+	_, _ = h2.Write([]byte(key))
+	b := h2.Sum64() | 1
+
+	out := make([]uint64, k)
+	for i := range out {
+		out[i] = (a + uint64(i)*b) % m
+	}
+	return out
+}
+
+// bitset is one partition of the in-process filter
+type bitset []uint64
+
+func (b bitset) testAndSet(pos []uint64) bool {
+	seen := true
+	for _, p := range pos {
+		word, mask := p/64, uint64(1)<<(p%64)
+		if b[word]&mask == 0 {
+			seen = false
+			b[word] |= mask
+		}
+	}
+	return seen
+}
+
+func (b bitset) test(pos []uint64) bool {
+	for _, p := range pos {
+		if b[p/64]&(uint64(1)<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) ones() uint64 {
+	var n int
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return uint64(n)
+}
@@ -0,0 +1,144 @@
+package bloom
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var testConfig = Config{Window: time.Hour, Partitions: 4, Capacity: 10000, FPRate: 0.01}
+
+func TestConfigSize(t *testing.T) {
+	m, k := testConfig.size()
+	if m%64 != 0 {
+		t.Errorf("Expected bits rounded to words, got %d", m)
+	}
+	// 2500 keys per partition at 0.2% per partition need about 13 bits and 9 hashes per key
+	if m < 2500*12 || m > 2500*14 {
+		t.Errorf("Expected about 13 bits per key, got %d bits", m)
+	}
+	if k < 8 || k > 10 {
+		t.Errorf("Expected about 9 hash functions, got %d", k)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := testConfig.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	bad := []Config{
+		{Window: 0, Partitions: 4, Capacity: 1, FPRate: 0.01},
+		{Window: time.Hour, Partitions: 0, Capacity: 1, FPRate: 0.01},
+		{Window: time.Hour, Partitions: 4, Capacity: 0, FPRate: 0.01},
+		{Window: time.Hour, Partitions: 4, Capacity: 1, FPRate: 1},
+	}
+	for _, cfg := range bad {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestMemoryTestAndAdd(t *testing.T) {
+	f := NewMemory(testConfig)
+	now := time.Now()
+
+	for i := 0; i < 1000; i++ {
+		if seen := f.testAndAddAt("key-"+strconv.Itoa(i), now); seen {
+			// false positives are allowed but rare
+			t.Logf("false positive for key-%d", i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.testAndAddAt("key-"+strconv.Itoa(i), now) {
+			t.Fatalf("Expected key-%d seen", i)
+		}
+	}
+
+	// fill the partition up to its capacity
+	falsePositives := 0
+	for i := 0; i < 1500; i++ {
+		if f.testAndAddAt("other-"+strconv.Itoa(i), now) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 1500; rate > 2*testConfig.FPRate {
+		t.Errorf("Expected false positive rate about %v, got %v", testConfig.FPRate, rate)
+	}
+	if st := f.Stats(); st.EstimatedFPRate <= 0 || st.EstimatedFPRate > 2*testConfig.FPRate {
+		t.Errorf("Expected estimated rate about %v, got %v", testConfig.FPRate, st.EstimatedFPRate)
+	}
+}
+
+func TestMemoryRotation(t *testing.T) {
+	period := testConfig.period()
+	now := time.Now().Truncate(period)
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		seen  bool
+	}{
+		{"same partition", period / 2, true},
+		{"within window", testConfig.Window, true},
+		{"after window", testConfig.Window + period, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewMemory(testConfig)
+			f.testAndAddAt("old", now)
+			if seen := f.testAndAddAt("old", now.Add(tt.after)); seen != tt.seen {
+				t.Errorf("Expected seen %v, got %v", tt.seen, seen)
+			}
+		})
+	}
+}
+
+func TestMemoryComplete(t *testing.T) {
+	f := NewMemory(testConfig)
+	if f.completeAt(f.started.Add(testConfig.Window - time.Second)) {
+		t.Error("Expected incomplete before the window passed")
+	}
+	if !f.completeAt(f.started.Add(testConfig.Window)) {
+		t.Error("Expected complete after the window")
+	}
+}
+
+func TestRedisTestAndAdd(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	ctx := context.Background()
+
+	f := NewRedis(cli, "bloom:", testConfig)
+	// another instance shares the bitmaps
+	g := NewRedis(cli, "bloom:", testConfig)
+	now := time.Now()
+
+	if seen, err := f.testAndAddAt(ctx, "ev-1", now); err != nil || seen {
+		t.Fatalf("Expected new key, got %v, %v", seen, err)
+	}
+	if seen, _ := g.testAndAddAt(ctx, "ev-1", now); !seen {
+		t.Error("Expected key seen by the other instance")
+	}
+	if seen, _ := g.testAndAddAt(ctx, "ev-1", now.Add(testConfig.Window)); !seen {
+		t.Error("Expected key seen within the window")
+	}
+	if seen, _ := g.testAndAddAt(ctx, "ev-2", now.Add(testConfig.Window)); seen {
+		t.Error("Expected other key new")
+	}
+
+	if ok, _ := f.Complete(ctx); ok {
+		t.Error("Expected incomplete before Start")
+	}
+	if err := f.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if ok, _ := g.completeAt(ctx, now.Add(testConfig.Window+time.Second)); !ok {
+		t.Error("Expected complete a window after the first Start")
+	}
+}
@@ -0,0 +1,111 @@
+package bloom
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process filter. It only knows keys added by this process,
+// so it suits setups where every token has a single writer.
+type Memory struct {
+	cfg Config
+	m   uint64
+	k   uint32
+
+	mu      sync.Mutex
+	parts   []bitset // oldest first, the last one takes new keys
+	current int64    // index of the last partition
+	started time.Time
+	added   uint64
+}
+
+func NewMemory(cfg Config) *Memory {
+	m, k := cfg.size()
+	now := time.Now()
+	f := &Memory{
+		cfg:     cfg,
+		m:       m,
+		k:       k,
+		parts:   make([]bitset, cfg.live()),
+		current: now.UnixNano() / int64(cfg.period()),
+		started: now,
+	}
+	for i := range f.parts {
+		f.parts[i] = make(bitset, m/64)
+	}
+	return f
+}
+
+func (f *Memory) TestAndAdd(_ context.Context, key string) (bool, error) {
+	return f.testAndAddAt(key, time.Now()), nil
+}
+
+func (f *Memory) testAndAddAt(key string, now time.Time) bool {
+	pos := positions(key, f.m, f.k)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotateLocked(now)
+	f.added++
+
+	last := len(f.parts) - 1
+	for _, p := range f.parts[:last] {
+		if p.test(pos) {
+			f.parts[last].testAndSet(pos)
+			return true
+		}
+	}
+	return f.parts[last].testAndSet(pos)
+}
+
+// rotateLocked drops partitions which are entirely older than the window
+func (f *Memory) rotateLocked(now time.Time) {
+	idx := now.UnixNano() / int64(f.cfg.period())
+	steps := idx - f.current
+	if steps <= 0 {
+		return
+	}
+	if steps > int64(len(f.parts)) {
+		steps = int64(len(f.parts))
+	}
+	// reuse dropped partitions instead of allocating
+	dropped := append([]bitset(nil), f.parts[:steps]...)
+	copy(f.parts, f.parts[steps:])
+	for i, p := range dropped {
+		clear(p)
+		f.parts[len(f.parts)-len(dropped)+i] = p
+	}
+	f.current = idx
+}
+
+func (f *Memory) Complete(_ context.Context) (bool, error) {
+	return f.completeAt(time.Now()), nil
+}
+
+func (f *Memory) completeAt(now time.Time) bool {
+	return now.Sub(f.started) >= f.cfg.Window
+}
+
+func (f *Memory) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// probability that a new key matches at least one partition
+	miss := 1.0
+	for _, p := range f.parts {
+		fill := float64(p.ones()) / float64(f.m)
+		fp := 1.0
+		for i := uint32(0); i < f.k; i++ {
+			fp *= fill
+		}
+		miss *= 1 - fp
+	}
+	return Stats{
+		Backend:         "memory",
+		MemoryBytes:     f.m / 8 * uint64(len(f.parts)),
+		Partitions:      len(f.parts),
+		Capacity:        f.cfg.Capacity,
+		TargetFPRate:    f.cfg.FPRate,
+		EstimatedFPRate: 1 - miss,
+		Added:           f.added,
+	}
+}
@@ -0,0 +1,124 @@
+package bloom
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tests bits in older partitions and sets them in the current one (KEYS[1])
+// KEYS: partitions, newest first ARGV: ttl ms, positions...
+var testAndAddScript = redis.NewScript(`
+local seen = false
+for i = 2, #KEYS do
+  local all = true
+  for j = 2, #ARGV do
+    if redis.call("GETBIT", KEYS[i], ARGV[j]) == 0 then
+      all = false
+      break
+    end
+  end
+  if all then
+    seen = true
+    break
+  end
+end
+
+local fresh = false
+for j = 2, #ARGV do
+  if redis.call("SETBIT", KEYS[1], ARGV[j], 1) == 0 then
+    fresh = true
+  end
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+
+if seen or not fresh then
+  return 1
+end
+return 0
+`)
+
+// Redis keeps partitions as bitmaps with expiry, so the filter is shared
+// by all instances and survives restarts
+type Redis struct {
+	cli    *redis.Client
+	prefix string
+	cfg    Config
+	m      uint64
+	k      uint32
+	added  atomic.Uint64
+}
+
+// NewRedis keeps bitmaps under prefix, sizing is a part of the keys
+// because bit positions of a key change with it
+func NewRedis(cli *redis.Client, prefix string, cfg Config) *Redis {
+	m, k := cfg.size()
+	prefix += strconv.FormatUint(m, 10) + ":" + strconv.FormatUint(uint64(k), 10) + ":"
+	return &Redis{cli: cli, prefix: prefix, cfg: cfg, m: m, k: k}
+}
+
+func (f *Redis) sinceKey() string { return f.prefix + "since" }
+
+func (f *Redis) partKey(idx int64) string {
+	return f.prefix + strconv.FormatInt(idx, 10)
+}
+
+// Start records when the filter began to take keys, the first instance wins
+func (f *Redis) Start(ctx context.Context) error {
+	return f.cli.SetNX(ctx, f.sinceKey(), time.Now().UnixMilli(), 0).Err()
+}
+
+func (f *Redis) TestAndAdd(ctx context.Context, key string) (bool, error) {
+	return f.testAndAddAt(ctx, key, time.Now())
+}
+
+func (f *Redis) testAndAddAt(ctx context.Context, key string, now time.Time) (bool, error) {
+	period := f.cfg.period()
+	idx := now.UnixNano() / int64(period)
+	keys := make([]string, f.cfg.live())
+	for i := range keys {
+		keys[i] = f.partKey(idx - int64(i))
+	}
+	// a partition is needed for a window after its last key
+	ttl := (f.cfg.Window + 2*period).Milliseconds()
+	args := []interface{}{ttl}
+	for _, p := range positions(key, f.m, f.k) {
+		args = append(args, p)
+	}
+
+	seen, err := testAndAddScript.Run(ctx, f.cli, keys, args...).Int()
+	if err != nil {
+		return true, err
+	}
+	f.added.Add(1)
+	return seen == 1, nil
+}
+
+func (f *Redis) Complete(ctx context.Context) (bool, error) {
+	return f.completeAt(ctx, time.Now())
+}
+
+func (f *Redis) completeAt(ctx context.Context, now time.Time) (bool, error) {
+	since, err := f.cli.Get(ctx, f.sinceKey()).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return now.Sub(time.UnixMilli(since)) >= f.cfg.Window, nil
+}
+
+func (f *Redis) Stats() Stats {
+	return Stats{
+		Backend:      "redis",
+		MemoryBytes:  f.m / 8 * uint64(f.cfg.live()),
+		Partitions:   f.cfg.live(),
+		Capacity:     f.cfg.Capacity,
+		TargetFPRate: f.cfg.FPRate,
+		Added:        f.added.Load(),
+	}
+}
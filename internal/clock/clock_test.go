@@ -0,0 +1,81 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2026, 1, 1, 23, 59, 0, 0, time.UTC)
+
+func ticks(t Ticker) int {
+	n := 0
+	for {
+		select {
+		case <-t.C():
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance []time.Duration
+		ticks   int
+	}{
+		{"before the first period", []time.Duration{59 * time.Second}, 0},
+		{"exactly one period", []time.Duration{time.Minute}, 1},
+		{"step by step", []time.Duration{30 * time.Second, 30 * time.Second, 30 * time.Second, 30 * time.Second}, 2},
+		{"missed ticks are dropped", []time.Duration{10 * time.Minute}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFake(epoch)
+			tk := c.NewTicker(time.Minute)
+			defer tk.Stop()
+			got := 0
+			for _, d := range tt.advance {
+				c.Advance(d)
+				got += ticks(tk)
+			}
+			if got != tt.ticks {
+				t.Errorf("Expected %d ticks, got %d", tt.ticks, got)
+			}
+		})
+	}
+}
+
+func TestFakeTickValue(t *testing.T) {
+	c := NewFake(epoch)
+	tk := c.NewTicker(time.Minute)
+	c.Advance(90 * time.Second)
+	if got := <-tk.C(); !got.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Expected tick at %v, got %v", epoch.Add(time.Minute), got)
+	}
+	if want := epoch.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Errorf("Expected now %v, got %v", want, c.Now())
+	}
+}
+
+func TestFakeStopAndSet(t *testing.T) {
+	c := NewFake(epoch)
+	tk := c.NewTicker(time.Second)
+	if c.Tickers() != 1 {
+		t.Fatalf("Expected 1 ticker, got %d", c.Tickers())
+	}
+	tk.Stop()
+	c.Advance(time.Minute)
+	if n := ticks(tk); n != 0 {
+		t.Errorf("Expected no ticks after Stop, got %d", n)
+	}
+	if c.Tickers() != 0 {
+		t.Errorf("Expected 0 tickers, got %d", c.Tickers())
+	}
+
+	c.Set(epoch)
+	if want := epoch.Add(time.Minute); !c.Now().Equal(want) {
+		t.Errorf("Expected time to never go back, got %v", c.Now())
+	}
+}
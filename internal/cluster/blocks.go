@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Replayer applies an update written by another writer to memory only
+type Replayer interface {
+	Replay(u model.Update)
+}
+
+// BlockRelay fans retractions and confirmations out to every writer. Any instance
+// may get /retract or /confirm, the storage is changed once by it, but swaps of the block
+// are in memory of the owners of their tokens, which replay the published update.
+// Pub/Sub doesn't keep messages, drift of a writer which was disconnected is found by the reconciler.
+type BlockRelay struct {
+	cli     *redis.Client
+	channel string
+	self    string
+}
+
+type relayMessage struct {
+	Origin string       `json:"origin"`
+	Update model.Update `json:"update"`
+}
+
+func NewBlockRelay(cli *redis.Client, channel, self string) *BlockRelay {
+	return &BlockRelay{cli: cli, channel: channel, self: self}
+}
+
+// Publish sends the update to the other writers
+func (r *BlockRelay) Publish(ctx context.Context, u model.Update) error {
+	raw, err := json.Marshal(relayMessage{Origin: r.self, Update: u})
+	if err != nil {
+		return err
+	}
+	return r.cli.Publish(ctx, r.channel, raw).Err()
+}
+
+// Run replays updates published by the other writers until ctx is done
+func (r *BlockRelay) Run(ctx context.Context, replayer Replayer) error {
+	sub := r.cli.Subscribe(ctx, r.channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			var m relayMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				log.Println("[error] Bad block update from the cluster:", err)
+				continue
+			}
+			if m.Origin == r.self {
+				continue // already applied by the writer
+			}
+			replayer.Replay(m.Update)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+	"Dexcelerate_swap_stats/internal/webSocket"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRelayedEngine is a writer of a two-node cluster, both share the redis of mr
+func newRelayedEngine(t *testing.T, mr *miniredis.Miniredis, id string) *engine.Engine {
+	t.Helper()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	store := redisStorage.NewStore(cli, "token_set", time.Hour)
+	relay := NewBlockRelay(cli, "cluster:blocks", id)
+	eng := engine.NewEngine(store, webSocket.NewHub(), engine.WithConfirmations(5), engine.WithBlockFanout(relay))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = relay.Run(ctx, eng)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return eng
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBlockRelayRetractOnNonOwner(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	owner := newRelayedEngine(t, mr, "a")
+	other := newRelayedEngine(t, mr, "b")
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	waitFor(t, "subscriptions", func() bool {
+		n, _ := cli.PubSubNumSub(ctx, "cluster:blocks").Result()
+		return n["cluster:blocks"] == 2
+	})
+
+	now := time.Now()
+	for i, block := range []uint64{10, 10, 11} {
+		ev := model.SwapEvent{EventID: "ev-" + strconv.Itoa(i), TokenID: "BTC", Side: model.Buy,
+			Amount: 1, USD: 10, ExecutedAt: now, BlockNumber: block, BlockHash: "0xa"}
+		if _, err := owner.Apply(ctx, ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+
+	// the retraction reaches the instance which doesn't own BTC
+	n, err := other.Retract(ctx, model.Retraction{BlockNumber: 10})
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 retracted swaps, got %d, %v", n, err)
+	}
+	waitFor(t, "retraction on the owner", func() bool {
+		return owner.Stats("BTC", now).BucketHours24.Count == 1
+	})
+
+	// the owner forgot the retracted block, a later confirmation promotes block 11 only
+	if _, err := other.Confirm(ctx, 11); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	waitFor(t, "confirmation on the owner", func() bool {
+		return owner.StatsView("BTC", model.ViewConfirmed, now).BucketHours24.Count == 1
+	})
+	time.Sleep(20 * time.Millisecond)
+	if got := owner.StatsView("BTC", model.ViewConfirmed, now).BucketHours24.Count; got != 1 {
+		t.Errorf("Expected 1 confirmed swap on the owner, got %d", got)
+	}
+}
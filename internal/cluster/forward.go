@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// Forward sends event to /ingest of its owner and returns the owner's answer,
+// an overloaded owner is reported as ingest.ErrOverloaded so the producer backs off
+func (n *Node) Forward(ctx context.Context, ev model.SwapEvent) (ingest.Outcome, error) {
+	owner, ok := n.Owner(ev.TokenID)
+	if !ok || owner.Addr == "" {
+		return ingest.Outcome{}, fmt.Errorf("no owner of token %s", ev.TokenID)
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return ingest.Outcome{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, owner.Addr+"/ingest", bytes.NewReader(body))
+	if err != nil {
+		return ingest.Outcome{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(ForwardedHeader, n.self.ID)
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return ingest.Outcome{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ingest.Outcome{}, fmt.Errorf("owner %s: %w", owner.ID, ingest.ErrOverloaded)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ingest.Outcome{}, fmt.Errorf("owner %s answered %s", owner.ID, resp.Status)
+	}
+	var out ingest.Outcome
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return ingest.Outcome{}, fmt.Errorf("bad answer of owner %s: %w", owner.ID, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,322 @@
+// Package cluster splits tokens between instances, membership is kept in Redis
+// with heartbeat leases and tokens are assigned by a consistent-hash ring
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ForwardedHeader is set on requests proxied to the owner,
+// receiver serves them locally so requests never bounce between instances
+const ForwardedHeader = "X-Swap-Stats-Forwarded"
+
+const (
+	defaultHeartbeat = 2 * time.Second
+	defaultLease     = 6 * time.Second
+)
+
+// Member is an instance of the cluster, Addr is its base HTTP url
+type Member struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// Rebalancer moves token state when ownership changes
+type Rebalancer interface {
+	// Warm loads state of tokens before the instance takes them over
+	Warm(ctx context.Context, tokens []string) error
+	// Release drops state of tokens owned by another instance now
+	Release(tokens []string)
+}
+
+// Node keeps membership lease of this instance and the ring of all live members
+type Node struct {
+	cli          *redis.Client
+	membersKey   string // zset member id -> lease expiry in ms
+	addrsKey     string // hash member id -> addr
+	self         Member
+	heartbeat    time.Duration
+	lease        time.Duration
+	virtualNodes int
+	tokens       func(ctx context.Context) ([]string, error)
+	rebalancer   Rebalancer
+	http         *http.Client
+
+	mu    sync.RWMutex
+	ring  *Ring
+	addrs map[string]string
+
+	handoffs []handoff // touched by Join and Run only
+}
+
+// handoff is a batch of gained tokens to warm again once the previous owners surely stopped applying
+type handoff struct {
+	tokens []string
+	at     time.Time
+}
+
+type Option func(*Node)
+
+// WithLease sets how often the lease is renewed and how long it lives,
+// a member missing heartbeats for lease is dropped from the ring
+func WithLease(heartbeat, lease time.Duration) Option {
+	return func(n *Node) {
+		if heartbeat > 0 && lease > heartbeat {
+			n.heartbeat, n.lease = heartbeat, lease
+		}
+	}
+}
+
+// WithVirtualNodes sets points per member on the ring
+func WithVirtualNodes(v int) Option {
+	return func(n *Node) {
+		if v > 0 {
+			n.virtualNodes = v
+		}
+	}
+}
+
+// WithRebalancer warms gained and releases lost tokens listed by tokens
+func WithRebalancer(r Rebalancer, tokens func(ctx context.Context) ([]string, error)) Option {
+	return func(n *Node) { n.rebalancer, n.tokens = r, tokens }
+}
+
+// WithHTTPClient sets client used to forward events to owners
+func WithHTTPClient(c *http.Client) Option {
+	return func(n *Node) {
+		if c != nil {
+			n.http = c
+		}
+	}
+}
+
+func NewNode(cli *redis.Client, prefix string, self Member, opts ...Option) *Node {
+	n := &Node{
+		cli:          cli,
+		membersKey:   prefix + "members",
+		addrsKey:     prefix + "addrs",
+		self:         self,
+		heartbeat:    defaultHeartbeat,
+		lease:        defaultLease,
+		virtualNodes: defaultVirtualNodes,
+		http:         &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// Self returns this instance
+func (n *Node) Self() Member {
+	return n.self
+}
+
+// Join registers the instance and builds the first ring,
+// Owns is false for every token until Join succeeded
+func (n *Node) Join(ctx context.Context) error {
+	if err := n.beat(ctx); err != nil {
+		return fmt.Errorf("cluster heartbeat: %w", err)
+	}
+	return n.refresh(ctx)
+}
+
+// Run renews the lease and follows membership changes until ctx is done,
+// then leaves the cluster so others take the tokens over without waiting for the lease
+func (n *Node) Run(ctx context.Context) error {
+	t := time.NewTicker(n.heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			n.leave()
+			return ctx.Err()
+		case <-t.C:
+			if err := n.beat(ctx); err != nil {
+				log.Println("[error] Cluster heartbeat failed:", err)
+				continue
+			}
+			if err := n.refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Println("[error] Cluster refresh failed:", err)
+			}
+			n.settle(ctx)
+		}
+	}
+}
+
+// Owns reports whether this instance processes token
+func (n *Node) Owns(token string) bool {
+	owner, ok := n.Owner(token)
+	return ok && owner.ID == n.self.ID
+}
+
+// Owner returns member owning token, false before Join
+func (n *Node) Owner(token string) (Member, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.ring == nil {
+		return Member{}, false
+	}
+	id, ok := n.ring.Owner(token)
+	if !ok {
+		return Member{}, false
+	}
+	return Member{ID: id, Addr: n.addrs[id]}, true
+}
+
+// Members returns live members in the current ring
+func (n *Node) Members() []Member {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.ring == nil {
+		return nil
+	}
+	out := make([]Member, 0, len(n.ring.Members()))
+	for _, id := range n.ring.Members() {
+		out = append(out, Member{ID: id, Addr: n.addrs[id]})
+	}
+	return out
+}
+
+// beat renews the lease, time is taken from Redis so clocks of instances may drift
+func (n *Node) beat(ctx context.Context) error {
+	now, err := n.cli.Time(ctx).Result()
+	if err != nil {
+		return err
+	}
+	_, err = n.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, n.membersKey, redis.Z{Score: float64(now.Add(n.lease).UnixMilli()), Member: n.self.ID})
+		p.HSet(ctx, n.addrsKey, n.self.ID, n.self.Addr)
+		return nil
+	})
+	return err
+}
+
+// refresh reads live members and rebalances if they changed
+func (n *Node) refresh(ctx context.Context) error {
+	now, err := n.cli.Time(ctx).Result()
+	if err != nil {
+		return err
+	}
+	nowMs := strconv.FormatInt(now.UnixMilli(), 10)
+	ids, err := n.cli.ZRangeByScore(ctx, n.membersKey, &redis.ZRangeBy{Min: "(" + nowMs, Max: "+inf"}).Result()
+	if err != nil {
+		return err
+	}
+	addrs, err := n.cli.HGetAll(ctx, n.addrsKey).Result()
+	if err != nil {
+		return err
+	}
+	// expired members are pruned by whoever notices them first
+	if err := n.cli.ZRemRangeByScore(ctx, n.membersKey, "-inf", nowMs).Err(); err != nil {
+		log.Println("[warning] Failed to prune expired cluster members:", err)
+	}
+
+	slices.Sort(ids)
+	n.mu.RLock()
+	old := n.ring
+	n.mu.RUnlock()
+	if old != nil && slices.Equal(old.Members(), ids) {
+		n.mu.Lock()
+		n.addrs = addrs
+		n.mu.Unlock()
+		return nil
+	}
+	return n.rebalance(ctx, old, NewRing(ids, n.virtualNodes), addrs)
+}
+
+// rebalance warms gained tokens before the new ring is used, so this instance
+// never serves a token it hasn't loaded, and releases lost tokens after it.
+// A failed warm-up keeps the old ring, it is retried on the next heartbeat.
+// The previous owner applies gained tokens until its own refresh, so they are warmed again later, see settle.
+func (n *Node) rebalance(ctx context.Context, old, next *Ring, addrs map[string]string) error {
+	var gained, lost []string
+	if n.rebalancer != nil {
+		tokens, err := n.tokens(ctx)
+		if err != nil {
+			return fmt.Errorf("list tokens: %w", err)
+		}
+		for _, token := range tokens {
+			was := old != nil && ownerIs(old, token, n.self.ID)
+			is := ownerIs(next, token, n.self.ID)
+			switch {
+			case is && !was:
+				gained = append(gained, token)
+			case was && !is, old == nil && !is:
+				lost = append(lost, token)
+			}
+		}
+		if err := n.rebalancer.Warm(ctx, gained); err != nil {
+			return fmt.Errorf("warm %d tokens: %w", len(gained), err)
+		}
+	}
+
+	n.mu.Lock()
+	n.ring, n.addrs = next, addrs
+	n.mu.Unlock()
+
+	if n.rebalancer != nil {
+		n.rebalancer.Release(lost)
+		if len(gained) > 0 {
+			n.handoffs = append(n.handoffs, handoff{tokens: gained, at: time.Now().Add(n.lease)})
+		}
+	}
+	log.Printf("[cluster] Members %v, gained %d tokens, released %d", next.Members(), len(gained), len(lost))
+	return nil
+}
+
+// settle warms gained tokens again once a lease has passed since the rebalance:
+// by then the previous owner has seen the new ring or lost its lease, so whatever it applied is in Redis.
+// Tokens lost meanwhile are skipped, a failed warm-up is retried on the next heartbeat.
+func (n *Node) settle(ctx context.Context) {
+	now := time.Now()
+	kept := n.handoffs[:0]
+	for _, h := range n.handoffs {
+		if now.Before(h.at) {
+			kept = append(kept, h)
+			continue
+		}
+		owned := slices.DeleteFunc(h.tokens, func(token string) bool { return !n.Owns(token) })
+		if len(owned) == 0 {
+			continue
+		}
+		if err := n.rebalancer.Warm(ctx, owned); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[error] Failed to warm %d handed over tokens again: %v", len(owned), err)
+			}
+			kept = append(kept, handoff{tokens: owned, at: h.at})
+			continue
+		}
+		log.Printf("[cluster] Warmed %d handed over tokens again", len(owned))
+	}
+	n.handoffs = kept
+}
+
+func ownerIs(r *Ring, token, id string) bool {
+	owner, ok := r.Owner(token)
+	return ok && owner == id
+}
+
+// leave drops the lease, errors only delay the takeover until the lease expires
+func (n *Node) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := n.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, n.membersKey, n.self.ID)
+		p.HDel(ctx, n.addrsKey, n.self.ID)
+		return nil
+	})
+	if err != nil {
+		log.Println("[warning] Failed to leave cluster:", err)
+	}
+}
@@ -0,0 +1,285 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type mockRebalancer struct {
+	owned   map[string]bool
+	warms   [][]string
+	warmErr error
+}
+
+func newMockRebalancer() *mockRebalancer {
+	return &mockRebalancer{owned: make(map[string]bool)}
+}
+
+func (m *mockRebalancer) Warm(_ context.Context, tokens []string) error {
+	if m.warmErr != nil {
+		return m.warmErr
+	}
+	m.warms = append(m.warms, slices.Clone(tokens))
+	for _, token := range tokens {
+		m.owned[token] = true
+	}
+	return nil
+}
+
+func (m *mockRebalancer) Release(tokens []string) {
+	for _, token := range tokens {
+		delete(m.owned, token)
+	}
+}
+
+var testTokens = func() []string {
+	out := make([]string, 200)
+	for i := range out {
+		out[i] = "T" + strconv.Itoa(i)
+	}
+	return out
+}()
+
+func listTokens(context.Context) ([]string, error) { return testTokens, nil }
+
+func newTestNode(t *testing.T, mr *miniredis.Miniredis, id string, r Rebalancer) *Node {
+	t.Helper()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	return NewNode(cli, "cluster:", Member{ID: id, Addr: "http://" + id},
+		WithLease(time.Second, 3*time.Second), WithRebalancer(r, listTokens))
+}
+
+func TestNodeSplitsTokens(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	ra, rb := newMockRebalancer(), newMockRebalancer()
+	a := newTestNode(t, mr, "a", ra)
+	b := newTestNode(t, mr, "b", rb)
+
+	if a.Owns("T1") {
+		t.Error("Expected no ownership before Join")
+	}
+	if err := a.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if len(ra.owned) != len(testTokens) {
+		t.Errorf("Expected single member to own all %d tokens, got %d", len(testTokens), len(ra.owned))
+	}
+
+	if err := b.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if err := a.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	for _, token := range testTokens {
+		if a.Owns(token) == b.Owns(token) {
+			t.Fatalf("Expected exactly one owner of %s", token)
+		}
+		if ra.owned[token] != a.Owns(token) || rb.owned[token] != b.Owns(token) {
+			t.Fatalf("Expected warmed state to follow ownership of %s", token)
+		}
+	}
+	if len(ra.owned) == 0 || len(rb.owned) == 0 {
+		t.Errorf("Expected both members to own tokens, got %d and %d", len(ra.owned), len(rb.owned))
+	}
+	owner, _ := a.Owner(testTokens[0])
+	if owner.Addr != "http://"+owner.ID {
+		t.Errorf("Expected owner address http://%s, got %s", owner.ID, owner.Addr)
+	}
+}
+
+func TestNodeTakesOverExpiredMember(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	ra := newMockRebalancer()
+	a := newTestNode(t, mr, "a", ra)
+	b := newTestNode(t, mr, "b", newMockRebalancer())
+	now := time.Now()
+	mr.SetTime(now)
+	for _, n := range []*Node{a, b} {
+		if err := n.Join(ctx); err != nil {
+			t.Fatalf("Join: %v", err)
+		}
+	}
+	if err := a.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if len(a.Members()) != 2 {
+		t.Fatalf("Expected 2 members, got %v", a.Members())
+	}
+
+	// b stops heartbeating, a keeps its lease
+	mr.SetTime(now.Add(2 * time.Second))
+	if err := a.beat(ctx); err != nil {
+		t.Fatalf("beat: %v", err)
+	}
+	mr.SetTime(now.Add(4 * time.Second))
+	if err := a.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if members := a.Members(); len(members) != 1 || members[0].ID != "a" {
+		t.Fatalf("Expected only a left, got %v", members)
+	}
+	if len(ra.owned) != len(testTokens) {
+		t.Errorf("Expected a to warm all tokens, got %d", len(ra.owned))
+	}
+}
+
+func TestNodeKeepsRingWhenWarmFails(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	ra := newMockRebalancer()
+	a := newTestNode(t, mr, "a", ra)
+	b := newTestNode(t, mr, "b", newMockRebalancer())
+	if err := b.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if err := a.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	// b leaves, a can't load the tokens of b and must not take them over
+	b.leave()
+	ra.warmErr = errors.New("redis is down")
+	if err := a.refresh(ctx); err == nil {
+		t.Fatal("Expected refresh error when warm-up fails")
+	}
+	if got := len(a.Members()); got != 2 {
+		t.Errorf("Expected old ring with 2 members kept, got %d", got)
+	}
+
+	ra.warmErr = nil
+	if err := a.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if !slices.Equal(memberIDs(a.Members()), []string{"a"}) || len(ra.owned) != len(testTokens) {
+		t.Errorf("Expected a to take all tokens over on retry, members %v", a.Members())
+	}
+}
+
+func TestNodeWarmsHandedOverTokensAgain(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	a := newTestNode(t, mr, "a", newMockRebalancer())
+	rb := newMockRebalancer()
+	b := newTestNode(t, mr, "b", rb)
+	if err := a.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if err := b.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	gained := len(rb.owned)
+	if gained == 0 || gained == len(testTokens) {
+		t.Fatalf("Expected b to take some tokens over, got %d", gained)
+	}
+
+	// a applies its old tokens until it refreshes, b waits a lease before it warms them again
+	b.settle(ctx)
+	if len(rb.warms) != 1 {
+		t.Fatalf("Expected no warm-up before the lease passed, got %d", len(rb.warms))
+	}
+	b.handoffs[0].at = time.Now().Add(-time.Millisecond)
+	b.settle(ctx)
+	if len(rb.warms) != 2 || len(rb.warms[1]) != gained {
+		t.Fatalf("Expected %d tokens warmed again, got %v", gained, rb.warms)
+	}
+	if len(b.handoffs) != 0 {
+		t.Errorf("Expected handoff done, got %d pending", len(b.handoffs))
+	}
+}
+
+func memberIDs(members []Member) []string {
+	out := make([]string, 0, len(members))
+	for _, m := range members {
+		out = append(out, m.ID)
+	}
+	return out
+}
+
+func TestNodeForward(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	var forwardedBy string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(ForwardedHeader)
+		var ev model.SwapEvent
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		_ = json.NewEncoder(w).Encode(struct {
+			Line int `json:"line"`
+			ingest.Outcome
+		}{1, ingest.Outcome{EventID: ev.EventID, Result: ingest.ResultApplied}})
+	}))
+	defer owner.Close()
+
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	remote := NewNode(cli, "cluster:", Member{ID: "remote", Addr: owner.URL})
+	if err := remote.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	local := NewNode(cli, "cluster:", Member{ID: "local"})
+	if err := local.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	out, err := local.Forward(ctx, model.SwapEvent{EventID: "ev-1", TokenID: "BTC"})
+	if err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+	if out.EventID != "ev-1" || out.Result != ingest.ResultApplied {
+		t.Errorf("Expected applied ev-1, got %+v", out)
+	}
+	if forwardedBy != "local" {
+		t.Errorf("Expected forwarded header local, got %q", forwardedBy)
+	}
+}
+
+func TestNodeForwardOverloadedOwner(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer owner.Close()
+
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	remote := NewNode(cli, "cluster:", Member{ID: "remote", Addr: owner.URL})
+	if err := remote.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	local := NewNode(cli, "cluster:", Member{ID: "local"})
+	if err := local.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	_, err := local.Forward(ctx, model.SwapEvent{EventID: "ev-1", TokenID: "BTC"})
+	if !errors.Is(err, ingest.ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded from overloaded owner, got %v", err)
+	}
+
+	// producer is told to back off instead of getting a failed event
+	ing := ingest.New(nil, 1, time.Second, ingest.WithRouter(local))
+	if _, err := ing.Ingest(ctx, model.SwapEvent{EventID: "ev-1", TokenID: "BTC"}); !errors.Is(err, ingest.ErrOverloaded) {
+		t.Errorf("Expected Ingest to return ErrOverloaded, got %v", err)
+	}
+}
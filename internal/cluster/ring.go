@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const defaultVirtualNodes = 128
+
+// Ring is an immutable consistent-hash ring over member ids,
+// every member has many virtual nodes so tokens spread evenly
+// and only ~1/n of them move when a member joins or leaves
+type Ring struct {
+	hashes  []uint64 // sorted
+	owners  map[uint64]string
+	members []string
+}
+
+func NewRing(members []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	r := &Ring{
+		owners:  make(map[uint64]string, len(members)*virtualNodes),
+		members: append([]string(nil), members...),
+	}
+	sort.Strings(r.members)
+	for _, m := range r.members {
+		for i := 0; i < virtualNodes; i++ {
+			h := hashKey(m + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[h]; taken {
+				continue // collision, first member in order keeps the point
+			}
+			r.owners[h] = m
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Owner returns member owning token, false for an empty ring
+func (r *Ring) Owner(token string) (string, bool) {
+	if len(r.hashes) == 0 {
+		return "", false
+	}
+	h := hashKey(token)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]], true
+}
+
+// Members returns sorted member ids
+func (r *Ring) Members() []string {
+	return r.members
+}
+
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	// fnv of similar short strings clusters, mix the bits
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingEmpty(t *testing.T) {
+	if _, ok := NewRing(nil, 0).Owner("BTC"); ok {
+		t.Error("Expected no owner in an empty ring")
+	}
+}
+
+func TestRingBalanceAndMovement(t *testing.T) {
+	tokens := make([]string, 3000)
+	for i := range tokens {
+		tokens[i] = "TOKEN" + strconv.Itoa(i)
+	}
+	three := NewRing([]string{"a", "b", "c"}, 0)
+	four := NewRing([]string{"a", "b", "c", "d"}, 0)
+
+	counts := make(map[string]int)
+	moved := 0
+	for _, token := range tokens {
+		before, _ := three.Owner(token)
+		after, _ := four.Owner(token)
+		counts[before]++
+		if before != after {
+			moved++
+			if after != "d" {
+				t.Fatalf("Expected %s to move only to the new member, moved %s -> %s", token, before, after)
+			}
+		}
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if counts[m] < 700 || counts[m] > 1300 {
+			t.Errorf("Expected about 1000 tokens on %s, got %d", m, counts[m])
+		}
+	}
+	if moved < 500 || moved > 1000 {
+		t.Errorf("Expected about a quarter of tokens moved, got %d", moved)
+	}
+}
+
+func TestRingIsDeterministic(t *testing.T) {
+	a := NewRing([]string{"x", "y", "z"}, 0)
+	b := NewRing([]string{"z", "x", "y"}, 0)
+	for i := 0; i < 100; i++ {
+		token := "T" + strconv.Itoa(i)
+		oa, _ := a.Owner(token)
+		ob, _ := b.Owner(token)
+		if oa != ob {
+			t.Fatalf("Expected the same owner of %s on every instance, got %s and %s", token, oa, ob)
+		}
+	}
+}
@@ -4,27 +4,148 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
+	Role          string // writer | reader
 	RedisURL      string
 	RedisPassword string
 	RedisDB       int
-	HttpAddr      string
-	DedupeTTL     time.Duration
-	Debug         bool
+	// bounds of a single read, a single write and a whole state load
+	RedisReadTimeout  time.Duration
+	RedisWriteTimeout time.Duration
+	RedisLoadTimeout  time.Duration
+	HttpAddr          string
+	GrpcAddr          string
+	// how long shutdown waits for requests, buffered events and background jobs
+	ShutdownTimeout time.Duration
+	SnapshotPath    string // engine snapshot file, saved on shutdown and by /admin/snapshot, empty turns it off
+	BackfillFile    string // NDJSON swap history for /admin/backfill, empty turns it off
+	DedupeTTL       time.Duration
+	DedupeKey       string // event_id | tx | fields:<name>,<name>...
+
+	// Bloom filter in front of the exact dedupe check
+	DedupeFilter           string // off | memory | redis
+	DedupeFilterPartitions int
+	DedupeFilterCapacity   int     // expected events per DedupeTTL
+	DedupeFilterFPRate     float64 // target false positive rate
+	Debug                  bool
+
+	// blocks a swap can still be retracted by a reorg, after that it is in the confirmed view
+	ReorgConfirmations uint64
+
+	// validation rules, zero disables a rule
+	ValidateMaxUSD        float64
+	ValidateRateTolerance float64
+	ValidateTokens        []string // allow-list, empty allows all
+
+	// dead-letter queue for rejected and failed events
+	DeadLetterBackend string // redis | file
+	DeadLetterStream  string // Redis stream key
+	DeadLetterMaxLen  int    // approximate cap of the stream
+	DeadLetterFile    string // NDJSON file for the file backend
+
+	// direct ingestion from producers
+	IngestMaxInFlight int
+	IngestWaitTimeout time.Duration
+
+	// WebSocket per-connection queue
+	WSQueueSize      int
+	WSOverflowPolicy string // coalesce | drop | disconnect
+	WSWriteTimeout   time.Duration
+	WSPingInterval   time.Duration
+	WSPongTimeout    time.Duration
+	WSFlushInterval  time.Duration // min interval between pushes of the same token
+	WSReplaySize     int           // updates kept per token for resume with since=<seq>
+	WSFanout         bool          // relay updates between instances via Redis Pub/Sub
+
+	// update stream written for reader replicas
+	ReplicaStream       string
+	ReplicaStreamMaxLen int           // approximate cap, 0 disables the stream and snapshot restore
+	ReplicaMaxLag       time.Duration // reader with a bigger lag is not ready
+
+	// leader runs singleton jobs
+	LeaderTTL       time.Duration
+	CompactInterval time.Duration // how often the leader deletes buckets out of the window
+
+	// comparison of memory with redis on writers
+	ReconcileInterval time.Duration // 0 turns it off
+	ReconcileHeal     bool          // replace drifted memory with redis
+
+	// token ownership between instances
+	ClusterEnabled      bool
+	InstanceID          string // unique per instance, hostname by default
+	AdvertiseAddr       string // base url other instances use to reach this one
+	ClusterHeartbeat    time.Duration
+	ClusterLease        time.Duration // member without heartbeat for this long loses its tokens
+	ClusterVirtualNodes int
 }
 
 // GetConfig default values for using locally
 func GetConfig() Config {
 	return Config{
-		RedisURL:      getEnv("REDIS_URL", "localhost:6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       mustAtoi(getEnv("REDIS_DB", "0")),
-		HttpAddr:      getEnv("HTTP_ADDR", ":8080"),
-		DedupeTTL:     parseDuration(getEnv("DEDUPE_TTL", "25h")),
-		Debug:         getEnvBool("DEBUG", false),
+		Role:              getEnv("ROLE", "writer"),
+		RedisURL:          getEnv("REDIS_URL", "localhost:6379"),
+		RedisPassword:     getEnv("REDIS_PASSWORD", ""),
+		RedisDB:           mustAtoi(getEnv("REDIS_DB", "0")),
+		RedisReadTimeout:  parseDuration(getEnv("REDIS_READ_TIMEOUT", "2s")),
+		RedisWriteTimeout: parseDuration(getEnv("REDIS_WRITE_TIMEOUT", "2s")),
+		RedisLoadTimeout:  parseDuration(getEnv("REDIS_LOAD_TIMEOUT", "30s")),
+		HttpAddr:          getEnv("HTTP_ADDR", ":8080"),
+		GrpcAddr:          getEnv("GRPC_ADDR", ":9090"),
+		ShutdownTimeout:   parseDuration(getEnv("SHUTDOWN_TIMEOUT", "15s")),
+		SnapshotPath:      getEnv("SNAPSHOT_PATH", ""),
+		BackfillFile:      getEnv("BACKFILL_FILE", ""),
+		DedupeTTL:         parseDuration(getEnv("DEDUPE_TTL", "25h")),
+		DedupeKey:         getEnv("DEDUPE_KEY", "event_id"),
+
+		DedupeFilter:           getEnv("DEDUPE_FILTER", "off"),
+		DedupeFilterPartitions: mustAtoi(getEnv("DEDUPE_FILTER_PARTITIONS", "5")),
+		DedupeFilterCapacity:   mustAtoi(getEnv("DEDUPE_FILTER_CAPACITY", "10000000")),
+		DedupeFilterFPRate:     mustParseFloat(getEnv("DEDUPE_FILTER_FP_RATE", "0.001")),
+		Debug:                  getEnvBool("DEBUG", false),
+
+		ReorgConfirmations: uint64(mustAtoi(getEnv("REORG_CONFIRMATIONS", "64"))),
+
+		ValidateMaxUSD:        mustParseFloat(getEnv("VALIDATE_MAX_USD", "0")),
+		ValidateRateTolerance: mustParseFloat(getEnv("VALIDATE_RATE_TOLERANCE", "0")),
+		ValidateTokens:        splitList(getEnv("VALIDATE_TOKENS", "")),
+
+		DeadLetterBackend: getEnv("DEADLETTER_BACKEND", "redis"),
+		DeadLetterStream:  getEnv("DEADLETTER_STREAM", "deadletter"),
+		DeadLetterMaxLen:  mustAtoi(getEnv("DEADLETTER_MAX_LEN", "100000")),
+		DeadLetterFile:    getEnv("DEADLETTER_FILE", "deadletter.ndjson"),
+
+		IngestMaxInFlight: mustAtoi(getEnv("INGEST_MAX_IN_FLIGHT", "64")),
+		IngestWaitTimeout: parseDuration(getEnv("INGEST_WAIT_TIMEOUT", "500ms")),
+
+		WSQueueSize:      mustAtoi(getEnv("WS_QUEUE_SIZE", "64")),
+		WSOverflowPolicy: getEnv("WS_OVERFLOW_POLICY", "coalesce"),
+		WSWriteTimeout:   parseDuration(getEnv("WS_WRITE_TIMEOUT", "5s")),
+		WSPingInterval:   parseDuration(getEnv("WS_PING_INTERVAL", "30s")),
+		WSPongTimeout:    parseDuration(getEnv("WS_PONG_TIMEOUT", "60s")),
+		WSFlushInterval:  parseDuration(getEnv("WS_FLUSH_INTERVAL", "250ms")),
+		WSReplaySize:     mustAtoi(getEnv("WS_REPLAY_SIZE", "256")),
+		WSFanout:         getEnvBool("WS_FANOUT", false),
+
+		ReplicaStream:       getEnv("REPLICA_STREAM", "updates"),
+		ReplicaStreamMaxLen: mustAtoi(getEnv("REPLICA_STREAM_MAX_LEN", "100000")),
+		ReplicaMaxLag:       parseDuration(getEnv("REPLICA_MAX_LAG", "5s")),
+
+		LeaderTTL:       parseDuration(getEnv("LEADER_TTL", "10s")),
+		CompactInterval: parseDuration(getEnv("COMPACT_INTERVAL", "10m")),
+
+		ReconcileInterval: parseDuration(getEnv("RECONCILE_INTERVAL", "5m")),
+		ReconcileHeal:     getEnvBool("RECONCILE_HEAL", false),
+
+		ClusterEnabled:      getEnvBool("CLUSTER_ENABLED", false),
+		InstanceID:          getEnv("INSTANCE_ID", hostname()),
+		AdvertiseAddr:       getEnv("ADVERTISE_ADDR", "http://localhost:8080"),
+		ClusterHeartbeat:    parseDuration(getEnv("CLUSTER_HEARTBEAT", "2s")),
+		ClusterLease:        parseDuration(getEnv("CLUSTER_LEASE", "6s")),
+		ClusterVirtualNodes: mustAtoi(getEnv("CLUSTER_VIRTUAL_NODES", "128")),
 	}
 
 }
@@ -44,6 +165,33 @@ func mustAtoi(s string) int {
 	return v
 }
 
+func mustParseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return v
+}
+
+// splitList parses comma separated values, empty items are skipped
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return h
+}
+
 func getEnvBool(key string, def bool) bool {
 	if v, ok := os.LookupEnv(key); ok {
 		if b, err := strconv.ParseBool(v); err == nil {
@@ -0,0 +1,82 @@
+// Package deadletter keeps events which were rejected or failed to apply,
+// so they can be inspected and re-driven later
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+type Kind string
+
+const (
+	KindRejected Kind = "rejected" // failed validation
+	KindFailed   Kind = "failed"   // storage or engine error
+)
+
+var (
+	ErrNotFound = errors.New("deadletter: entry not found")
+	// ErrInvalidID means the id can't be an id of the store, the caller passed a malformed one
+	ErrInvalidID = errors.New("deadletter: invalid id")
+)
+
+type Entry struct {
+	ID     string          `json:"id"`
+	Kind   Kind            `json:"kind"`
+	Reason string          `json:"reason"`
+	Event  model.SwapEvent `json:"event"`
+	At     time.Time       `json:"at"`
+}
+
+// Store persists entries in insertion order, ids grow monotonically
+type Store interface {
+	Add(ctx context.Context, e Entry) (string, error)
+	// List returns up to limit entries with id after the given one, "" means from the start
+	List(ctx context.Context, after string, limit int) ([]Entry, error)
+	Get(ctx context.Context, id string) (Entry, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Queue is the dead-letter sink of the engine
+type Queue struct {
+	store   Store
+	timeout time.Duration
+}
+
+func NewQueue(store Store, timeout time.Duration) *Queue {
+	return &Queue{store: store, timeout: timeout}
+}
+
+func (q *Queue) Reject(ev model.SwapEvent, reason error) {
+	q.add(KindRejected, ev, reason)
+}
+
+func (q *Queue) Fail(ev model.SwapEvent, err error) {
+	q.add(KindFailed, ev, err)
+}
+
+func (q *Queue) add(kind Kind, ev model.SwapEvent, reason error) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+	entry := Entry{Kind: kind, Reason: reason.Error(), Event: ev, At: time.Now().UTC()}
+	if _, err := q.store.Add(ctx, entry); err != nil {
+		// the event is lost for re-drive, keep at least a trace
+		log.Printf("[error] Failed to dead-letter %s event %q (%v): %v", kind, ev.EventID, reason, err)
+	}
+}
+
+func (q *Queue) List(ctx context.Context, after string, limit int) ([]Entry, error) {
+	return q.store.List(ctx, after, limit)
+}
+
+func (q *Queue) Get(ctx context.Context, id string) (Entry, error) {
+	return q.store.Get(ctx, id)
+}
+
+func (q *Queue) Delete(ctx context.Context, id string) error {
+	return q.store.Delete(ctx, id)
+}
@@ -0,0 +1,133 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	return NewRedisStore(cli, "deadletter", 1000)
+}
+
+func newFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	q := NewQueue(store, time.Second)
+
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Amount: 2, USD: 20, Side: model.Buy, ExecutedAt: time.Unix(1700000000, 0).UTC()}
+	q.Reject(ev, errors.New("bad rate"))
+	q.Fail(model.SwapEvent{EventID: "ev-2", TokenID: "ETH"}, errors.New("redis is down"))
+	q.Fail(model.SwapEvent{EventID: "ev-3", TokenID: "ETH"}, errors.New("redis is down"))
+
+	all, err := q.List(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(all))
+	}
+	first := all[0]
+	if first.Kind != KindRejected || first.Reason != "bad rate" {
+		t.Errorf("Expected rejected entry with reason, got %+v", first)
+	}
+	if first.Event != ev {
+		t.Errorf("Expected event %+v, got %+v", ev, first.Event)
+	}
+	if all[1].Kind != KindFailed {
+		t.Errorf("Expected failed entry, got %s", all[1].Kind)
+	}
+
+	page, err := q.List(ctx, first.ID, 1)
+	if err != nil {
+		t.Fatalf("List after: %v", err)
+	}
+	if len(page) != 1 || page[0].Event.EventID != "ev-2" {
+		t.Errorf("Expected ev-2 after first entry, got %+v", page)
+	}
+
+	got, err := q.Get(ctx, all[2].ID)
+	if err != nil || got.Event.EventID != "ev-3" {
+		t.Errorf("Expected ev-3, got %+v, %v", got, err)
+	}
+
+	if err := q.Delete(ctx, all[1].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := q.Get(ctx, all[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := q.Delete(ctx, all[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+	}
+	if _, err := q.Get(ctx, "not-an-id"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID for a malformed id, got %v", err)
+	}
+	if err := q.Delete(ctx, "not-an-id"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID on delete of a malformed id, got %v", err)
+	}
+	rest, _ := q.List(ctx, "", 10)
+	if len(rest) != 2 {
+		t.Errorf("Expected 2 entries left, got %d", len(rest))
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, newRedisStore(t))
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, newFileStore(t, filepath.Join(t.TempDir(), "deadletter.ndjson")))
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "deadletter.ndjson")
+
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	id1, _ := s.Add(ctx, Entry{Kind: KindFailed, Event: model.SwapEvent{EventID: "ev-1"}})
+	id2, _ := s.Add(ctx, Entry{Kind: KindFailed, Event: model.SwapEvent{EventID: "ev-2"}})
+	if err := s.Delete(ctx, id1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s = newFileStore(t, path)
+	all, err := s.List(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != id2 {
+		t.Fatalf("Expected only %s after reopen, got %+v", id2, all)
+	}
+	// ids are not reused after restart
+	id3, _ := s.Add(ctx, Entry{Kind: KindFailed, Event: model.SwapEvent{EventID: "ev-3"}})
+	if id3 == id1 || id3 == id2 {
+		t.Errorf("Expected a new id, got %s", id3)
+	}
+}
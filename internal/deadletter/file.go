@@ -0,0 +1,156 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// FileStore keeps entries in an append-only NDJSON file for setups without Redis.
+// Deletes are appended as tombstones, the file is replayed on open.
+type FileStore struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]Entry
+	order   []uint64 // live ids in insertion order
+	nextID  uint64
+}
+
+type fileRecord struct {
+	Entry
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{f: f, entries: make(map[string]Entry), nextID: 1}
+	if err := s.replay(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) replay() error {
+	sc := bufio.NewScanner(s.f)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		var rec fileRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("deadletter file: %w", err)
+		}
+		id, err := strconv.ParseUint(rec.ID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("deadletter file: bad id %q", rec.ID)
+		}
+		if rec.Deleted {
+			delete(s.entries, rec.ID)
+		} else {
+			s.entries[rec.ID] = rec.Entry
+		}
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for id := range s.entries {
+		n, _ := strconv.ParseUint(id, 10, 64)
+		s.order = append(s.order, n)
+	}
+	sort.Slice(s.order, func(i, j int) bool { return s.order[i] < s.order[j] })
+	return nil
+}
+
+func (s *FileStore) write(rec fileRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(raw, '\n'))
+	return err
+}
+
+func (s *FileStore) Add(_ context.Context, e Entry) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	e.ID = strconv.FormatUint(id, 10)
+	if err := s.write(fileRecord{Entry: e}); err != nil {
+		return "", err
+	}
+	s.nextID++
+	s.entries[e.ID] = e
+	s.order = append(s.order, id)
+	return e.ID, nil
+}
+
+func (s *FileStore) List(_ context.Context, after string, limit int) ([]Entry, error) {
+	var from uint64
+	if after != "" {
+		v, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidID, after)
+		}
+		from = v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.order), func(i int) bool { return s.order[i] > from })
+	var out []Entry
+	for ; i < len(s.order) && len(out) < limit; i++ {
+		out = append(out, s.entries[strconv.FormatUint(s.order[i], 10)])
+	}
+	return out, nil
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (Entry, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return Entry{}, fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	if err := s.write(fileRecord{Entry: Entry{ID: id}, Deleted: true}); err != nil {
+		return err
+	}
+	delete(s.entries, id)
+	n, _ := strconv.ParseUint(id, 10, 64)
+	i := sort.Search(len(s.order), func(i int) bool { return s.order[i] >= n })
+	if i < len(s.order) && s.order[i] == n {
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.f.Sync(), s.f.Close())
+}
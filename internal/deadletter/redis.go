@@ -0,0 +1,119 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps entries in a capped Redis stream
+type RedisStore struct {
+	cli    *redis.Client
+	key    string
+	maxLen int64
+}
+
+func NewRedisStore(cli *redis.Client, key string, maxLen int64) *RedisStore {
+	return &RedisStore{cli: cli, key: key, maxLen: maxLen}
+}
+
+func (s *RedisStore) Add(ctx context.Context, e Entry) (string, error) {
+	raw, err := json.Marshal(e.Event)
+	if err != nil {
+		return "", err
+	}
+	return s.cli.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]any{
+			"kind":   string(e.Kind),
+			"reason": e.Reason,
+			"event":  raw,
+			"at":     e.At.Format(time.RFC3339Nano),
+		},
+	}).Result()
+}
+
+func (s *RedisStore) List(ctx context.Context, after string, limit int) ([]Entry, error) {
+	start := "-"
+	if after != "" {
+		if !validID(after) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidID, after)
+		}
+		start = "(" + after
+	}
+	msgs, err := s.cli.XRangeN(ctx, s.key, start, "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(msgs))
+	for _, msg := range msgs {
+		e, err := fromMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (Entry, error) {
+	if !validID(id) {
+		return Entry{}, fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	msgs, err := s.cli.XRange(ctx, s.key, id, id).Result()
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(msgs) == 0 {
+		return Entry{}, ErrNotFound
+	}
+	return fromMessage(msgs[0])
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	if !validID(id) {
+		return fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	n, err := s.cli.XDel(ctx, s.key, id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// validID reports whether id is a stream entry id "<ms>-<seq>", Redis fails on anything else
+func validID(id string) bool {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+	_, errMs := strconv.ParseUint(ms, 10, 64)
+	_, errSeq := strconv.ParseUint(seq, 10, 64)
+	return errMs == nil && errSeq == nil
+}
+
+func fromMessage(msg redis.XMessage) (Entry, error) {
+	e := Entry{ID: msg.ID}
+	kind, _ := msg.Values["kind"].(string)
+	e.Kind = Kind(kind)
+	e.Reason, _ = msg.Values["reason"].(string)
+	if raw, ok := msg.Values["event"].(string); ok {
+		if err := json.Unmarshal([]byte(raw), &e.Event); err != nil {
+			return Entry{}, fmt.Errorf("entry %s: %w", msg.ID, err)
+		}
+	}
+	if at, ok := msg.Values["at"].(string); ok {
+		e.At, _ = time.Parse(time.RFC3339Nano, at)
+	}
+	return e, nil
+}
@@ -0,0 +1,111 @@
+// Package dedupe derives the key which identifies a swap for deduplication,
+// every store must use it so the same event maps to the same key everywhere
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const (
+	Prefix = "dedupe:"
+
+	StrategyEventID = "event_id" // producer supplied id, the default
+	StrategyTx      = "tx"       // chain, tx hash and log index
+	fieldsPrefix    = "fields:"  // custom set, e.g. fields:chain,tx_hash,log_index
+)
+
+var ErrMissingField = errors.New("dedupe: missing key field")
+
+// field extracts a value of the key, required ones can't be empty
+type field struct {
+	value    func(ev model.SwapEvent) string
+	required bool
+}
+
+var fields = map[string]field{
+	"event_id":     {func(ev model.SwapEvent) string { return ev.EventID }, true},
+	"chain":        {func(ev model.SwapEvent) string { return ev.Chain }, false},
+	"token_id":     {func(ev model.SwapEvent) string { return ev.TokenID }, true},
+	"tx_hash":      {func(ev model.SwapEvent) string { return ev.TxHash }, true},
+	"log_index":    {func(ev model.SwapEvent) string { return strconv.FormatUint(uint64(ev.LogIndex), 10) }, false},
+	"block_number": {func(ev model.SwapEvent) string { return strconv.FormatUint(ev.BlockNumber, 10) }, false},
+	"block_hash":   {func(ev model.SwapEvent) string { return ev.BlockHash }, false},
+	"side":         {func(ev model.SwapEvent) string { return string(ev.Side) }, false},
+	"amount":       {func(ev model.SwapEvent) string { return strconv.FormatFloat(ev.Amount, 'g', -1, 64) }, false},
+	"usd":          {func(ev model.SwapEvent) string { return strconv.FormatFloat(ev.USD, 'g', -1, 64) }, false},
+	"executed_at":  {func(ev model.SwapEvent) string { return ev.ExecutedAt.UTC().Format(time.RFC3339Nano) }, false},
+}
+
+var txFields = []string{"chain", "tx_hash", "log_index"}
+
+// Keyer builds dedupe keys by a configured strategy
+type Keyer struct {
+	names []string // nil means raw event id
+}
+
+// ByEventID returns the default keyer using the producer supplied id
+func ByEventID() *Keyer {
+	return &Keyer{}
+}
+
+// New parses strategy: "event_id", "tx" or "fields:<name>,<name>..."
+func New(strategy string) (*Keyer, error) {
+	switch {
+	case strategy == "" || strategy == StrategyEventID:
+		return ByEventID(), nil
+	case strategy == StrategyTx:
+		return &Keyer{names: txFields}, nil
+	case strings.HasPrefix(strategy, fieldsPrefix):
+		var names []string
+		for _, name := range strings.Split(strings.TrimPrefix(strategy, fieldsPrefix), ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := fields[name]; !ok {
+				return nil, fmt.Errorf("unknown dedupe field: %q", name)
+			}
+			names = append(names, name)
+		}
+		return &Keyer{names: names}, nil
+	}
+	return nil, fmt.Errorf("unknown dedupe strategy: %q", strategy)
+}
+
+// Key returns the Redis key marking ev as seen.
+// Event id strategy keeps the historical "dedupe:<event_id>" keys,
+// other strategies hash the field values.
+func (k *Keyer) Key(ev model.SwapEvent) (string, error) {
+	if k.names == nil {
+		if ev.EventID == "" {
+			return "", fmt.Errorf("%w: event_id", ErrMissingField)
+		}
+		return Prefix + ev.EventID, nil
+	}
+	values := make([]string, len(k.names))
+	for i, name := range k.names {
+		f := fields[name]
+		values[i] = f.value(ev)
+		if f.required && values[i] == "" {
+			return "", fmt.Errorf("%w: %s", ErrMissingField, name)
+		}
+	}
+	return Prefix + hash(values), nil
+}
+
+// EventID derives a deterministic id from chain, tx hash and log index,
+// so a producer retrying the same swap always sends the same id
+func EventID(ev model.SwapEvent) string {
+	return hash([]string{ev.Chain, ev.TxHash, strconv.FormatUint(uint64(ev.LogIndex), 10)})
+}
+
+func hash(values []string) string {
+	// unit separator can't appear in any of the fields
+	sum := sha256.Sum256([]byte(strings.Join(values, "\x1f")))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,87 @@
+package dedupe
+
+import (
+	"errors"
+	"testing"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+func TestKeyer(t *testing.T) {
+	base := model.SwapEvent{EventID: "ev-1", TokenID: "ETH", Chain: "ethereum", TxHash: "0xabc", LogIndex: 3}
+
+	tests := []struct {
+		name     string
+		strategy string
+		a, b     func(ev *model.SwapEvent)
+		same     bool
+	}{
+		{"event id same", "", func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.TxHash = "0xdef" }, true},
+		{"event id differs", StrategyEventID, func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.EventID = "ev-2" }, false},
+		{"tx ignores regenerated id", StrategyTx, func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.EventID = "ev-2" }, true},
+		{"tx log index", StrategyTx, func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.LogIndex = 4 }, false},
+		{"tx chain", StrategyTx, func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.Chain = "base" }, false},
+		{"custom fields", "fields:token_id, tx_hash", func(*model.SwapEvent) {}, func(ev *model.SwapEvent) { ev.LogIndex = 4 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := New(tt.strategy)
+			if err != nil {
+				t.Fatalf("New(%q): %v", tt.strategy, err)
+			}
+			a, b := base, base
+			tt.a(&a)
+			tt.b(&b)
+			ka, err := k.Key(a)
+			if err != nil {
+				t.Fatalf("Key: %v", err)
+			}
+			kb, err := k.Key(b)
+			if err != nil {
+				t.Fatalf("Key: %v", err)
+			}
+			if (ka == kb) != tt.same {
+				t.Errorf("Expected same=%v, got %q and %q", tt.same, ka, kb)
+			}
+		})
+	}
+}
+
+func TestKeyerEventIDKeepsLegacyKey(t *testing.T) {
+	k, _ := New(StrategyEventID)
+	key, err := k.Key(model.SwapEvent{EventID: "ev-1"})
+	if err != nil || key != "dedupe:ev-1" {
+		t.Errorf("Expected dedupe:ev-1, got %q, %v", key, err)
+	}
+}
+
+func TestKeyerMissingField(t *testing.T) {
+	k, _ := New(StrategyTx)
+	if _, err := k.Key(model.SwapEvent{EventID: "ev-1", Chain: "ethereum"}); !errors.Is(err, ErrMissingField) {
+		t.Errorf("Expected ErrMissingField, got %v", err)
+	}
+	// zero log index is the first log of a tx
+	if _, err := k.Key(model.SwapEvent{TxHash: "0xabc"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	for _, strategy := range []string{"hash", "fields:tx_hash,nonce"} {
+		if _, err := New(strategy); err == nil {
+			t.Errorf("Expected error for %q", strategy)
+		}
+	}
+}
+
+func TestEventIDIsDeterministic(t *testing.T) {
+	ev := model.SwapEvent{Chain: "ethereum", TxHash: "0xabc", LogIndex: 3}
+	if EventID(ev) != EventID(ev) {
+		t.Error("Expected the same id for the same swap")
+	}
+	other := ev
+	other.LogIndex = 4
+	if EventID(ev) == EventID(other) {
+		t.Error("Expected different ids for different logs")
+	}
+}
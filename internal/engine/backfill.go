@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// ReplaceRange replaces buckets of a token in minutes [from, to) in storage and memory,
+// minutes without a bucket become empty. dedupeKeys of the summed swaps are marked as seen
+// and pending swaps of the token in the range are forgotten, they are in the new totals.
+// The engine lock is held across both, so a swap applied meanwhile is counted
+// either before the range is replaced or on top of it.
+func (e *Engine) ReplaceRange(ctx context.Context, token string, from, to int64, buckets []model.MinuteBucket, dedupeKeys []string) error {
+	if token == "" || from >= to {
+		return fmt.Errorf("bad range of %q: [%d, %d)", token, from, to)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := e.store.ReplaceRange(context.WithoutCancel(ctx), token, from, to, buckets, dedupeKeys); err != nil {
+		return err
+	}
+	e.forgetRangeLocked(token, from, to)
+	e.replaceLocked(token, from, to, buckets)
+	return nil
+}
+
+// forgetRangeLocked drops pending swaps of token in minutes [from, to), like storage does on backfill
+func (e *Engine) forgetRangeLocked(token string, from, to int64) {
+	for number, swaps := range e.blocks {
+		kept := swaps[:0]
+		for _, swap := range swaps {
+			if swap.Token != token || swap.Minute < from || swap.Minute >= to {
+				kept = append(kept, swap)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.blocks, number)
+			continue
+		}
+		e.blocks[number] = kept
+	}
+}
+
+// replaceLocked swaps buckets of the range in both views,
+// swaps of blocks which are not final yet stay out of the confirmed one
+func (e *Engine) replaceLocked(token string, from, to int64, buckets []model.MinuteBucket) {
+	now := e.clock.Now().UTC()
+	nowMin := unixMin(now)
+	s := e.ensureSeries(token, now)
+	e.advanceTo(s, nowMin)
+
+	for m := max(from, s.StartMinute); m < to && m <= nowMin; m++ {
+		idx, _ := s.index(m)
+		s.Buckets[idx] = model.Bucket{}
+		s.Confirmed[idx] = model.Bucket{}
+	}
+	for _, b := range buckets {
+		if b.Minute < from || b.Minute >= to {
+			continue
+		}
+		if idx, ok := s.index(b.Minute); ok {
+			s.Buckets[idx] = b.Bucket
+			s.Confirmed[idx] = b.Bucket
+		}
+	}
+	for _, swaps := range e.blocks {
+		for _, swap := range swaps {
+			if swap.Token != token || swap.Minute < from || swap.Minute >= to {
+				continue
+			}
+			if idx, ok := s.index(swap.Minute); ok {
+				subSwap(&s.Confirmed[idx], swap)
+			}
+		}
+	}
+	e.pub.markDirty(token, model.ViewPending)
+	e.pub.markDirty(token, model.ViewConfirmed)
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/clock"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+func TestEngineReplaceRange(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 30, 0, time.UTC))
+	store := newMockStorage()
+	e := NewEngine(store, webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	ctx := context.Background()
+	now := clk.Now()
+	nowMin := unixMin(now)
+
+	events := []model.SwapEvent{
+		{EventID: "old", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 1000, ExecutedAt: now.Add(-2 * time.Hour)},
+		{EventID: "lost", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 50, ExecutedAt: now.Add(-5 * time.Minute)},
+		{EventID: "pending", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 20, ExecutedAt: now.Add(-3 * time.Minute),
+			BlockNumber: 7, BlockHash: "0xa"},
+		{EventID: "eth", TokenID: "ETH", Side: model.Buy, Amount: 1, USD: 5, ExecutedAt: now},
+	}
+	for _, ev := range events {
+		if _, err := e.Apply(ctx, ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+
+	// the history has the pending swap and two swaps the hash lost
+	buckets := []model.MinuteBucket{
+		{Minute: nowMin - 5, Bucket: model.Bucket{Count: 2, USD: 80, Quantity: 2}},
+		{Minute: nowMin - 3, Bucket: model.Bucket{Count: 2, USD: 30, Quantity: 2}},
+		{Minute: nowMin - 90, Bucket: model.Bucket{Count: 9, USD: 9, Quantity: 9}}, // out of range, ignored
+	}
+	if err := e.ReplaceRange(ctx, "BTC", nowMin-60, nowMin+1, buckets, nil); err != nil {
+		t.Fatalf("ReplaceRange: %v", err)
+	}
+	if len(store.replaced["BTC"]) != 3 {
+		t.Errorf("Expected buckets written to storage, got %+v", store.replaced)
+	}
+
+	tests := []struct {
+		view  model.View
+		token string
+		count uint64
+		usd   float64
+	}{
+		{model.ViewPending, "BTC", 5, 1110},
+		{model.ViewConfirmed, "BTC", 5, 1110}, // swap of block 7 is in the backfilled totals, not pending any more
+		{model.ViewPending, "ETH", 1, 5},
+	}
+	for _, tt := range tests {
+		got := e.StatsView(tt.token, tt.view, now).BucketHours24
+		if got.Count != tt.count || got.USD != tt.usd {
+			t.Errorf("Expected %s %s count %d usd %v, got %+v", tt.token, tt.view, tt.count, tt.usd, got)
+		}
+	}
+
+	// a retraction of the block later doesn't subtract from the backfilled totals
+	if _, err := e.Retract(ctx, model.Retraction{BlockNumber: 7, BlockHash: "0xa"}); err != nil {
+		t.Fatalf("Retract: %v", err)
+	}
+	if _, err := e.Confirm(ctx, 7); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	for _, view := range []model.View{model.ViewPending, model.ViewConfirmed} {
+		if got := e.StatsView("BTC", view, now).BucketHours24; got.Count != 5 || got.USD != 1110 {
+			t.Errorf("Expected %s view unchanged after retract and confirm, got %+v", view, got)
+		}
+	}
+}
+
+func TestEngineReplaceRangeKeepsStateOnError(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	store := newMockStorage()
+	e := NewEngine(store, webSocket.NewHub(), WithClock(clk))
+	ctx := context.Background()
+	nowMin := unixMin(clk.Now())
+	if _, err := e.Apply(ctx, model.SwapEvent{EventID: "a", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 1,
+		ExecutedAt: clk.Now()}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		from, to int64
+		storeErr error
+	}{
+		{"storage fails", ctx, nowMin - 10, nowMin + 1, errors.New("redis is down")},
+		{"cancelled", cancelled, nowMin - 10, nowMin + 1, nil},
+		{"empty range", ctx, nowMin, nowMin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.applyErr = tt.storeErr
+			if err := e.ReplaceRange(tt.ctx, "BTC", tt.from, tt.to, nil, nil); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if got := e.Stats("BTC", clk.Now()).BucketHours24.Count; got != 1 {
+				t.Errorf("Expected state unchanged, got %d swaps", got)
+			}
+		})
+	}
+}
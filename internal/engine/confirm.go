@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const defaultConfirmations = 64
+
+// Swaps of the last confirmations blocks are in the pending view only.
+// When the head moves past them, or a block is confirmed explicitly,
+// they are promoted to the confirmed view. Swaps without a block are final at once.
+
+// trackLocked puts applied swap into the confirmed view or remembers it until its block is final
+func (e *Engine) trackLocked(s *series, ev model.SwapEvent, evMin, nowMin int64) {
+	if ev.BlockNumber == 0 || ev.BlockNumber <= e.final {
+		if idx, ok := s.index(evMin); ok {
+			addSwap(&s.Confirmed[idx], ev.USD, ev.Amount)
+			e.pub.markDirty(ev.TokenID, model.ViewConfirmed)
+		}
+		return
+	}
+
+	e.blocks[ev.BlockNumber] = append(e.blocks[ev.BlockNumber], model.BlockSwap{
+		Token:     ev.TokenID,
+		Minute:    evMin,
+		USD:       ev.USD,
+		Quantity:  ev.Amount,
+		BlockHash: ev.BlockHash,
+	})
+	if ev.BlockNumber > e.head {
+		e.head = ev.BlockNumber
+		if e.head >= e.confirmations {
+			e.promoteLocked(e.head-e.confirmations, nowMin)
+		}
+	}
+}
+
+// Confirm marks every block up to number final, returns how many swaps were promoted.
+// The confirmation goes to the updates stream first, so readers promote the same swaps.
+func (e *Engine) Confirm(ctx context.Context, number uint64) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := e.store.ConfirmBlocks(context.WithoutCancel(ctx), number); err != nil {
+		return 0, err
+	}
+	promoted := e.confirmLocked(number)
+	e.fanoutLocked(ctx, model.Update{Kind: model.UpdateConfirm, BlockNumber: number})
+	return promoted, nil
+}
+
+func (e *Engine) confirmLocked(number uint64) int {
+	if number > e.head {
+		e.head = number
+	}
+	return e.promoteLocked(number, unixMin(e.clock.Now().UTC()))
+}
+
+// promoteLocked moves swaps of blocks up to number to the confirmed view
+func (e *Engine) promoteLocked(number uint64, nowMin int64) int {
+	promoted := 0
+	for block, swaps := range e.blocks {
+		if block > number {
+			continue
+		}
+		for _, swap := range swaps {
+			s, ok := e.series[swap.Token]
+			if !ok {
+				continue
+			}
+			e.advanceTo(s, nowMin)
+			if idx, ok := s.index(swap.Minute); ok {
+				addSwap(&s.Confirmed[idx], swap.USD, swap.Quantity)
+				e.pub.markDirty(swap.Token, model.ViewConfirmed)
+			}
+			promoted++
+		}
+		delete(e.blocks, block)
+	}
+	if number > e.final {
+		e.final = number
+	}
+	return promoted
+}
+
+// forgetLocked drops retracted swaps of a pending block, empty hash drops the whole block
+func (e *Engine) forgetLocked(number uint64, hash string) {
+	if hash == "" {
+		delete(e.blocks, number)
+		return
+	}
+	kept := e.blocks[number][:0]
+	for _, swap := range e.blocks[number] {
+		if swap.BlockHash != hash {
+			kept = append(kept, swap)
+		}
+	}
+	if len(kept) == 0 {
+		delete(e.blocks, number)
+		return
+	}
+	e.blocks[number] = kept
+}
+
+// loadBlocksLocked restores pending blocks after Load, which put every swap into the confirmed view
+func (e *Engine) loadBlocksLocked(blocks map[uint64][]model.BlockSwap, nowMin int64) {
+	e.blocks = make(map[uint64][]model.BlockSwap)
+	e.head, e.final = 0, 0
+	for number := range blocks {
+		e.head = max(e.head, number)
+	}
+	if e.head >= e.confirmations {
+		e.final = e.head - e.confirmations
+	}
+	for number, swaps := range blocks {
+		if number <= e.final {
+			continue
+		}
+		e.blocks[number] = swaps
+		for _, swap := range swaps {
+			s, ok := e.series[swap.Token]
+			if !ok {
+				continue
+			}
+			e.advanceTo(s, nowMin)
+			if idx, ok := s.index(swap.Minute); ok {
+				subSwap(&s.Confirmed[idx], swap)
+			}
+		}
+	}
+}
+
+func addSwap(b *model.Bucket, usd, quantity float64) {
+	b.Count++
+	b.USD += usd
+	b.Quantity += quantity
+}
+
+func subSwap(b *model.Bucket, swap model.BlockSwap) {
+	if b.Count > 0 {
+		b.Count--
+	}
+	b.USD -= swap.USD
+	b.Quantity -= swap.Quantity
+}
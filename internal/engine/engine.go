@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,10 +10,10 @@ import (
 	"sync"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/clock"
 	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
 	"Dexcelerate_swap_stats/internal/webSocket"
-
-	"github.com/gorilla/websocket"
 )
 
 const (
@@ -21,18 +22,56 @@ const (
 
 // StorageInterface определяет интерфейс для storage
 type StorageInterface interface {
-	ApplyEvent(ev model.SwapEvent) (bool, error)
-	LoadAllSeries() (map[string]map[string]string, error)
-	GetLastEventID() (string, error)
+	ApplyEvent(ctx context.Context, ev model.SwapEvent) (bool, error)
+	LoadAllSeries(ctx context.Context) (map[string]map[string]string, error)
+	LoadSeries(ctx context.Context, token string) (map[string]string, error)
+	GetLastEventID(ctx context.Context) (string, error)
 	GetEventCounter() int64
 	SetEventCounter(counter int64)
+	Checkpoint(ctx context.Context) error
+	RetractBlock(ctx context.Context, number uint64, hash string) ([]model.BlockSwap, error)
+	LoadPendingBlocks(ctx context.Context) (map[uint64][]model.BlockSwap, error)
+	LastUpdateID(ctx context.Context) (string, error)
+	ReplaceRange(ctx context.Context, token string, from, to int64, buckets []model.MinuteBucket, dedupeKeys []string) error
+	ConfirmBlocks(ctx context.Context, number uint64) error
 }
 
-// bucket for 24 hours for each minute
+// bucket for 24 hours for each minute,
+// Buckets is the pending view with every swap, Confirmed only has final ones
 type series struct {
 	Token       string
 	StartMinute int64
 	Buckets     []model.Bucket
+	Confirmed   []model.Bucket
+}
+
+// Broadcaster pushes stats to subscribers, implemented by webSocket.Hub
+type Broadcaster interface {
+	Broadcast(ctx context.Context, token string, st model.Stats)
+}
+
+// DeadLetterSink receives events which were rejected by validation
+// or failed to be stored, with the reason
+type DeadLetterSink interface {
+	Reject(ev model.SwapEvent, reason error)
+	Fail(ev model.SwapEvent, err error)
+}
+
+// BlockFanout tells other writers about retractions and confirmations,
+// swaps of a block may belong to tokens owned by another cluster member
+type BlockFanout interface {
+	Publish(ctx context.Context, u model.Update) error
+}
+
+// logDeadLetter is the default sink, events are only logged
+type logDeadLetter struct{}
+
+func (logDeadLetter) Reject(ev model.SwapEvent, reason error) {
+	log.Printf("[dead-letter] Rejected event %q: %v", ev.EventID, reason)
+}
+
+func (logDeadLetter) Fail(ev model.SwapEvent, err error) {
+	log.Printf("[dead-letter] Failed event %q: %v", ev.EventID, err)
 }
 
 // Engine is an in-memory store for fast answer and webSocket push
@@ -41,39 +80,127 @@ type Engine struct {
 	mu     sync.Mutex
 	series map[string]*series
 
-	store StorageInterface // Используем интерфейс вместо конкретного типа
-	wsHub *webSocket.Hub
+	store      StorageInterface // Используем интерфейс вместо конкретного типа
+	clock      clock.Clock
+	wsHub      Broadcaster
+	pub        *publisher
+	validator  *validation.Validator
+	deadLetter DeadLetterSink
+	fanout     BlockFanout // nil without cluster
+	stop       chan struct{}
+	stopOnce   sync.Once
+
+	// swaps of blocks which are not final yet, see confirm.go
+	confirmations uint64
+	head          uint64 // highest block seen
+	final         uint64 // blocks up to this one are in the confirmed view
+	blocks        map[uint64][]model.BlockSwap
+}
+
+type Option func(*Engine)
+
+// WithFlushInterval sets how often coalesced updates of a token are pushed
+func WithFlushInterval(d time.Duration) Option {
+	return func(e *Engine) {
+		if d > 0 {
+			e.pub = newPublisher(d)
+		}
+	}
 }
 
 type EngineInterface interface {
 	Stats(token string, now time.Time) model.Stats
-	Load() error
-	Apply(ev model.SwapEvent) (bool, error)
-	StartPeriodicUpdates()
+	StatsView(token string, view model.View, now time.Time) model.Stats
+	Load(ctx context.Context) error
+	Apply(ctx context.Context, ev model.SwapEvent) (bool, error)
+	Retract(ctx context.Context, r model.Retraction) (int, error)
+	Confirm(ctx context.Context, block uint64) (int, error)
+	StartPeriodicUpdates(ctx context.Context)
 }
 
-func NewEngine(store StorageInterface, wsHub *webSocket.Hub) *Engine {
-	return &Engine{
-		series: make(map[string]*series),
-		store:  store,
-		wsHub:  wsHub,
+// WithBlockFanout publishes every retraction and confirmation to the other writers
+func WithBlockFanout(f BlockFanout) Option {
+	return func(e *Engine) { e.fanout = f }
+}
+
+// WithClock replaces the system clock, tests and simulations move time by hand
+func WithClock(c clock.Clock) Option {
+	return func(e *Engine) {
+		if c != nil {
+			e.clock = c
+		}
+	}
+}
+
+// WithConfirmations sets how many blocks a swap waits before it enters the confirmed view
+func WithConfirmations(n uint64) Option {
+	return func(e *Engine) { e.confirmations = n }
+}
+
+// WithValidator replaces default validator which checks only event structure
+func WithValidator(v *validation.Validator) Option {
+	return func(e *Engine) {
+		if v != nil {
+			e.validator = v
+		}
+	}
+}
+
+// WithDeadLetter sets where rejected and failed events go instead of the log
+func WithDeadLetter(sink DeadLetterSink) Option {
+	return func(e *Engine) {
+		if sink != nil {
+			e.deadLetter = sink
+		}
+	}
+}
+
+func NewEngine(store StorageInterface, wsHub Broadcaster, opts ...Option) *Engine {
+	e := &Engine{
+		series:     make(map[string]*series),
+		store:      store,
+		clock:      clock.Real(),
+		wsHub:      wsHub,
+		pub:        newPublisher(defaultFlushInterval),
+		validator:  validation.New(validation.Rules{}),
+		deadLetter: logDeadLetter{},
+		stop:       make(chan struct{}),
+
+		confirmations: defaultConfirmations,
+		blocks:        make(map[uint64][]model.BlockSwap),
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
+// Now returns the time of the engine clock
+func (e *Engine) Now() time.Time { return e.clock.Now() }
+
 func unixMin(t time.Time) int64 { return t.UTC().Unix() / 60 }
 
+// Stats returns the pending view with every applied swap
 func (e *Engine) Stats(token string, now time.Time) model.Stats {
+	return e.StatsView(token, model.ViewPending, now)
+}
+
+func (e *Engine) StatsView(token string, view model.View, now time.Time) model.Stats {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	s, ok := e.series[token]
 	if !ok { //if no information about token return empty
-		return model.Stats{Token: token, UpdatedAt: time.Now()}
+		return model.Stats{Token: token, View: view, UpdatedAt: e.clock.Now()}
 	}
 
 	nowMin := unixMin(now)
 	e.advanceTo(s, nowMin) //ensure we have fresh stats
 
+	buckets := s.Buckets
+	if view == model.ViewConfirmed {
+		buckets = s.Confirmed
+	}
 	sumRange := func(minutes int64) model.Bucket {
 		from := nowMin - minutes + 1
 		if from < s.StartMinute {
@@ -84,9 +211,9 @@ func (e *Engine) Stats(token string, now time.Time) model.Stats {
 
 		for m := from; m <= nowMin; m++ {
 			idx = int(m-s.StartMinute) % windowMinutes
-			bucket.Count += s.Buckets[idx].Count
-			bucket.USD += s.Buckets[idx].USD
-			bucket.Quantity += s.Buckets[idx].Quantity
+			bucket.Count += buckets[idx].Count
+			bucket.USD += buckets[idx].USD
+			bucket.Quantity += buckets[idx].Quantity
 		}
 
 		return bucket
@@ -97,22 +224,73 @@ func (e *Engine) Stats(token string, now time.Time) model.Stats {
 		BucketMinutes5: sumRange(5),
 		BucketHours1:   sumRange(60),
 		BucketHours24:  sumRange(windowMinutes),
-		UpdatedAt:      time.Now(),
+		View:           view,
+		UpdatedAt:      e.clock.Now(),
 	}
 }
 
-func (e *Engine) StartPeriodicUpdates() {
-	ticker := time.NewTicker(time.Minute)
+// StartPeriodicUpdates pushes all tokens every minute and flushes coalesced updates
+// until StopPeriodicUpdates or ctx is done, pushes are made with ctx
+func (e *Engine) StartPeriodicUpdates(ctx context.Context) {
+	ticker := e.clock.NewTicker(time.Minute)
 	go func() {
 		defer ticker.Stop()
 		for {
-			<-ticker.C
-			e.broadcastAllStats()
+			select {
+			case <-e.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				e.broadcastAllStats(ctx)
+			}
 		}
 	}()
+
+	flush := e.clock.NewTicker(e.pub.interval)
+	go func() {
+		defer flush.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-flush.C():
+				e.flushDirty(ctx)
+			}
+		}
+	}()
+}
+
+// StopPeriodicUpdates stops pushes and flushes pending ones, so the last state
+// reaches fanout and clients still connected, ctx bounds the last flush
+func (e *Engine) StopPeriodicUpdates(ctx context.Context) {
+	e.stopOnce.Do(func() { close(e.stop) })
+	e.flushDirty(ctx)
 }
 
-func (e *Engine) broadcastAllStats() {
+// Checkpoint persists id of the last applied event, it is saved periodically
+// while applying and must be called once more before exit
+func (e *Engine) Checkpoint(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.store.Checkpoint(ctx)
+}
+
+// flushDirty broadcasts stats for token views changed since the last flush
+func (e *Engine) flushDirty(ctx context.Context) {
+	topics := e.pub.take()
+	if len(topics) == 0 {
+		return
+	}
+	now := e.clock.Now()
+	for _, t := range topics {
+		e.wsHub.Broadcast(ctx, t.token, e.StatsView(t.token, t.view, now))
+	}
+}
+
+func (e *Engine) broadcastAllStats(ctx context.Context) {
 	e.mu.Lock()
 	tokens := make([]string, 0, len(e.series))
 	for token := range e.series {
@@ -120,22 +298,23 @@ func (e *Engine) broadcastAllStats() {
 	}
 	e.mu.Unlock()
 
-	now := time.Now()
+	now := e.clock.Now()
 	for _, token := range tokens {
-		stats := e.Stats(token, now)
-		e.wsHub.Broadcast(token, stats)
+		for _, view := range []model.View{model.ViewPending, model.ViewConfirmed} {
+			e.wsHub.Broadcast(ctx, token, e.StatsView(token, view, now))
+		}
 	}
 }
 
 // load returns data from redis to in-memory store if application restarted
-func (e *Engine) Load() error {
-	all, err := e.store.LoadAllSeries()
+func (e *Engine) Load(ctx context.Context) error {
+	all, err := e.store.LoadAllSeries(ctx)
 	if err != nil {
 		return err
 	}
 
 	// trying to recover lastEventId
-	lastEventID, err := e.store.GetLastEventID()
+	lastEventID, err := e.store.GetLastEventID(ctx)
 	if err != nil {
 		log.Printf("[load] Warning: Failed to load lastEventID: %v", err)
 	} else if lastEventID != "" {
@@ -144,73 +323,111 @@ func (e *Engine) Load() error {
 
 	log.Printf("[load] Loading data for %d tokens from Redis", len(all))
 
-	nowMin := unixMin(time.Now().UTC())
+	// swaps of recent blocks stay out of the confirmed view until they are final
+	blocks, err := e.store.LoadPendingBlocks(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[load] Warning: Failed to load pending blocks, all swaps are confirmed: %v", err)
+		blocks = nil
+	}
+	e.Reset(all, blocks)
+	log.Printf("[load] Successfully loaded %d token series", len(all))
+	return nil
+}
+
+// Reset replaces the whole state with raw redis series and swaps of not final blocks
+func (e *Engine) Reset(all map[string]map[string]string, blocks map[uint64][]model.BlockSwap) {
+	nowMin := unixMin(e.clock.Now().UTC())
 	start := nowMin - int64(windowMinutes) + 1
-	end := nowMin
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	e.series = make(map[string]*series, len(all))
-
 	for token, fields := range all {
-		s := &series{
-			StartMinute: start,
-			Buckets:     make([]model.Bucket, windowMinutes),
+		e.series[token] = parseSeries(token, fields, start, nowMin)
+	}
+	e.loadBlocksLocked(blocks, nowMin)
+}
+
+// parseSeries builds series of the window [start..end] from redis hash fields,
+// every swap is in the confirmed view until pending blocks are subtracted
+func parseSeries(token string, fields map[string]string, start, end int64) *series {
+	s := &series{
+		Token:       token,
+		StartMinute: start,
+		Buckets:     make([]model.Bucket, windowMinutes),
+	}
+
+	for fname, raw := range fields {
+		// data format: "<minute>#<kind>",  kind ∈ {c,u,q}
+		parts := strings.Split(fname, "#")
+		if len(parts) != 2 {
+			continue
 		}
+		minute, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		kind := parts[1]
 
-		for fname, raw := range fields {
-			// data format: "<minute>#<kind>",  kind ∈ {c,u,q}
-			parts := strings.Split(fname, "#")
-			if len(parts) != 2 {
-				continue
-			}
-			minute, err := strconv.ParseInt(parts[0], 10, 64)
-			if err != nil {
-				continue
-			}
-			kind := parts[1]
+		// ignore all not in our window [start..end]
+		if minute < start || minute > end {
+			continue
+		}
 
-			// ignore all not in our window [start..end]
-			if minute < start || minute > end {
-				continue
-			}
+		idx := int(minute - s.StartMinute)
+		if idx < 0 || idx >= windowMinutes {
+			continue
+		}
 
-			idx := int(minute - s.StartMinute)
-			if idx < 0 || idx >= windowMinutes {
-				continue
+		switch kind {
+		case "c":
+			if v, err := strconv.ParseUint(raw, 10, 64); err == nil {
+				s.Buckets[idx].Count = v
 			}
-
-			switch kind {
-			case "c":
-				if v, err := strconv.ParseUint(raw, 10, 64); err == nil {
-					s.Buckets[idx].Count = v
-				}
-			case "u":
-				if v, err := strconv.ParseFloat(raw, 64); err == nil {
-					s.Buckets[idx].USD = v
-				}
-			case "q":
-				if v, err := strconv.ParseFloat(raw, 64); err == nil {
-					s.Buckets[idx].Quantity = v
-				}
+		case "u":
+			if v, err := strconv.ParseFloat(raw, 64); err == nil {
+				s.Buckets[idx].USD = v
+			}
+		case "q":
+			if v, err := strconv.ParseFloat(raw, 64); err == nil {
+				s.Buckets[idx].Quantity = v
 			}
 		}
-
-		e.series[token] = s
 	}
-	log.Printf("[load] Successfully loaded %d token series", len(e.series))
 
-	return nil
+	s.Confirmed = append([]model.Bucket(nil), s.Buckets...)
+	return s
 }
 
 // apply event to in-memory store and redis
-// returns true if event applied and not duplicated
-func (e *Engine) Apply(ev model.SwapEvent) (bool, error) {
+// returns true if event applied and not duplicated,
+// invalid events are sent to dead-letter sink and returned as *validation.Error,
+// events which storage failed to apply are dead-lettered too.
+// A cancelled ctx stops the event before it is written, once written it is applied to memory as well.
+func (e *Engine) Apply(ctx context.Context, ev model.SwapEvent) (bool, error) {
+	if err := e.validator.Validate(ev); err != nil {
+		e.deadLetter.Reject(ev, err)
+		return false, err
+	}
+
+	// the dead-letter sink may write to redis, it is called once the lock is released
+	var storeErr error
+	defer func() {
+		if storeErr != nil {
+			e.deadLetter.Fail(ev, storeErr)
+		}
+	}()
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
-	now := time.Now().UTC()
+	now := e.clock.Now().UTC()
 	nowMin := unixMin(now)
 
 	evMin := unixMin(ev.ExecutedAt.UTC())
@@ -218,8 +435,10 @@ func (e *Engine) Apply(ev model.SwapEvent) (bool, error) {
 		evMin = nowMin
 	}
 
-	applied, err := e.store.ApplyEvent(ev) // apply event atomically to redis
+	// apply event atomically to redis, memory must follow it even if the caller is gone
+	applied, err := e.store.ApplyEvent(context.WithoutCancel(ctx), ev)
 	if err != nil {
+		storeErr = err
 		return false, err
 	}
 	if !applied {
@@ -244,15 +463,70 @@ func (e *Engine) Apply(ev model.SwapEvent) (bool, error) {
 	s.Buckets[idx].Count++
 	s.Buckets[idx].USD += ev.USD
 	s.Buckets[idx].Quantity += ev.Amount
+	e.trackLocked(s, ev, evMin, nowMin)
 
-	// Broadcast updated stats via webSocket
-	go func() {
-		st := e.Stats(ev.TokenID, time.Now())
-		e.wsHub.Broadcast(ev.TokenID, st)
-	}()
+	// webSocket push is coalesced and sent by flushDirty
+	e.pub.markDirty(ev.TokenID, model.ViewPending)
 	return true, nil
 }
 
+// Retract subtracts swaps of an orphaned block from storage and memory,
+// returns how many swaps were retracted.
+// The engine lock is held across both, so no reader sees storage and memory disagree.
+func (e *Engine) Retract(ctx context.Context, r model.Retraction) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	swaps, err := e.store.RetractBlock(context.WithoutCancel(ctx), r.BlockNumber, r.BlockHash)
+	if err != nil {
+		return 0, err
+	}
+	e.retractLocked(r, swaps)
+	e.fanoutLocked(ctx, model.Update{Kind: model.UpdateRetract, BlockNumber: r.BlockNumber, BlockHash: r.BlockHash, Swaps: swaps})
+	return len(swaps), nil
+}
+
+// fanoutLocked publishes a retraction or confirmation already in storage,
+// a failure is only logged because this instance can't undo the storage change
+func (e *Engine) fanoutLocked(ctx context.Context, u model.Update) {
+	if e.fanout == nil {
+		return
+	}
+	if err := e.fanout.Publish(context.WithoutCancel(ctx), u); err != nil {
+		log.Printf("[error] Failed to publish %s of block %d to the cluster: %v", u.Kind, u.BlockNumber, err)
+	}
+}
+
+// retractLocked subtracts swaps retracted from storage
+func (e *Engine) retractLocked(r model.Retraction, swaps []model.BlockSwap) {
+	nowMin := unixMin(e.clock.Now().UTC())
+	confirmed := r.BlockNumber <= e.final
+	if confirmed && len(swaps) > 0 {
+		log.Printf("[warning] Retracting block %d which is already confirmed", r.BlockNumber)
+	}
+	for _, swap := range swaps {
+		s, ok := e.series[swap.Token]
+		if !ok {
+			continue
+		}
+		e.advanceTo(s, nowMin)
+		idx, ok := s.index(swap.Minute)
+		if !ok {
+			continue // already out of window
+		}
+		subSwap(&s.Buckets[idx], swap)
+		e.pub.markDirty(swap.Token, model.ViewPending)
+		if confirmed {
+			subSwap(&s.Confirmed[idx], swap)
+			e.pub.markDirty(swap.Token, model.ViewConfirmed)
+		}
+	}
+	e.forgetLocked(r.BlockNumber, r.BlockHash)
+}
+
 func (e *Engine) ensureSeries(token string, now time.Time) *series {
 	if s, ok := e.series[token]; ok {
 		return s
@@ -261,6 +535,7 @@ func (e *Engine) ensureSeries(token string, now time.Time) *series {
 		Token:       token,
 		StartMinute: unixMin(now) - windowMinutes + 1,
 		Buckets:     make([]model.Bucket, windowMinutes),
+		Confirmed:   make([]model.Bucket, windowMinutes),
 	}
 	e.series[token] = s
 	return s
@@ -273,22 +548,31 @@ func (e *Engine) advanceTo(s *series, nowMin int64) {
 	}
 	steps := nowMin - curEnd
 	if steps >= windowMinutes {
-		for i := range s.Buckets {
-			s.Buckets[i] = model.Bucket{}
-		}
+		clear(s.Buckets)
+		clear(s.Confirmed)
 		s.StartMinute = nowMin - windowMinutes + 1
 		return
 	}
 
 	if steps >= 0 {
-		copy(s.Buckets, s.Buckets[steps:])
-		for i := windowMinutes - steps; i < windowMinutes; i++ {
-			s.Buckets[i] = model.Bucket{}
-		}
+		shiftBuckets(s.Buckets, steps)
+		shiftBuckets(s.Confirmed, steps)
 	}
 	s.StartMinute += steps
 }
 
+// shiftBuckets drops the oldest steps buckets and zeroes the newest ones
+func shiftBuckets(b []model.Bucket, steps int64) {
+	copy(b, b[steps:])
+	clear(b[int64(len(b))-steps:])
+}
+
+// index returns position of minute in the window
+func (s *series) index(minute int64) (int, bool) {
+	idx := int(minute - s.StartMinute)
+	return idx, idx >= 0 && idx < len(s.Buckets)
+}
+
 func ServeWS(h *webSocket.Hub, eng *Engine) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.URL.Query().Get("token")
@@ -296,44 +580,26 @@ func ServeWS(h *webSocket.Hub, eng *Engine) http.Handler {
 			http.Error(w, "token required", http.StatusBadRequest)
 			return
 		}
-		conn, err := h.Upgrader.Upgrade(w, r, nil)
+		view, err := model.ParseView(r.URL.Query().Get("view"))
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		h.Mu.Lock()
-		set := h.Subs[token]
-		if set == nil {
-			set = make(map[*websocket.Conn]struct{})
-			h.Subs[token] = set
-		}
-		set[conn] = struct{}{}
-		h.Mu.Unlock()
-
-		// initial snapshot
-		_ = conn.WriteJSON(eng.Stats(token, time.Now()))
-
-		// reader to detect close
-		go func(c *websocket.Conn) {
-			defer func() { h.DeadCh <- c }()
-			c.SetReadLimit(512)
-			err := c.SetReadDeadline(time.Now().Add(60 * time.Second))
+		// since=<seq>&epoch=<epoch> resumes after the last seq seen by the client
+		var since uint64
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			v, err := strconv.ParseUint(raw, 10, 64)
 			if err != nil {
-				log.Println("[error] Failed to set read deadline:", err)
+				http.Error(w, "invalid since", http.StatusBadRequest)
 				return
 			}
-			c.SetPongHandler(func(string) error {
-				err = c.SetReadDeadline(time.Now().Add(60 * time.Second))
-				if err != nil {
-					log.Println("[error] Failed to set read deadline:", err)
-					return err
-				}
-				return nil
-			})
-			for {
-				if _, _, err := c.ReadMessage(); err != nil {
-					return
-				}
-			}
-		}(conn)
+			since = v
+		}
+		conn, err := h.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		epoch := r.URL.Query().Get("epoch")
+		h.Subscribe(h.NewClient(conn), token, epoch, since, eng.StatsView(token, view, eng.Now()))
 	})
 }
@@ -1,10 +1,16 @@
 package engine
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/clock"
 	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
 	"Dexcelerate_swap_stats/internal/webSocket"
 
 	_ "github.com/redis/go-redis/v9"
@@ -16,21 +22,36 @@ type mockStorage struct {
 	lastEvent string
 	counter   int64
 	series    map[string]map[string]string
+	applyErr  error
+	loadErr   error
+	blocks    map[uint64][]model.SwapEvent
+
+	checkpoints int
+	lastUpdate  string
+	confirmed   uint64
+	replaced    map[string][]model.MinuteBucket // token -> buckets of the last ReplaceRange
 }
 
 func newMockStorage() *mockStorage {
 	return &mockStorage{
 		events: make(map[string]bool),
 		series: make(map[string]map[string]string),
+		blocks: make(map[uint64][]model.SwapEvent),
 	}
 }
 
-func (m *mockStorage) ApplyEvent(ev model.SwapEvent) (bool, error) {
+func (m *mockStorage) ApplyEvent(_ context.Context, ev model.SwapEvent) (bool, error) {
+	if m.applyErr != nil {
+		return false, m.applyErr
+	}
 	if m.events[ev.EventID] {
 		return false, nil // duplicate
 	}
 	m.events[ev.EventID] = true
 	m.counter++
+	if ev.BlockNumber > 0 {
+		m.blocks[ev.BlockNumber] = append(m.blocks[ev.BlockNumber], ev)
+	}
 
 	// Simulate storing in series format
 	token := ev.TokenID
@@ -48,14 +69,47 @@ func (m *mockStorage) ApplyEvent(ev model.SwapEvent) (bool, error) {
 	return true, nil
 }
 
-func (m *mockStorage) LoadAllSeries() (map[string]map[string]string, error) {
+func (m *mockStorage) LoadAllSeries(context.Context) (map[string]map[string]string, error) {
 	return m.series, nil
 }
 
-func (m *mockStorage) GetLastEventID() (string, error) {
+func (m *mockStorage) LoadSeries(_ context.Context, token string) (map[string]string, error) {
+	return m.series[token], m.loadErr
+}
+
+func (m *mockStorage) GetLastEventID(context.Context) (string, error) {
 	return m.lastEvent, nil
 }
 
+func (m *mockStorage) Checkpoint(context.Context) error {
+	m.checkpoints++
+	return nil
+}
+
+func (m *mockStorage) LastUpdateID(context.Context) (string, error) {
+	return m.lastUpdate, nil
+}
+
+func (m *mockStorage) ReplaceRange(_ context.Context, token string, from, to int64, buckets []model.MinuteBucket, _ []string) error {
+	if m.applyErr != nil {
+		return m.applyErr
+	}
+	if m.replaced == nil {
+		m.replaced = make(map[string][]model.MinuteBucket)
+	}
+	m.replaced[token] = buckets
+	for number, events := range m.blocks {
+		var kept []model.SwapEvent
+		for _, ev := range events {
+			if minute := unixMin(ev.ExecutedAt.UTC()); ev.TokenID != token || minute < from || minute >= to {
+				kept = append(kept, ev)
+			}
+		}
+		m.blocks[number] = kept
+	}
+	return nil
+}
+
 func (m *mockStorage) GetEventCounter() int64 {
 	return m.counter
 }
@@ -64,6 +118,49 @@ func (m *mockStorage) SetEventCounter(counter int64) {
 	m.counter = counter
 }
 
+func (m *mockStorage) LoadPendingBlocks(context.Context) (map[uint64][]model.BlockSwap, error) {
+	out := make(map[uint64][]model.BlockSwap)
+	for number, events := range m.blocks {
+		for _, ev := range events {
+			out[number] = append(out[number], blockSwap(ev))
+		}
+	}
+	return out, nil
+}
+
+func blockSwap(ev model.SwapEvent) model.BlockSwap {
+	return model.BlockSwap{
+		Token:     ev.TokenID,
+		Minute:    ev.ExecutedAt.UTC().Unix() / 60,
+		USD:       ev.USD,
+		Quantity:  ev.Amount,
+		BlockHash: ev.BlockHash,
+	}
+}
+
+func (m *mockStorage) RetractBlock(_ context.Context, number uint64, hash string) ([]model.BlockSwap, error) {
+	var out []model.BlockSwap
+	var kept []model.SwapEvent
+	for _, ev := range m.blocks[number] {
+		if hash != "" && ev.BlockHash != hash {
+			kept = append(kept, ev)
+			continue
+		}
+		delete(m.events, ev.EventID)
+		out = append(out, blockSwap(ev))
+	}
+	m.blocks[number] = kept
+	return out, nil
+}
+
+func (m *mockStorage) ConfirmBlocks(_ context.Context, number uint64) error {
+	if m.applyErr != nil {
+		return m.applyErr
+	}
+	m.confirmed = number
+	return nil
+}
+
 func TestNewEngine(t *testing.T) {
 	store := newMockStorage()
 	hub := webSocket.NewHub()
@@ -124,7 +221,7 @@ func TestEngineApplyEvent(t *testing.T) {
 		ExecutedAt: now,
 	}
 
-	applied, err := engine.Apply(event)
+	applied, err := engine.Apply(context.Background(), event)
 
 	if err != nil {
 		t.Fatalf("Apply() returned error: %v", err)
@@ -135,7 +232,7 @@ func TestEngineApplyEvent(t *testing.T) {
 	}
 
 	// Test duplicate
-	applied, err = engine.Apply(event)
+	applied, err = engine.Apply(context.Background(), event)
 
 	if err != nil {
 		t.Fatalf("Apply() returned error on duplicate: %v", err)
@@ -163,7 +260,7 @@ func TestEngineApplyAndStats(t *testing.T) {
 		ExecutedAt: now,
 	}
 
-	applied, err := engine.Apply(event)
+	applied, err := engine.Apply(context.Background(), event)
 	if err != nil {
 		t.Fatalf("Apply() returned error: %v", err)
 	}
@@ -229,7 +326,7 @@ func TestEngineMultipleEvents(t *testing.T) {
 	}
 
 	for _, event := range events {
-		applied, err := engine.Apply(event)
+		applied, err := engine.Apply(context.Background(), event)
 		if err != nil {
 			t.Fatalf("Apply() returned error for %s: %v", event.EventID, err)
 		}
@@ -277,7 +374,7 @@ func TestEngineOldEvent(t *testing.T) {
 		ExecutedAt: now.Add(-25 * time.Hour), // Too old (>24h)
 	}
 
-	applied, err := engine.Apply(oldEvent)
+	applied, err := engine.Apply(context.Background(), oldEvent)
 
 	// Should return error for events older than 24 hours
 	if err == nil {
@@ -301,7 +398,7 @@ func TestEngineLoad(t *testing.T) {
 		"1000#q": "10.0",
 	}
 
-	err := engine.Load()
+	err := engine.Load(context.Background())
 	if err != nil {
 		t.Fatalf("Load() returned error: %v", err)
 	}
@@ -366,7 +463,7 @@ func BenchmarkEngineApply(b *testing.B) {
 			ExecutedAt: now,
 		}
 
-		_, _ = engine.Apply(event)
+		_, _ = engine.Apply(context.Background(), event)
 	}
 }
 
@@ -387,7 +484,7 @@ func BenchmarkEngineStats(b *testing.B) {
 			Rate:       50000.0,
 			ExecutedAt: now,
 		}
-		_, _ = engine.Apply(event)
+		_, _ = engine.Apply(context.Background(), event)
 	}
 
 	b.ResetTimer()
@@ -395,3 +492,525 @@ func BenchmarkEngineStats(b *testing.B) {
 		_ = engine.Stats("BTC", now)
 	}
 }
+
+// recordingBroadcaster remembers every pushed stats
+type recordingBroadcaster struct {
+	mu   sync.Mutex
+	sent []model.Stats
+}
+
+func (r *recordingBroadcaster) Broadcast(_ context.Context, _ string, st model.Stats) {
+	r.mu.Lock()
+	r.sent = append(r.sent, st)
+	r.mu.Unlock()
+}
+
+func (r *recordingBroadcaster) snapshot() []model.Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]model.Stats(nil), r.sent...)
+}
+
+func TestEngineCoalescesBroadcasts(t *testing.T) {
+	store := newMockStorage()
+	rec := &recordingBroadcaster{}
+	engine := NewEngine(store, rec)
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		_, err := engine.Apply(context.Background(), model.SwapEvent{
+			EventID:    "event-" + strconv.Itoa(i),
+			TokenID:    "BTC",
+			Amount:     1.0,
+			USD:        10.0,
+			Side:       model.Buy,
+			ExecutedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("Apply() returned error: %v", err)
+		}
+	}
+
+	if got := len(rec.snapshot()); got != 0 {
+		t.Fatalf("Expected no broadcasts before flush, got %d", got)
+	}
+
+	// swaps without a block are final, so both views changed
+	engine.flushDirty(context.Background())
+	sent := rec.snapshot()
+	if len(sent) != 2 {
+		t.Fatalf("Expected 1 coalesced broadcast per view, got %d", len(sent))
+	}
+	views := make(map[model.View]bool)
+	for _, st := range sent {
+		views[st.View] = true
+		if st.BucketMinutes5.Count != 100 {
+			t.Errorf("Expected final %s state with 100 transactions, got %d", st.View, st.BucketMinutes5.Count)
+		}
+	}
+	if !views[model.ViewPending] || !views[model.ViewConfirmed] {
+		t.Errorf("Expected pending and confirmed broadcasts, got %v", views)
+	}
+
+	engine.flushDirty(context.Background())
+	if got := len(rec.snapshot()); got != 2 {
+		t.Errorf("Expected no broadcast for clean token, got %d total", got)
+	}
+}
+
+func TestEnginePeriodicFlushDeliversFinalState(t *testing.T) {
+	store := newMockStorage()
+	rec := &recordingBroadcaster{}
+	engine := NewEngine(store, rec, WithFlushInterval(10*time.Millisecond))
+	engine.StartPeriodicUpdates(context.Background())
+
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		_, _ = engine.Apply(context.Background(), model.SwapEvent{
+			EventID:    "event-" + strconv.Itoa(i),
+			TokenID:    "ETH",
+			Amount:     1.0,
+			USD:        10.0,
+			Side:       model.Buy,
+			ExecutedAt: now,
+		})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sent := rec.snapshot()
+		if len(sent) > 0 && sent[len(sent)-1].BucketMinutes5.Count == 50 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Expected final state to be broadcast")
+}
+
+// recordingDeadLetter remembers rejected and failed events
+type recordingDeadLetter struct {
+	events  []model.SwapEvent
+	reasons []error
+	failed  []model.SwapEvent
+	onFail  func()
+}
+
+func (r *recordingDeadLetter) Fail(ev model.SwapEvent, err error) {
+	if r.onFail != nil {
+		r.onFail()
+	}
+	r.failed = append(r.failed, ev)
+}
+
+func (r *recordingDeadLetter) Reject(ev model.SwapEvent, reason error) {
+	r.events = append(r.events, ev)
+	r.reasons = append(r.reasons, reason)
+}
+
+func TestEngineRejectsInvalidEvent(t *testing.T) {
+	store := newMockStorage()
+	dl := &recordingDeadLetter{}
+	engine := NewEngine(store, webSocket.NewHub(),
+		WithValidator(validation.New(validation.Rules{AllowedTokens: []string{"BTC"}})),
+		WithDeadLetter(dl),
+	)
+
+	events := []model.SwapEvent{
+		{EventID: "", TokenID: "BTC", Side: model.Buy, ExecutedAt: time.Now()},
+		{EventID: "ev-1", TokenID: "DOGE", Side: model.Buy, ExecutedAt: time.Now()},
+	}
+	for _, ev := range events {
+		applied, err := engine.Apply(context.Background(), ev)
+		var verr *validation.Error
+		if !errors.As(err, &verr) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+		if applied {
+			t.Error("Expected invalid event to not be applied")
+		}
+	}
+
+	if len(dl.events) != len(events) {
+		t.Fatalf("Expected %d dead-lettered events, got %d", len(events), len(dl.events))
+	}
+	if len(store.events) != 0 {
+		t.Errorf("Expected invalid events to not reach storage, got %d", len(store.events))
+	}
+}
+
+func TestEngineDeadLettersFailedEvent(t *testing.T) {
+	store := newMockStorage()
+	store.applyErr = errors.New("redis is down")
+	dl := &recordingDeadLetter{}
+	engine := NewEngine(store, webSocket.NewHub(), WithDeadLetter(dl))
+	// the sink may be slow, it must not block other writers
+	dl.onFail = func() {
+		if !engine.mu.TryLock() {
+			t.Error("Expected dead-letter sink called without the engine lock")
+			return
+		}
+		engine.mu.Unlock()
+	}
+
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 10, Rate: 10, ExecutedAt: time.Now()}
+	if _, err := engine.Apply(context.Background(), ev); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if len(dl.failed) != 1 || dl.failed[0].EventID != "ev-1" {
+		t.Errorf("Expected ev-1 dead-lettered as failed, got %v", dl.failed)
+	}
+	if len(dl.events) != 0 {
+		t.Errorf("Expected no rejected events, got %d", len(dl.events))
+	}
+}
+
+func TestEngineApplyCancelled(t *testing.T) {
+	store := newMockStorage()
+	dl := &recordingDeadLetter{}
+	engine := NewEngine(store, webSocket.NewHub(), WithDeadLetter(dl))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 10, Rate: 10, ExecutedAt: time.Now()}
+	if _, err := engine.Apply(ctx, ev); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if len(store.events) != 0 {
+		t.Errorf("Expected cancelled event to not reach storage, got %d", len(store.events))
+	}
+	if len(dl.failed) != 0 {
+		t.Errorf("Expected cancelled event not dead-lettered, got %v", dl.failed)
+	}
+	if _, err := engine.Retract(ctx, model.Retraction{BlockNumber: 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from Retract, got %v", err)
+	}
+}
+
+func TestEngineRetract(t *testing.T) {
+	store := newMockStorage()
+	engine := NewEngine(store, webSocket.NewHub())
+	now := time.Now()
+
+	swap := func(id string, block uint64, hash string) model.SwapEvent {
+		return model.SwapEvent{EventID: id, TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 100, Rate: 100,
+			ExecutedAt: now, BlockNumber: block, BlockHash: hash}
+	}
+	for _, ev := range []model.SwapEvent{
+		swap("ev-1", 10, "0xa"),
+		swap("ev-2", 11, "0xb"),
+		swap("ev-3", 11, "0xb"),
+		swap("ev-4", 11, "0xc"), // same height on the canonical chain
+	} {
+		if _, err := engine.Apply(context.Background(), ev); err != nil {
+			t.Fatalf("Apply(%s): %v", ev.EventID, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		r         model.Retraction
+		retracted int
+		count     uint64
+		usd       float64
+	}{
+		{"orphaned hash", model.Retraction{BlockNumber: 11, BlockHash: "0xb"}, 2, 2, 200},
+		{"already retracted", model.Retraction{BlockNumber: 11, BlockHash: "0xb"}, 0, 2, 200},
+		{"unknown block", model.Retraction{BlockNumber: 99}, 0, 2, 200},
+		{"whole block", model.Retraction{BlockNumber: 10}, 1, 1, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := engine.Retract(context.Background(), tt.r)
+			if err != nil {
+				t.Fatalf("Retract: %v", err)
+			}
+			if n != tt.retracted {
+				t.Errorf("Expected %d retracted, got %d", tt.retracted, n)
+			}
+			st := engine.Stats("BTC", now)
+			if st.BucketMinutes5.Count != tt.count {
+				t.Errorf("Expected count %d, got %d", tt.count, st.BucketMinutes5.Count)
+			}
+			if st.BucketMinutes5.USD != tt.usd {
+				t.Errorf("Expected usd %v, got %v", tt.usd, st.BucketMinutes5.USD)
+			}
+		})
+	}
+
+	// retracted swap may come back with the canonical chain
+	applied, err := engine.Apply(context.Background(), swap("ev-2", 12, "0xd"))
+	if err != nil || !applied {
+		t.Errorf("Expected retracted event applied again, got %v, %v", applied, err)
+	}
+}
+
+func TestEngineConfirmedView(t *testing.T) {
+	store := newMockStorage()
+	engine := NewEngine(store, webSocket.NewHub(), WithConfirmations(2))
+	now := time.Now()
+
+	apply := func(id string, block uint64) {
+		t.Helper()
+		ev := model.SwapEvent{EventID: id, TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 10, Rate: 10,
+			ExecutedAt: now, BlockNumber: block}
+		if block > 0 {
+			ev.BlockHash = "0x" + strconv.FormatUint(block, 10)
+		}
+		if _, err := engine.Apply(context.Background(), ev); err != nil {
+			t.Fatalf("Apply(%s): %v", id, err)
+		}
+	}
+	counts := func() (pending, confirmed uint64) {
+		return engine.StatsView("BTC", model.ViewPending, now).BucketMinutes5.Count,
+			engine.StatsView("BTC", model.ViewConfirmed, now).BucketMinutes5.Count
+	}
+
+	tests := []struct {
+		name      string
+		step      func()
+		pending   uint64
+		confirmed uint64
+	}{
+		{"no block is final", func() { apply("ev-0", 0) }, 1, 1},
+		{"new block is pending", func() { apply("ev-1", 10) }, 2, 1},
+		{"one confirmation", func() { apply("ev-2", 11) }, 3, 1},
+		{"two confirmations promote", func() { apply("ev-3", 12) }, 4, 2},
+		{"late swap of final block", func() { apply("ev-4", 9) }, 5, 3},
+		{"retract pending block", func() { _, _ = engine.Retract(context.Background(), model.Retraction{BlockNumber: 12}) }, 4, 3},
+		{"explicit confirmation", func() { _, _ = engine.Confirm(context.Background(), 11) }, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.step()
+			pending, confirmed := counts()
+			if pending != tt.pending {
+				t.Errorf("Expected pending %d, got %d", tt.pending, pending)
+			}
+			if confirmed != tt.confirmed {
+				t.Errorf("Expected confirmed %d, got %d", tt.confirmed, confirmed)
+			}
+		})
+	}
+}
+
+func TestEngineLoadKeepsRecentBlocksPending(t *testing.T) {
+	store := newMockStorage()
+	writer := NewEngine(store, webSocket.NewHub(), WithConfirmations(2))
+	now := time.Now()
+	for i, block := range []uint64{0, 10, 11, 12} {
+		ev := model.SwapEvent{EventID: "ev-" + strconv.Itoa(i), TokenID: "BTC", Side: model.Buy,
+			Amount: 1, USD: 10, ExecutedAt: now, BlockNumber: block, BlockHash: "0xa"}
+		if _, err := writer.Apply(context.Background(), ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+
+	// block 10 is final for the restarted engine, 11 and 12 are not
+	engine := NewEngine(store, webSocket.NewHub(), WithConfirmations(2))
+	engine.series = map[string]*series{}
+	engine.loadBlocksLocked(mustPendingBlocks(t, store), unixMin(now))
+	if engine.head != 12 || engine.final != 10 {
+		t.Errorf("Expected head 12 and final 10, got %d and %d", engine.head, engine.final)
+	}
+	if _, ok := engine.blocks[10]; ok {
+		t.Error("Expected final block not pending")
+	}
+	if len(engine.blocks[11]) != 1 || len(engine.blocks[12]) != 1 {
+		t.Errorf("Expected blocks 11 and 12 pending, got %v", engine.blocks)
+	}
+}
+
+func mustPendingBlocks(t *testing.T, store *mockStorage) map[uint64][]model.BlockSwap {
+	t.Helper()
+	blocks, err := store.LoadPendingBlocks(context.Background())
+	if err != nil {
+		t.Fatalf("LoadPendingBlocks: %v", err)
+	}
+	return blocks
+}
+
+func TestEngineWarmAndRelease(t *testing.T) {
+	store := newMockStorage()
+	now := time.Now()
+	minute := strconv.FormatInt(unixMin(now), 10)
+	store.series["BTC"] = map[string]string{minute + "#c": "3", minute + "#u": "300", minute + "#q": "3"}
+	store.blocks[100] = []model.SwapEvent{{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 100,
+		ExecutedAt: now, BlockNumber: 100, BlockHash: "0xa"}}
+
+	engine := NewEngine(store, webSocket.NewHub())
+	if err := engine.Warm(context.Background(), []string{"BTC"}); err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	pending := engine.StatsView("BTC", model.ViewPending, now)
+	if pending.BucketMinutes5.Count != 3 || pending.BucketMinutes5.USD != 300 {
+		t.Errorf("Expected warmed pending count 3 and usd 300, got %d and %f", pending.BucketMinutes5.Count, pending.BucketMinutes5.USD)
+	}
+	confirmed := engine.StatsView("BTC", model.ViewConfirmed, now)
+	if confirmed.BucketMinutes5.Count != 2 {
+		t.Errorf("Expected swap of pending block out of confirmed view, got count %d", confirmed.BucketMinutes5.Count)
+	}
+	if len(engine.blocks[100]) != 1 {
+		t.Errorf("Expected block 100 pending, got %v", engine.blocks)
+	}
+
+	engine.Release([]string{"BTC"})
+	if _, ok := engine.series["BTC"]; ok {
+		t.Error("Expected released token dropped from memory")
+	}
+	if len(engine.blocks) != 0 {
+		t.Errorf("Expected pending swaps of released token forgotten, got %v", engine.blocks)
+	}
+}
+
+func TestEngineStopFlushesAndCheckpoints(t *testing.T) {
+	store := newMockStorage()
+	rec := &recordingBroadcaster{}
+	engine := NewEngine(store, rec, WithFlushInterval(time.Hour))
+	engine.StartPeriodicUpdates(context.Background())
+
+	_, err := engine.Apply(context.Background(), model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 10,
+		Side: model.Buy, ExecutedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	engine.StopPeriodicUpdates(context.Background())
+	if got := len(rec.snapshot()); got != 2 {
+		t.Errorf("Expected pending updates flushed on stop, got %d broadcasts", got)
+	}
+	engine.StopPeriodicUpdates(context.Background()) // safe to call twice
+
+	if err := engine.Checkpoint(context.Background()); err != nil || store.checkpoints != 1 {
+		t.Errorf("Expected checkpoint saved, got %d checkpoints and %v", store.checkpoints, err)
+	}
+}
+
+func TestEngineWindowRollover(t *testing.T) {
+	type step struct {
+		at                 time.Duration // since start
+		apply              bool
+		min5, hour1, day24 uint64
+	}
+	window := []step{
+		{at: 0, apply: true, min5: 1, hour1: 1, day24: 1},
+		{at: 4 * time.Minute, min5: 1, hour1: 1, day24: 1},
+		{at: 5 * time.Minute, min5: 0, hour1: 1, day24: 1},
+		{at: 59 * time.Minute, min5: 0, hour1: 1, day24: 1},
+		{at: time.Hour, min5: 0, hour1: 0, day24: 1},
+		{at: 24*time.Hour - time.Minute, min5: 0, hour1: 0, day24: 1},
+		// the first swap leaves the window as the second one enters the same bucket
+		{at: 24 * time.Hour, apply: true, min5: 1, hour1: 1, day24: 1},
+		{at: 72 * time.Hour, min5: 0, hour1: 0, day24: 0},
+		{at: 72 * time.Hour, apply: true, min5: 1, hour1: 1, day24: 1},
+	}
+	tests := []struct {
+		name  string
+		start time.Time
+		steps []step
+	}{
+		{"mid day", time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC), window},
+		{"before midnight", time.Date(2026, 3, 10, 23, 59, 30, 0, time.UTC), window},
+		{"new year", time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC), window},
+		{"last millisecond of a minute", time.Date(2026, 3, 10, 12, 0, 59, 999e6, time.UTC), []step{
+			{at: 0, apply: true, min5: 1, hour1: 1, day24: 1},
+			{at: 4 * time.Minute, min5: 1, hour1: 1, day24: 1},
+			// next millisecond is the next minute
+			{at: 4*time.Minute + time.Millisecond, min5: 0, hour1: 1, day24: 1},
+			{at: 24*time.Hour - time.Minute, min5: 0, hour1: 0, day24: 1},
+			{at: 24*time.Hour - time.Minute + time.Millisecond, min5: 0, hour1: 0, day24: 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(tt.start)
+			engine := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk))
+			for i, s := range tt.steps {
+				clk.Set(tt.start.Add(s.at))
+				if s.apply {
+					_, err := engine.Apply(context.Background(), model.SwapEvent{EventID: "ev-" + strconv.Itoa(i),
+						TokenID: "BTC", Amount: 1, USD: 10, Side: model.Buy, ExecutedAt: clk.Now()})
+					if err != nil {
+						t.Fatalf("step %d: Apply() returned error: %v", i, err)
+					}
+				}
+				st := engine.Stats("BTC", clk.Now())
+				if st.BucketMinutes5.Count != s.min5 || st.BucketHours1.Count != s.hour1 || st.BucketHours24.Count != s.day24 {
+					t.Errorf("step %d at %v: Expected counts 5m=%d 1h=%d 24h=%d, got %d %d %d", i, s.at,
+						s.min5, s.hour1, s.day24, st.BucketMinutes5.Count, st.BucketHours1.Count, st.BucketHours24.Count)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineRejectsEventsOutsideWindow(t *testing.T) {
+	start := time.Date(2026, 3, 10, 0, 0, 30, 0, time.UTC)
+	tests := []struct {
+		name       string
+		executedAt time.Time
+		applied    bool
+		day24      uint64
+	}{
+		{"now", start, true, 1},
+		{"first minute of the window", start.Add(-24*time.Hour + time.Minute), true, 1},
+		{"older than the window", start.Add(-24 * time.Hour), false, 0},
+		{"future event counts now", start.Add(time.Hour), true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			engine := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk))
+			applied, _ := engine.Apply(context.Background(), model.SwapEvent{EventID: "ev-1",
+				TokenID: "BTC", Amount: 1, USD: 10, Side: model.Buy, ExecutedAt: tt.executedAt})
+			if applied != tt.applied {
+				t.Errorf("Expected applied %v, got %v", tt.applied, applied)
+			}
+			if got := engine.Stats("BTC", clk.Now()).BucketHours24.Count; got != tt.day24 {
+				t.Errorf("Expected 24h count %d, got %d", tt.day24, got)
+			}
+		})
+	}
+}
+
+func TestEnginePeriodicUpdatesFollowClock(t *testing.T) {
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	rec := &recordingBroadcaster{}
+	engine := NewEngine(newMockStorage(), rec, WithClock(clk), WithFlushInterval(time.Second))
+	engine.StartPeriodicUpdates(context.Background())
+	defer engine.StopPeriodicUpdates(context.Background())
+
+	if _, err := engine.Apply(context.Background(), model.SwapEvent{EventID: "ev-1", TokenID: "BTC",
+		Amount: 1, USD: 10, Side: model.Buy, ExecutedAt: start}); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+
+	waitSent := func(n int) []model.Stats {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if sent := rec.snapshot(); len(sent) >= n {
+				return sent
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("Expected %d broadcasts, got %d", n, len(rec.snapshot()))
+		return nil
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if got := len(rec.snapshot()); got != 0 {
+		t.Fatalf("Expected nothing pushed before the flush interval passes, got %d", got)
+	}
+	clk.Advance(time.Second)
+	sent := waitSent(1)
+	if !sent[0].UpdatedAt.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected update stamped with the fake time, got %v", sent[0].UpdatedAt)
+	}
+
+	// the minute push recomputes every token, the swap has left the 5m window by then
+	clk.Advance(5 * time.Minute)
+	sent = waitSent(3)
+	if got := sent[len(sent)-1].BucketMinutes5.Count; got != 0 {
+		t.Errorf("Expected 5m count 0 after 5 minutes, got %d", got)
+	}
+}
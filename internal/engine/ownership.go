@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// Warm reloads series of tokens from the store, a new owner calls it
+// before it takes tokens over, so it continues from the state persisted by the previous owner.
+// The store is read under the lock, a token warmed again after the handoff doesn't lose swaps applied meanwhile.
+func (e *Engine) Warm(ctx context.Context, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	nowMin := unixMin(e.clock.Now().UTC())
+	start := nowMin - int64(windowMinutes) + 1
+
+	loaded := make(map[string]*series, len(tokens))
+	for _, token := range tokens {
+		fields, err := e.store.LoadSeries(ctx, token)
+		if err != nil {
+			return fmt.Errorf("load series of %s: %w", token, err)
+		}
+		loaded[token] = parseSeries(token, fields, start, nowMin)
+	}
+	blocks, err := e.store.LoadPendingBlocks(ctx)
+	if err != nil {
+		return fmt.Errorf("load pending blocks: %w", err)
+	}
+
+	e.dropBlocksLocked(func(token string) bool { return loaded[token] != nil })
+	for token, s := range loaded {
+		e.series[token] = s
+	}
+	for number, swaps := range blocks {
+		if number <= e.final {
+			continue
+		}
+		for _, swap := range swaps {
+			s, ok := loaded[swap.Token]
+			if !ok {
+				continue
+			}
+			e.blocks[number] = append(e.blocks[number], swap)
+			if idx, ok := s.index(swap.Minute); ok {
+				subSwap(&s.Confirmed[idx], swap)
+			}
+		}
+	}
+	return nil
+}
+
+// Release drops tokens which are owned by another instance now
+func (e *Engine) Release(tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	released := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		released[token] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for token := range released {
+		delete(e.series, token)
+	}
+	e.dropBlocksLocked(func(token string) bool { return released[token] })
+}
+
+// dropBlocksLocked forgets pending swaps of matching tokens
+func (e *Engine) dropBlocksLocked(match func(token string) bool) {
+	for number, swaps := range e.blocks {
+		kept := swaps[:0]
+		for _, swap := range swaps {
+			if !match(swap.Token) {
+				kept = append(kept, swap)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.blocks, number)
+			continue
+		}
+		e.blocks[number] = kept
+	}
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const defaultFlushInterval = 250 * time.Millisecond
+
+// publisher coalesces webSocket pushes: Apply only marks a token view dirty,
+// flush recomputes stats and broadcasts every dirty token view at most once per interval.
+// A token view stays dirty until it is flushed, so the final state is always delivered.
+type publisher struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	dirty map[topic]struct{}
+}
+
+type topic struct {
+	token string
+	view  model.View
+}
+
+func newPublisher(interval time.Duration) *publisher {
+	return &publisher{
+		interval: interval,
+		dirty:    make(map[topic]struct{}),
+	}
+}
+
+func (p *publisher) markDirty(token string, view model.View) {
+	p.mu.Lock()
+	p.dirty[topic{token: token, view: view}] = struct{}{}
+	p.mu.Unlock()
+}
+
+// take returns dirty token views and resets the set
+func (p *publisher) take() []topic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.dirty) == 0 {
+		return nil
+	}
+	topics := make([]topic, 0, len(p.dirty))
+	for t := range p.dirty {
+		topics = append(topics, t)
+	}
+	p.dirty = make(map[topic]struct{}, len(topics))
+	return topics
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// Drift is how buckets of a token in memory differ from storage, sums of absolute differences
+type Drift struct {
+	Token    string  `json:"token"`
+	Minutes  int     `json:"minutes"` // minutes of the window which differ
+	Count    uint64  `json:"count"`
+	USD      float64 `json:"usd"`
+	Quantity float64 `json:"quantity"`
+	Healed   bool    `json:"healed,omitempty"`
+}
+
+// Tokens returns tokens with a series in memory
+func (e *Engine) Tokens() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	tokens := make([]string, 0, len(e.series))
+	for token := range e.series {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Reconcile compares the window of a token in memory with storage, the source of truth.
+// Storage is read under the engine lock, which writes hold across storage and memory,
+// so a swap being applied never shows up as drift. With heal memory is replaced by storage.
+func (e *Engine) Reconcile(ctx context.Context, token string, heal bool) (Drift, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fields, err := e.store.LoadSeries(ctx, token)
+	if err != nil {
+		return Drift{}, fmt.Errorf("load series of %s: %w", token, err)
+	}
+	now := e.clock.Now().UTC()
+	nowMin := unixMin(now)
+	start := nowMin - int64(windowMinutes) + 1
+	stored := parseSeries(token, fields, start, nowMin)
+
+	var mem []model.Bucket
+	if s, ok := e.series[token]; ok {
+		e.advanceTo(s, nowMin)
+		mem = s.Buckets
+	} else {
+		mem = make([]model.Bucket, windowMinutes)
+	}
+
+	drift := Drift{Token: token}
+	for idx := range stored.Buckets {
+		m, r := mem[idx], stored.Buckets[idx]
+		if m.Count == r.Count && sameFloat(m.USD, r.USD) && sameFloat(m.Quantity, r.Quantity) {
+			continue
+		}
+		drift.Minutes++
+		drift.Count += max(m.Count, r.Count) - min(m.Count, r.Count)
+		drift.USD += math.Abs(m.USD - r.USD)
+		drift.Quantity += math.Abs(m.Quantity - r.Quantity)
+	}
+	if drift.Minutes == 0 || !heal {
+		return drift, nil
+	}
+
+	buckets := make([]model.MinuteBucket, 0, drift.Minutes)
+	for idx, b := range stored.Buckets {
+		if b != (model.Bucket{}) {
+			buckets = append(buckets, model.MinuteBucket{Minute: start + int64(idx), Bucket: b})
+		}
+	}
+	e.replaceLocked(token, start, nowMin+1, buckets)
+	drift.Healed = true
+	return drift, nil
+}
+
+// sameFloat tolerates rounding, storage sums floats with a different precision
+func sameFloat(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
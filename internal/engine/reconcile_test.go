@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/clock"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+// storedFields builds a redis hash of the given minutes: count, usd, quantity
+func storedFields(buckets map[int64]model.Bucket) map[string]string {
+	fields := make(map[string]string)
+	for minute, b := range buckets {
+		m := strconv.FormatInt(minute, 10)
+		fields[m+"#c"] = strconv.FormatUint(b.Count, 10)
+		fields[m+"#u"] = strconv.FormatFloat(b.USD, 'f', -1, 64)
+		fields[m+"#q"] = strconv.FormatFloat(b.Quantity, 'f', -1, 64)
+	}
+	return fields
+}
+
+func TestEngineReconcile(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 30, 0, time.UTC))
+	store := newMockStorage()
+	e := NewEngine(store, webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	ctx := context.Background()
+	now := clk.Now()
+	nowMin := unixMin(now)
+
+	events := []model.SwapEvent{
+		{EventID: "a", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 0.1, ExecutedAt: now.Add(-time.Hour)},
+		{EventID: "b", TokenID: "BTC", Side: model.Buy, Amount: 1, USD: 0.2, ExecutedAt: now.Add(-time.Hour)},
+		{EventID: "c", TokenID: "BTC", Side: model.Buy, Amount: 2, USD: 20, ExecutedAt: now, BlockNumber: 9, BlockHash: "0xa"},
+	}
+	for _, ev := range events {
+		if _, err := e.Apply(ctx, ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+
+	// redis summed 0.1 + 0.2 with another precision, that is not drift
+	store.series["BTC"] = storedFields(map[int64]model.Bucket{
+		nowMin - 60: {Count: 2, USD: 0.30000000000000004, Quantity: 2},
+		nowMin:      {Count: 1, USD: 20, Quantity: 2},
+	})
+	if drift, err := e.Reconcile(ctx, "BTC", true); err != nil || drift.Minutes != 0 || drift.Healed {
+		t.Fatalf("Expected no drift, got %+v, %v", drift, err)
+	}
+
+	// a swap reached redis and not memory, another one is in an older minute in memory only
+	store.series["BTC"] = storedFields(map[int64]model.Bucket{
+		nowMin - 60: {Count: 3, USD: 5.3, Quantity: 3},
+		nowMin:      {Count: 1, USD: 20, Quantity: 2},
+		nowMin - 10: {Count: 1, USD: 1, Quantity: 1},
+		nowMin + 1:  {Count: 9, USD: 9, Quantity: 9}, // future minute, not in the window yet
+	})
+	drift, err := e.Reconcile(ctx, "BTC", false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if drift.Minutes != 2 || drift.Count != 2 || drift.USD != 6 || drift.Quantity != 2 || drift.Healed {
+		t.Errorf("Expected drift in 2 minutes of 2 swaps, got %+v", drift)
+	}
+	if got := e.Stats("BTC", now).BucketHours24.Count; got != 3 {
+		t.Errorf("Expected memory kept without heal, got %d swaps", got)
+	}
+
+	drift, err = e.Reconcile(ctx, "BTC", true)
+	if err != nil || !drift.Healed {
+		t.Fatalf("Expected healed drift, got %+v, %v", drift, err)
+	}
+	if drift, _ := e.Reconcile(ctx, "BTC", false); drift.Minutes != 0 {
+		t.Errorf("Expected no drift after heal, got %+v", drift)
+	}
+	if got := e.StatsView("BTC", model.ViewConfirmed, now).BucketHours24; got.Count != 4 || got.USD != 6.3 {
+		t.Errorf("Expected swap of block 9 kept out of the confirmed view, got %+v", got)
+	}
+}
+
+func TestEngineReconcileMissingSeries(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	store := newMockStorage()
+	e := NewEngine(store, webSocket.NewHub(), WithClock(clk))
+	ctx := context.Background()
+	store.series["SOL"] = storedFields(map[int64]model.Bucket{unixMin(clk.Now()): {Count: 1, USD: 3, Quantity: 1}})
+
+	if drift, err := e.Reconcile(ctx, "SOL", true); err != nil || drift.Count != 1 || !drift.Healed {
+		t.Fatalf("Expected a healed missing series, got %+v, %v", drift, err)
+	}
+	if got := e.Stats("SOL", clk.Now()).BucketHours24.USD; got != 3 {
+		t.Errorf("Expected SOL loaded from redis, got %v usd", got)
+	}
+	if tokens := e.Tokens(); len(tokens) != 1 || tokens[0] != "SOL" {
+		t.Errorf("Expected SOL in memory, got %v", tokens)
+	}
+
+	store.loadErr = errors.New("redis is down")
+	if _, err := e.Reconcile(ctx, "SOL", true); !errors.Is(err, store.loadErr) {
+		t.Errorf("Expected load error, got %v", err)
+	}
+}
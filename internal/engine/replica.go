@@ -0,0 +1,41 @@
+package engine
+
+import "Dexcelerate_swap_stats/internal/model"
+
+// Replay applies an update written by a writer instance to memory only,
+// reader replicas keep their state with it after Reset from a snapshot
+func (e *Engine) Replay(u model.Update) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch u.Kind {
+	case model.UpdateSwap:
+		now := e.clock.Now().UTC()
+		nowMin := unixMin(now)
+		for _, swap := range u.Swaps {
+			s := e.ensureSeries(swap.Token, now)
+			e.advanceTo(s, nowMin)
+			minute := min(swap.Minute, nowMin)
+			idx, ok := s.index(minute)
+			if !ok {
+				continue // already out of window
+			}
+			addSwap(&s.Buckets[idx], swap.USD, swap.Quantity)
+			e.trackLocked(s, model.SwapEvent{
+				TokenID:     swap.Token,
+				USD:         swap.USD,
+				Amount:      swap.Quantity,
+				BlockNumber: u.BlockNumber,
+				BlockHash:   swap.BlockHash,
+			}, minute, nowMin)
+			e.pub.markDirty(swap.Token, model.ViewPending)
+		}
+	case model.UpdateRetract:
+		e.retractLocked(model.Retraction{BlockNumber: u.BlockNumber, BlockHash: u.BlockHash}, u.Swaps)
+	case model.UpdateBackfill:
+		e.forgetRangeLocked(u.Token, u.FromMinute, u.ToMinute)
+		e.replaceLocked(u.Token, u.FromMinute, u.ToMinute, u.Buckets)
+	case model.UpdateConfirm:
+		e.confirmLocked(u.BlockNumber)
+	}
+}
@@ -0,0 +1,418 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// SnapshotVersion is the format of snapshot files written by this build
+const SnapshotVersion = 1
+
+const (
+	snapshotMagic   = "SWSS"
+	maxSnapshotText = 1 << 16 // longest token, id or hash
+)
+
+var ErrBadSnapshot = errors.New("engine: bad snapshot")
+
+// SnapshotInfo describes a snapshot
+type SnapshotInfo struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	Checkpoint string    `json:"checkpoint"` // last event id persisted with the state
+	UpdateID   string    `json:"update_id"`  // last update in the stream included in the state
+	Tokens     int       `json:"tokens"`
+	Blocks     int       `json:"blocks"`
+	CaughtUpTo string    `json:"caught_up_to,omitempty"` // set by restore
+}
+
+// UpdateLog replays updates written after a snapshot, implemented by replica.Log.
+// Follow returns id of the last replayed update.
+type UpdateLog interface {
+	Follow(ctx context.Context, after string, replay func(model.Update)) (string, error)
+}
+
+// Snapshot layout, integers are varints, floats are 8 bytes little endian:
+//
+//	"SWSS" version created_ms checkpoint update_id head final
+//	series count, per series: token start_minute pending_buckets confirmed_buckets
+//	  buckets: count of non-empty ones, per bucket: index count usd quantity
+//	blocks count, per block: number swaps count, per swap: token minute usd quantity hash
+//	crc32 of everything before, 4 bytes little endian
+
+// WriteSnapshot writes the whole state to w. The checkpoint is saved first and the state
+// is encoded under the engine lock, so it matches the checkpoint and the update stream position.
+func (e *Engine) WriteSnapshot(ctx context.Context, w io.Writer) (SnapshotInfo, error) {
+	var buf bytes.Buffer
+	enc := &encoder{w: &buf}
+
+	e.mu.Lock()
+	if err := e.store.Checkpoint(ctx); err != nil {
+		e.mu.Unlock()
+		return SnapshotInfo{}, fmt.Errorf("save checkpoint: %w", err)
+	}
+	checkpoint, err := e.store.GetLastEventID(ctx)
+	if err != nil {
+		e.mu.Unlock()
+		return SnapshotInfo{}, fmt.Errorf("read checkpoint: %w", err)
+	}
+	updateID, err := e.store.LastUpdateID(ctx)
+	if err != nil {
+		e.mu.Unlock()
+		return SnapshotInfo{}, fmt.Errorf("read update stream position: %w", err)
+	}
+	info := SnapshotInfo{
+		Version:    SnapshotVersion,
+		CreatedAt:  e.clock.Now().UTC().Truncate(time.Millisecond),
+		Checkpoint: checkpoint,
+		UpdateID:   updateID,
+		Tokens:     len(e.series),
+		Blocks:     len(e.blocks),
+	}
+	enc.text(snapshotMagic)
+	enc.uvarint(SnapshotVersion)
+	enc.varint(info.CreatedAt.UnixMilli())
+	enc.text(checkpoint)
+	enc.text(updateID)
+	enc.uvarint(e.head)
+	enc.uvarint(e.final)
+	enc.uvarint(uint64(len(e.series)))
+	for token, s := range e.series {
+		enc.text(token)
+		enc.varint(s.StartMinute)
+		enc.buckets(s.Buckets)
+		enc.buckets(s.Confirmed)
+	}
+	enc.uvarint(uint64(len(e.blocks)))
+	for number, swaps := range e.blocks {
+		enc.uvarint(number)
+		enc.uvarint(uint64(len(swaps)))
+		for _, swap := range swaps {
+			enc.text(swap.Token)
+			enc.varint(swap.Minute)
+			enc.float(swap.USD)
+			enc.float(swap.Quantity)
+			enc.text(swap.BlockHash)
+		}
+	}
+	e.mu.Unlock()
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum[:])
+	if _, err := buf.WriteTo(w); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return info, nil
+}
+
+// Restore replaces the state with a snapshot caught up with updates written after it.
+// Most updates are replayed aside, the rest under the engine lock, so no swap applied
+// meanwhile is missed or counted twice. Nil updates restores the snapshot as is, for offline tools only:
+// a log which can't reach back to the snapshot fails the restore.
+// On error the state is not changed.
+func (e *Engine) Restore(ctx context.Context, r io.Reader, updates UpdateLog) (SnapshotInfo, error) {
+	next := &Engine{
+		clock:         e.clock,
+		pub:           newPublisher(defaultFlushInterval),
+		confirmations: e.confirmations,
+	}
+	info, err := next.decodeSnapshot(r)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	after := info.UpdateID
+	if updates != nil {
+		if after, err = updates.Follow(ctx, after, next.Replay); err != nil {
+			return SnapshotInfo{}, fmt.Errorf("catch up after %s: %w", info.UpdateID, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if updates != nil {
+		if after, err = updates.Follow(ctx, after, next.Replay); err != nil {
+			return SnapshotInfo{}, fmt.Errorf("catch up after %s: %w", info.UpdateID, err)
+		}
+	}
+	e.series, e.blocks, e.head, e.final = next.series, next.blocks, next.head, next.final
+	for token := range e.series {
+		e.pub.markDirty(token, model.ViewPending)
+		e.pub.markDirty(token, model.ViewConfirmed)
+	}
+	info.CaughtUpTo = after
+	return info, nil
+}
+
+// SaveSnapshot writes the snapshot to a temporary file and renames it over path,
+// so a crash never leaves a torn snapshot
+func (e *Engine) SaveSnapshot(ctx context.Context, path string) (SnapshotInfo, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer os.Remove(f.Name()) // no-op after rename
+
+	info, err := e.WriteSnapshot(ctx, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return info, nil
+}
+
+// RestoreFile restores the snapshot saved at path, see Restore
+func (e *Engine) RestoreFile(ctx context.Context, path string, updates UpdateLog) (SnapshotInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer f.Close()
+	return e.Restore(ctx, f, updates)
+}
+
+// SnapshotFile binds snapshots of an engine to a file and an update log to catch up with
+type SnapshotFile struct {
+	engine  *Engine
+	path    string
+	updates UpdateLog
+}
+
+func NewSnapshotFile(e *Engine, path string, updates UpdateLog) *SnapshotFile {
+	return &SnapshotFile{engine: e, path: path, updates: updates}
+}
+
+func (f *SnapshotFile) Path() string { return f.path }
+
+func (f *SnapshotFile) Save(ctx context.Context) (SnapshotInfo, error) {
+	return f.engine.SaveSnapshot(ctx, f.path)
+}
+
+func (f *SnapshotFile) Restore(ctx context.Context) (SnapshotInfo, error) {
+	return f.engine.RestoreFile(ctx, f.path, f.updates)
+}
+
+// decodeSnapshot fills the state of an engine nobody else uses yet
+func (e *Engine) decodeSnapshot(r io.Reader) (SnapshotInfo, error) {
+	dec := &decoder{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	if magic := dec.text(); dec.err == nil && magic != snapshotMagic {
+		return SnapshotInfo{}, fmt.Errorf("%w: not a snapshot", ErrBadSnapshot)
+	}
+	info := SnapshotInfo{Version: int(dec.uvarint())}
+	if dec.err == nil && info.Version != SnapshotVersion {
+		return SnapshotInfo{}, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, info.Version)
+	}
+	info.CreatedAt = time.UnixMilli(dec.varint()).UTC()
+	info.Checkpoint = dec.text()
+	info.UpdateID = dec.text()
+	e.head = dec.uvarint()
+	e.final = dec.uvarint()
+
+	n := dec.count()
+	e.series = make(map[string]*series, min(n, maxSnapshotText))
+	for i := 0; i < n && dec.err == nil; i++ {
+		s := &series{Token: dec.text(), StartMinute: dec.varint()}
+		s.Buckets = dec.buckets()
+		s.Confirmed = dec.buckets()
+		e.series[s.Token] = s
+	}
+	n = dec.count()
+	e.blocks = make(map[uint64][]model.BlockSwap, min(n, maxSnapshotText))
+	for i := 0; i < n && dec.err == nil; i++ {
+		number := dec.uvarint()
+		var swaps []model.BlockSwap
+		for j, m := 0, dec.count(); j < m && dec.err == nil; j++ {
+			swaps = append(swaps, model.BlockSwap{
+				Token:     dec.text(),
+				Minute:    dec.varint(),
+				USD:       dec.float(),
+				Quantity:  dec.float(),
+				BlockHash: dec.text(),
+			})
+		}
+		e.blocks[number] = swaps
+	}
+	dec.checksum()
+	if dec.err != nil {
+		if !errors.Is(dec.err, ErrBadSnapshot) {
+			return SnapshotInfo{}, fmt.Errorf("%w: %v", ErrBadSnapshot, dec.err)
+		}
+		return SnapshotInfo{}, dec.err
+	}
+	info.Tokens, info.Blocks = len(e.series), len(e.blocks)
+	return info, nil
+}
+
+type encoder struct {
+	w   *bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (enc *encoder) uvarint(v uint64) {
+	enc.w.Write(enc.tmp[:binary.PutUvarint(enc.tmp[:], v)])
+}
+
+func (enc *encoder) varint(v int64) {
+	enc.w.Write(enc.tmp[:binary.PutVarint(enc.tmp[:], v)])
+}
+
+func (enc *encoder) float(v float64) {
+	binary.LittleEndian.PutUint64(enc.tmp[:8], math.Float64bits(v))
+	enc.w.Write(enc.tmp[:8])
+}
+
+func (enc *encoder) text(s string) {
+	enc.uvarint(uint64(len(s)))
+	enc.w.WriteString(s)
+}
+
+// buckets writes only non-empty buckets, most of a day is empty for rare tokens
+func (enc *encoder) buckets(buckets []model.Bucket) {
+	n := 0
+	for _, b := range buckets {
+		if b != (model.Bucket{}) {
+			n++
+		}
+	}
+	enc.uvarint(uint64(n))
+	for i, b := range buckets {
+		if b == (model.Bucket{}) {
+			continue
+		}
+		enc.uvarint(uint64(i))
+		enc.uvarint(b.Count)
+		enc.float(b.USD)
+		enc.float(b.Quantity)
+	}
+}
+
+// decoder keeps the first error, later reads return zero values
+type decoder struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (d *decoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == nil {
+		d.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err != nil {
+		return
+	}
+	if _, d.err = io.ReadFull(d.r, p); d.err == nil {
+		d.crc.Write(p)
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var v uint64
+	v, d.err = binary.ReadUvarint(d)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var v int64
+	v, d.err = binary.ReadVarint(d)
+	return v
+}
+
+func (d *decoder) float() float64 {
+	var p [8]byte
+	d.read(p[:])
+	return math.Float64frombits(binary.LittleEndian.Uint64(p[:]))
+}
+
+func (d *decoder) text() string {
+	n := d.uvarint()
+	if n > maxSnapshotText {
+		d.fail("text of %d bytes", n)
+		return ""
+	}
+	p := make([]byte, n)
+	d.read(p)
+	return string(p)
+}
+
+// count reads a length, a corrupted one is only bounded by the bytes left,
+// so callers grow collections while reading instead of allocating it upfront
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > math.MaxInt32 {
+		d.fail("count %d", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) buckets() []model.Bucket {
+	buckets := make([]model.Bucket, windowMinutes)
+	n := d.count()
+	if n > windowMinutes {
+		d.fail("%d buckets", n)
+		return buckets
+	}
+	for i := 0; i < n && d.err == nil; i++ {
+		idx := d.uvarint()
+		b := model.Bucket{Count: d.uvarint(), USD: d.float(), Quantity: d.float()}
+		if idx >= windowMinutes {
+			d.fail("bucket index %d", idx)
+			break
+		}
+		buckets[idx] = b
+	}
+	return buckets
+}
+
+func (d *decoder) checksum() {
+	if d.err != nil {
+		return
+	}
+	want := d.crc.Sum32()
+	var p [4]byte
+	if _, d.err = io.ReadFull(d.r, p[:]); d.err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(p[:]) != want {
+		d.fail("checksum mismatch")
+	}
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrBadSnapshot, fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/clock"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+// fakeLog replays updates with numeric ids after the given one
+type fakeLog struct {
+	updates []model.Update
+	err     error
+	calls   int
+}
+
+func (l *fakeLog) Follow(_ context.Context, after string, replay func(model.Update)) (string, error) {
+	l.calls++
+	if l.err != nil {
+		return after, l.err
+	}
+	from, _ := strconv.Atoi(after)
+	for _, u := range l.updates {
+		if id, _ := strconv.Atoi(u.ID); id > from {
+			replay(u)
+			after = u.ID
+		}
+	}
+	return after, nil
+}
+
+func newSnapshotEngine(t *testing.T, clk clock.Clock) (*Engine, *mockStorage) {
+	t.Helper()
+	store := newMockStorage()
+	store.lastEvent, store.lastUpdate = "ev-4", "4"
+	e := NewEngine(store, webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	now := clk.Now()
+	for i, block := range []uint64{0, 10, 11, 12, 13} {
+		ev := model.SwapEvent{EventID: "ev-" + strconv.Itoa(i), TokenID: "BTC", Side: model.Buy, Amount: 1,
+			USD: float64(10 * (i + 1)), ExecutedAt: now.Add(-time.Duration(i) * time.Hour), BlockNumber: block, BlockHash: "0xa"}
+		if _, err := e.Apply(context.Background(), ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+	if _, err := e.Apply(context.Background(), model.SwapEvent{EventID: "ev-eth", TokenID: "ETH", Side: model.Sell,
+		Amount: 2, USD: 5, ExecutedAt: now}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	return e, store
+}
+
+func assertSameState(t *testing.T, want, got *Engine, now time.Time) {
+	t.Helper()
+	for _, token := range []string{"BTC", "ETH"} {
+		for _, view := range []model.View{model.ViewPending, model.ViewConfirmed} {
+			w, g := want.StatsView(token, view, now), got.StatsView(token, view, now)
+			if w.BucketMinutes5 != g.BucketMinutes5 || w.BucketHours1 != g.BucketHours1 || w.BucketHours24 != g.BucketHours24 {
+				t.Errorf("Expected %s %s stats %+v, got %+v", token, view, w, g)
+			}
+		}
+	}
+	if want.head != got.head || want.final != got.final || len(want.blocks) != len(got.blocks) {
+		t.Errorf("Expected head %d final %d and %d pending blocks, got %d %d %d",
+			want.head, want.final, len(want.blocks), got.head, got.final, len(got.blocks))
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	src, store := newSnapshotEngine(t, clk)
+
+	var buf bytes.Buffer
+	info, err := src.WriteSnapshot(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	if info.Checkpoint != "ev-4" || info.UpdateID != "4" || info.Tokens != 2 || store.checkpoints != 1 {
+		t.Errorf("Unexpected snapshot info %+v after %d checkpoints", info, store.checkpoints)
+	}
+
+	// restored later, the window moves on
+	clk.Advance(30 * time.Minute)
+	dst := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	got, err := dst.Restore(context.Background(), &buf, nil)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got.Version != SnapshotVersion || !got.CreatedAt.Equal(info.CreatedAt) || got.Checkpoint != info.Checkpoint {
+		t.Errorf("Expected info %+v, got %+v", info, got)
+	}
+	assertSameState(t, src, dst, clk.Now())
+}
+
+func TestSnapshotRestoreCatchesUp(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	src, _ := newSnapshotEngine(t, clk)
+	var buf bytes.Buffer
+	if _, err := src.WriteSnapshot(context.Background(), &buf); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+
+	swap := model.BlockSwap{Token: "BTC", Minute: unixMin(clk.Now()), USD: 7, Quantity: 1, BlockHash: "0xb"}
+	log := &fakeLog{updates: []model.Update{
+		{ID: "3", Kind: model.UpdateSwap, Swaps: []model.BlockSwap{swap}}, // already in the snapshot
+		{ID: "5", Kind: model.UpdateSwap, BlockNumber: 14, BlockHash: "0xb", Swaps: []model.BlockSwap{swap}},
+		{ID: "6", Kind: model.UpdateRetract, BlockNumber: 13, BlockHash: "0xa", Swaps: []model.BlockSwap{
+			{Token: "BTC", Minute: unixMin(clk.Now().Add(-4 * time.Hour)), USD: 50, Quantity: 1, BlockHash: "0xa"},
+		}},
+	}}
+	dst := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	info, err := dst.Restore(context.Background(), &buf, log)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if info.CaughtUpTo != "6" || log.calls != 2 {
+		t.Errorf("Expected caught up to 6 in 2 calls, got %q in %d", info.CaughtUpTo, log.calls)
+	}
+
+	// the same updates applied to the source by hand
+	for _, u := range log.updates[1:] {
+		src.Replay(u)
+	}
+	assertSameState(t, src, dst, clk.Now())
+}
+
+func TestSnapshotRestoreKeepsStateOnError(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	src, _ := newSnapshotEngine(t, clk)
+	var buf bytes.Buffer
+	if _, err := src.WriteSnapshot(context.Background(), &buf); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	good := buf.Bytes()
+
+	flipped := bytes.Clone(good)
+	flipped[len(flipped)/2] ^= 0xff
+	version := bytes.Clone(good)
+	version[5] = SnapshotVersion + 1 // right after the magic
+
+	gap := errors.New("gap")
+	tests := []struct {
+		name string
+		data []byte
+		log  UpdateLog
+		want error
+	}{
+		{"empty", nil, nil, ErrBadSnapshot},
+		{"not a snapshot", []byte("hello, world"), nil, ErrBadSnapshot},
+		{"truncated", good[:len(good)-10], nil, ErrBadSnapshot},
+		{"corrupted", flipped, nil, ErrBadSnapshot},
+		{"unknown version", version, nil, ErrBadSnapshot},
+		{"log can't catch up", good, &fakeLog{err: gap}, gap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk))
+			if _, err := dst.Apply(context.Background(), model.SwapEvent{EventID: "kept", TokenID: "SOL",
+				Side: model.Buy, Amount: 1, USD: 1, ExecutedAt: clk.Now()}); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if _, err := dst.Restore(context.Background(), bytes.NewReader(tt.data), tt.log); !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if got := dst.Stats("SOL", clk.Now()).BucketHours24.Count; got != 1 || len(dst.series) != 1 {
+				t.Errorf("Expected state unchanged, got %d series and %d SOL swaps", len(dst.series), got)
+			}
+		})
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	src, _ := newSnapshotEngine(t, clk)
+	path := filepath.Join(t.TempDir(), "engine.snap")
+
+	if _, err := src.SaveSnapshot(context.Background(), path); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	// saved again over the previous one, no temporary files are left
+	if _, err := src.SaveSnapshot(context.Background(), path); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, got %d entries", len(entries))
+	}
+
+	dst := NewEngine(newMockStorage(), webSocket.NewHub(), WithClock(clk), WithConfirmations(2))
+	if _, err := dst.RestoreFile(context.Background(), path, nil); err != nil {
+		t.Fatalf("RestoreFile: %v", err)
+	}
+	assertSameState(t, src, dst, clk.Now())
+
+	if _, err := dst.RestoreFile(context.Background(), path+".missing", nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package grpcApi
+
+import (
+	"Dexcelerate_swap_stats/internal/grpcApi/statspb"
+	"Dexcelerate_swap_stats/internal/model"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fromProtoView parses the view of a request like model.ParseView, unspecified is pending
+func fromProtoView(v statspb.View) (model.View, error) {
+	switch v {
+	case statspb.View_VIEW_UNSPECIFIED, statspb.View_VIEW_PENDING:
+		return model.ViewPending, nil
+	case statspb.View_VIEW_CONFIRMED:
+		return model.ViewConfirmed, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unknown view: %d", v)
+}
+
+func toProtoView(v model.View) statspb.View {
+	if v == model.ViewConfirmed {
+		return statspb.View_VIEW_CONFIRMED
+	}
+	return statspb.View_VIEW_PENDING
+}
+
+func toProtoBucket(b model.Bucket) *statspb.Bucket {
+	return &statspb.Bucket{
+		TransactionCount: b.Count,
+		UsdVolume:        b.USD,
+		TokenVolume:      b.Quantity,
+	}
+}
+
+func toProtoBucketDelta(d model.BucketDelta) *statspb.BucketDelta {
+	return &statspb.BucketDelta{
+		TransactionCount: d.Count,
+		UsdVolume:        d.USD,
+		TokenVolume:      d.Quantity,
+	}
+}
+
+func toProtoStats(st model.Stats) *statspb.Stats {
+	return &statspb.Stats{
+		Token:     st.Token,
+		Minutes_5: toProtoBucket(st.BucketMinutes5),
+		Hours_1:   toProtoBucket(st.BucketHours1),
+		Hours_24:  toProtoBucket(st.BucketHours24),
+		UpdatedAt: timestamppb.New(st.UpdatedAt),
+		View:      toProtoView(st.View),
+	}
+}
+
+func toProtoUpdate(env model.Envelope) *statspb.StatsUpdate {
+	u := &statspb.StatsUpdate{
+		Token:     env.Token,
+		Seq:       env.Seq,
+		Epoch:     env.Epoch,
+		UpdatedAt: timestamppb.New(env.UpdatedAt),
+		View:      toProtoView(env.View),
+	}
+	switch env.Type {
+	case model.MessageSnapshot:
+		u.Type = statspb.StatsUpdate_TYPE_SNAPSHOT
+		if env.Stats != nil {
+			u.Stats = toProtoStats(*env.Stats)
+		}
+	case model.MessageDelta:
+		u.Type = statspb.StatsUpdate_TYPE_DELTA
+		if env.Delta != nil {
+			u.Delta = &statspb.StatsDelta{
+				Minutes_5: toProtoBucketDelta(env.Delta.BucketMinutes5),
+				Hours_1:   toProtoBucketDelta(env.Delta.BucketHours1),
+				Hours_24:  toProtoBucketDelta(env.Delta.BucketHours24),
+			}
+		}
+	}
+	return u
+}
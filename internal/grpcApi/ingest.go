@@ -0,0 +1,90 @@
+package grpcApi
+
+import (
+	"errors"
+	"io"
+
+	"Dexcelerate_swap_stats/internal/grpcApi/statspb"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type ingestServer struct {
+	statspb.UnimplementedIngestServiceServer
+
+	ingestor *ingest.Ingestor
+}
+
+// Ingest applies events one by one, so HTTP/2 flow control slows the producer
+// down while an event waits for a free apply slot. An event which waited too long
+// is answered overloaded and the stream goes on, the producer resends it later.
+func (s *ingestServer) Ingest(stream grpc.BidiStreamingServer[statspb.SwapEvent, statspb.IngestResult]) error {
+	ctx := stream.Context()
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out, err := s.ingestor.Ingest(ctx, fromProtoEvent(ev))
+		res := toProtoResult(out)
+		if errors.Is(err, ingest.ErrOverloaded) {
+			res.Result = statspb.IngestResult_RESULT_OVERLOADED
+			res.Error = err.Error()
+		} else if err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func fromProtoEvent(ev *statspb.SwapEvent) model.SwapEvent {
+	out := model.SwapEvent{
+		EventID: ev.GetEventId(),
+		TokenID: ev.GetTokenId(),
+		Amount:  ev.GetAmount(),
+		USD:     ev.GetUsd(),
+		Side:    model.Side(ev.GetSide()),
+		Rate:    ev.GetRate(),
+
+		Chain:       ev.GetChain(),
+		BlockNumber: ev.GetBlockNumber(),
+		BlockHash:   ev.GetBlockHash(),
+		TxHash:      ev.GetTxHash(),
+		LogIndex:    ev.GetLogIndex(),
+	}
+	// unset timestamps stay zero instead of unix epoch
+	if ev.GetCreatedAt() != nil {
+		out.CreatedAt = ev.GetCreatedAt().AsTime()
+	}
+	if ev.GetExecutedAt() != nil {
+		out.ExecutedAt = ev.GetExecutedAt().AsTime()
+	}
+	return out
+}
+
+func toProtoResult(out ingest.Outcome) *statspb.IngestResult {
+	res := &statspb.IngestResult{
+		EventId: out.EventID,
+		Error:   out.Error,
+	}
+	switch out.Result {
+	case ingest.ResultApplied:
+		res.Result = statspb.IngestResult_RESULT_APPLIED
+	case ingest.ResultDuplicate:
+		res.Result = statspb.IngestResult_RESULT_DUPLICATE
+	case ingest.ResultRejected:
+		res.Result = statspb.IngestResult_RESULT_REJECTED
+	case ingest.ResultFailed:
+		res.Result = statspb.IngestResult_RESULT_FAILED
+	}
+	return res
+}
@@ -0,0 +1,198 @@
+// Package grpcApi serves stats over gRPC, see api/proto/stats/v1/stats.proto
+package grpcApi
+
+//go:generate protoc -I ../../api/proto --go_out=. --go_opt=module=Dexcelerate_swap_stats/internal/grpcApi --go-grpc_out=. --go-grpc_opt=module=Dexcelerate_swap_stats/internal/grpcApi stats/v1/stats.proto
+
+import (
+	"context"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/cluster"
+	"Dexcelerate_swap_stats/internal/grpcApi/statspb"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxBatchTokens = 100
+
+// EngineInterface is the part of engine used by gRPC API
+type EngineInterface interface {
+	StatsView(token string, view model.View, now time.Time) model.Stats
+}
+
+// Cluster tells which instance owns a token
+type Cluster interface {
+	Owner(token string) (cluster.Member, bool)
+	Self() cluster.Member
+}
+
+type server struct {
+	statspb.UnimplementedStatsServiceServer
+
+	engine  EngineInterface
+	wsHub   *webSocket.Hub
+	cluster Cluster // nil without cluster
+}
+
+type config struct {
+	cluster     Cluster
+	grpcOptions []grpc.ServerOption
+}
+
+type Option func(*config)
+
+// WithCluster refuses stats of tokens owned by another instance, the error names the owner
+func WithCluster(c Cluster) Option {
+	return func(cfg *config) { cfg.cluster = c }
+}
+
+// WithServerOptions passes options to the underlying grpc.Server
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(cfg *config) { cfg.grpcOptions = append(cfg.grpcOptions, opts...) }
+}
+
+// NewServer returns gRPC server backed by the same engine, hub and ingestor as HTTP API,
+// without ingestor IngestService is not registered
+func NewServer(engine EngineInterface, wsHub *webSocket.Hub, ingestor *ingest.Ingestor, opts ...Option) *grpc.Server {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	s := grpc.NewServer(cfg.grpcOptions...)
+	statspb.RegisterStatsServiceServer(s, &server{
+		engine:  engine,
+		wsHub:   wsHub,
+		cluster: cfg.cluster,
+	})
+	if ingestor != nil {
+		statspb.RegisterIngestServiceServer(s, &ingestServer{
+			ingestor: ingestor,
+		})
+	}
+	return s
+}
+
+func (s *server) GetStats(_ context.Context, req *statspb.GetStatsRequest) (*statspb.Stats, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token required")
+	}
+	view, err := fromProtoView(req.GetView())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwner(req.GetToken()); err != nil {
+		return nil, err
+	}
+	return toProtoStats(s.engine.StatsView(req.GetToken(), view, time.Now())), nil
+}
+
+func (s *server) GetBatchStats(_ context.Context, req *statspb.GetBatchStatsRequest) (*statspb.GetBatchStatsResponse, error) {
+	tokens := req.GetTokens()
+	if len(tokens) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "tokens required")
+	}
+	if len(tokens) > maxBatchTokens {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d tokens per batch", maxBatchTokens)
+	}
+	view, err := fromProtoView(req.GetView())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	resp := &statspb.GetBatchStatsResponse{Stats: make([]*statspb.Stats, 0, len(tokens))}
+	for _, token := range tokens {
+		if token == "" {
+			return nil, status.Error(codes.InvalidArgument, "empty token in batch")
+		}
+		if err := s.checkOwner(token); err != nil {
+			return nil, err
+		}
+		resp.Stats = append(resp.Stats, toProtoStats(s.engine.StatsView(token, view, now)))
+	}
+	return resp, nil
+}
+
+// Subscribe shares the hub with WebSocket and SSE clients,
+// so updates, sequence numbers and resume work the same way
+func (s *server) Subscribe(req *statspb.SubscribeRequest, stream grpc.ServerStreamingServer[statspb.StatsUpdate]) error {
+	tokens := req.GetTokens()
+	if len(tokens) == 0 {
+		return status.Error(codes.InvalidArgument, "tokens required")
+	}
+	view, err := fromProtoView(req.GetView())
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if token == "" {
+			return status.Error(codes.InvalidArgument, "empty token in subscription")
+		}
+		if err := s.checkOwner(token); err != nil {
+			return err
+		}
+	}
+
+	client := s.wsHub.NewStreamClient()
+	defer s.wsHub.Unsubscribe(client)
+	now := time.Now()
+	for _, token := range tokens {
+		s.wsHub.Subscribe(client, token, req.GetEpoch(), req.GetSince()[token], s.engine.StatsView(token, view, now))
+	}
+
+	sendQueued := func() error {
+		for _, env := range client.Take() {
+			if err := stream.Send(toProtoUpdate(env)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.Done():
+			// on shutdown the last updates are still queued
+			if err := sendQueued(); err != nil {
+				return err
+			}
+			return closedStatus(client.Reason())
+		case <-client.Wake():
+			if err := sendQueued(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// closedStatus tells a subscriber why the hub closed its stream
+func closedStatus(reason webSocket.CloseReason) error {
+	switch reason {
+	case webSocket.CloseOverflow:
+		return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+	case webSocket.CloseShutdown:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return status.Error(codes.Unavailable, "subscription closed")
+}
+
+// checkOwner refuses a token owned by another instance, only the owner has its series in memory.
+// gRPC calls are not proxied, the client retries on the owner named in the error.
+func (s *server) checkOwner(token string) error {
+	if s.cluster == nil {
+		return nil
+	}
+	owner, ok := s.cluster.Owner(token)
+	if !ok || owner.ID == s.cluster.Self().ID {
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition, "token %s is owned by instance %s at %s", token, owner.ID, owner.Addr)
+}
@@ -0,0 +1,533 @@
+package grpcApi
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/cluster"
+	"Dexcelerate_swap_stats/internal/grpcApi/statspb"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
+	"Dexcelerate_swap_stats/internal/webSocket"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Mock engine for testing
+type mockEngine struct {
+	statsData map[string]model.Stats
+
+	mu        sync.Mutex
+	applied   map[string]bool
+	applyWait chan struct{} // blocks Apply until closed when set
+}
+
+func newMockEngine() *mockEngine {
+	return &mockEngine{
+		statsData: make(map[string]model.Stats),
+		applied:   make(map[string]bool),
+	}
+}
+
+func (m *mockEngine) Apply(_ context.Context, ev model.SwapEvent) (bool, error) {
+	if m.applyWait != nil {
+		<-m.applyWait
+	}
+	if err := validation.New(validation.Rules{}).Validate(ev); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.applied[ev.EventID] {
+		return false, nil
+	}
+	m.applied[ev.EventID] = true
+	return true, nil
+}
+
+// StatsView looks up statsData by model.Topic, so pending stats are keyed by token
+func (m *mockEngine) StatsView(token string, view model.View, now time.Time) model.Stats {
+	if stats, exists := m.statsData[model.Topic(token, view)]; exists {
+		stats.View = view
+		return stats
+	}
+	return model.Stats{
+		Token:     token,
+		View:      view,
+		UpdatedAt: now,
+	}
+}
+
+// newTestClient serves gRPC API on an in-memory listener
+func newTestClient(t *testing.T, eng *mockEngine, hub *webSocket.Hub, opts ...Option) statspb.StatsServiceClient {
+	t.Helper()
+	return statspb.NewStatsServiceClient(dialTestServer(t, eng, hub, opts...))
+}
+
+func dialTestServer(t *testing.T, eng *mockEngine, hub *webSocket.Hub, opts ...Option) *grpc.ClientConn {
+	t.Helper()
+	return dialServer(t, NewServer(eng, hub, ingest.New(eng, 4, time.Second), opts...))
+}
+
+func dialServer(t *testing.T, srv *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestGetStats(t *testing.T) {
+	eng := newMockEngine()
+	eng.statsData["BTC"] = model.Stats{
+		Token:          "BTC",
+		BucketMinutes5: model.Bucket{Count: 10, USD: 1000.0, Quantity: 0.1},
+		BucketHours24:  model.Bucket{Count: 500, USD: 50000.0, Quantity: 5.0},
+		UpdatedAt:      time.Now(),
+	}
+	client := newTestClient(t, eng, webSocket.NewHub())
+
+	st, err := client.GetStats(context.Background(), &statspb.GetStatsRequest{Token: "BTC"})
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if st.GetToken() != "BTC" {
+		t.Errorf("Expected token BTC, got %s", st.GetToken())
+	}
+	if st.GetMinutes_5().GetTransactionCount() != 10 {
+		t.Errorf("Expected 10 transactions in 5 minutes, got %d", st.GetMinutes_5().GetTransactionCount())
+	}
+	if st.GetHours_24().GetUsdVolume() != 50000.0 {
+		t.Errorf("Expected 24h USD volume 50000, got %f", st.GetHours_24().GetUsdVolume())
+	}
+}
+
+func TestGetStatsView(t *testing.T) {
+	eng := newMockEngine()
+	eng.statsData["BTC"] = model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: 10}}
+	eng.statsData[model.Topic("BTC", model.ViewConfirmed)] = model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: 4}}
+	client := newTestClient(t, eng, webSocket.NewHub())
+
+	tests := []struct {
+		view      statspb.View
+		wantView  statspb.View
+		wantCount uint64
+	}{
+		{statspb.View_VIEW_UNSPECIFIED, statspb.View_VIEW_PENDING, 10},
+		{statspb.View_VIEW_PENDING, statspb.View_VIEW_PENDING, 10},
+		{statspb.View_VIEW_CONFIRMED, statspb.View_VIEW_CONFIRMED, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view.String(), func(t *testing.T) {
+			st, err := client.GetStats(context.Background(), &statspb.GetStatsRequest{Token: "BTC", View: tt.view})
+			if err != nil {
+				t.Fatalf("GetStats() returned error: %v", err)
+			}
+			if st.GetView() != tt.wantView {
+				t.Errorf("Expected view %s, got %s", tt.wantView, st.GetView())
+			}
+			if st.GetMinutes_5().GetTransactionCount() != tt.wantCount {
+				t.Errorf("Expected %d transactions in 5 minutes, got %d", tt.wantCount, st.GetMinutes_5().GetTransactionCount())
+			}
+		})
+	}
+
+	_, err := client.GetStats(context.Background(), &statspb.GetStatsRequest{Token: "BTC", View: statspb.View(9)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for unknown view, got %v", err)
+	}
+}
+
+func TestGetStatsMissingToken(t *testing.T) {
+	client := newTestClient(t, newMockEngine(), webSocket.NewHub())
+
+	_, err := client.GetStats(context.Background(), &statspb.GetStatsRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+// mockCluster owns tokens of self, every other token belongs to instance b
+type mockCluster struct {
+	owned map[string]bool
+}
+
+func (m mockCluster) Self() cluster.Member { return cluster.Member{ID: "a", Addr: "http://a"} }
+
+func (m mockCluster) Owner(token string) (cluster.Member, bool) {
+	if m.owned[token] {
+		return m.Self(), true
+	}
+	return cluster.Member{ID: "b", Addr: "http://b"}, true
+}
+
+func TestStatsOfForeignToken(t *testing.T) {
+	client := newTestClient(t, newMockEngine(), webSocket.NewHub(), WithCluster(mockCluster{owned: map[string]bool{"BTC": true}}))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"owned token", func() error {
+			_, err := client.GetStats(ctx, &statspb.GetStatsRequest{Token: "BTC"})
+			return err
+		}, codes.OK},
+		{"foreign token", func() error {
+			_, err := client.GetStats(ctx, &statspb.GetStatsRequest{Token: "ETH"})
+			return err
+		}, codes.FailedPrecondition},
+		{"batch with a foreign token", func() error {
+			_, err := client.GetBatchStats(ctx, &statspb.GetBatchStatsRequest{Tokens: []string{"BTC", "ETH"}})
+			return err
+		}, codes.FailedPrecondition},
+		{"subscription to a foreign token", func() error {
+			stream, err := client.Subscribe(ctx, &statspb.SubscribeRequest{Tokens: []string{"ETH"}})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if status.Code(err) != tt.code {
+				t.Fatalf("Expected %s, got %v", tt.code, err)
+			}
+			if err != nil && !strings.Contains(status.Convert(err).Message(), "http://b") {
+				t.Errorf("Expected owner address in the error, got %q", status.Convert(err).Message())
+			}
+		})
+	}
+}
+
+func TestGetBatchStats(t *testing.T) {
+	eng := newMockEngine()
+	eng.statsData["ETH"] = model.Stats{Token: "ETH", BucketHours1: model.Bucket{Count: 7}}
+	client := newTestClient(t, eng, webSocket.NewHub())
+
+	resp, err := client.GetBatchStats(context.Background(), &statspb.GetBatchStatsRequest{
+		Tokens: []string{"BTC", "ETH"},
+	})
+	if err != nil {
+		t.Fatalf("GetBatchStats() returned error: %v", err)
+	}
+	if len(resp.GetStats()) != 2 {
+		t.Fatalf("Expected 2 stats, got %d", len(resp.GetStats()))
+	}
+	if resp.GetStats()[0].GetToken() != "BTC" || resp.GetStats()[1].GetToken() != "ETH" {
+		t.Errorf("Expected stats in request order, got %s, %s",
+			resp.GetStats()[0].GetToken(), resp.GetStats()[1].GetToken())
+	}
+	if resp.GetStats()[1].GetHours_1().GetTransactionCount() != 7 {
+		t.Errorf("Expected 7 ETH transactions in 1 hour, got %d", resp.GetStats()[1].GetHours_1().GetTransactionCount())
+	}
+
+	_, err = client.GetBatchStats(context.Background(), &statspb.GetBatchStatsRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for empty batch, got %v", err)
+	}
+}
+
+func TestGetBatchStatsView(t *testing.T) {
+	eng := newMockEngine()
+	eng.statsData["ETH"] = model.Stats{Token: "ETH", BucketHours1: model.Bucket{Count: 7}}
+	eng.statsData[model.Topic("ETH", model.ViewConfirmed)] = model.Stats{Token: "ETH", BucketHours1: model.Bucket{Count: 3}}
+	client := newTestClient(t, eng, webSocket.NewHub())
+
+	for view, want := range map[statspb.View]uint64{statspb.View_VIEW_PENDING: 7, statspb.View_VIEW_CONFIRMED: 3} {
+		resp, err := client.GetBatchStats(context.Background(), &statspb.GetBatchStatsRequest{
+			Tokens: []string{"BTC", "ETH"},
+			View:   view,
+		})
+		if err != nil {
+			t.Fatalf("GetBatchStats(%s) returned error: %v", view, err)
+		}
+		for _, st := range resp.GetStats() {
+			if st.GetView() != view {
+				t.Errorf("Expected %s stats of %s, got %s", view, st.GetToken(), st.GetView())
+			}
+		}
+		if got := resp.GetStats()[1].GetHours_1().GetTransactionCount(); got != want {
+			t.Errorf("Expected %d %s ETH transactions in 1 hour, got %d", want, view, got)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	hub := webSocket.NewHub()
+	client := newTestClient(t, newMockEngine(), hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &statspb.SubscribeRequest{Tokens: []string{"BTC"}})
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+
+	u, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive snapshot: %v", err)
+	}
+	if u.GetType() != statspb.StatsUpdate_TYPE_SNAPSHOT || u.GetStats().GetToken() != "BTC" {
+		t.Fatalf("Expected BTC snapshot, got %v", u)
+	}
+
+	// stream subscribes in its own goroutine, broadcast until the update arrives
+	go func() {
+		for i := uint64(1); ctx.Err() == nil; i++ {
+			hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: i}})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	for {
+		u, err = stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive update: %v", err)
+		}
+		if u.GetType() == statspb.StatsUpdate_TYPE_DELTA {
+			break
+		}
+	}
+	if u.GetSeq() < 2 || u.GetDelta().GetMinutes_5().GetTransactionCount() != 1 {
+		t.Errorf("Expected delta of 1 transaction after seq 1, got %v", u)
+	}
+}
+
+func TestSubscribeView(t *testing.T) {
+	for _, view := range []statspb.View{statspb.View_VIEW_PENDING, statspb.View_VIEW_CONFIRMED} {
+		t.Run(view.String(), func(t *testing.T) {
+			hub := webSocket.NewHub()
+			client := newTestClient(t, newMockEngine(), hub)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			stream, err := client.Subscribe(ctx, &statspb.SubscribeRequest{Tokens: []string{"BTC"}, View: view})
+			if err != nil {
+				t.Fatalf("Subscribe() returned error: %v", err)
+			}
+
+			u, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Failed to receive snapshot: %v", err)
+			}
+			if u.GetView() != view || u.GetStats().GetView() != view {
+				t.Fatalf("Expected %s snapshot, got %v", view, u)
+			}
+
+			// only the broadcast of the subscribed view reaches the stream
+			want, other := model.ViewPending, model.ViewConfirmed
+			if view == statspb.View_VIEW_CONFIRMED {
+				want, other = other, want
+			}
+			go func() {
+				for i := uint64(1); ctx.Err() == nil; i++ {
+					hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", View: other, BucketMinutes5: model.Bucket{Count: 100 * i}})
+					hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", View: want, BucketMinutes5: model.Bucket{Count: i}})
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+
+			for {
+				u, err = stream.Recv()
+				if err != nil {
+					t.Fatalf("Failed to receive update: %v", err)
+				}
+				if u.GetType() == statspb.StatsUpdate_TYPE_DELTA {
+					break
+				}
+			}
+			if u.GetView() != view || u.GetDelta().GetMinutes_5().GetTransactionCount() != 1 {
+				t.Errorf("Expected %s delta of 1 transaction, got %v", view, u)
+			}
+		})
+	}
+
+	client := newTestClient(t, newMockEngine(), webSocket.NewHub())
+	stream, err := client.Subscribe(context.Background(), &statspb.SubscribeRequest{Tokens: []string{"BTC"}, View: statspb.View(9)})
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for unknown view, got %v", err)
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	hub := webSocket.NewHub()
+	for i := uint64(1); i <= 3; i++ {
+		hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: i}})
+	}
+	client := newTestClient(t, newMockEngine(), hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &statspb.SubscribeRequest{
+		Tokens: []string{"BTC"},
+		Since:  map[string]uint64{"BTC": 1},
+		Epoch:  hub.Options().Epoch,
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+
+	for _, want := range []uint64{2, 3} {
+		u, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive update: %v", err)
+		}
+		if u.GetType() != statspb.StatsUpdate_TYPE_DELTA || u.GetSeq() != want {
+			t.Errorf("Expected replayed delta #%d, got %v #%d", want, u.GetType(), u.GetSeq())
+		}
+		if u.GetEpoch() != hub.Options().Epoch {
+			t.Errorf("Expected epoch %q, got %q", hub.Options().Epoch, u.GetEpoch())
+		}
+	}
+}
+
+func TestSubscribeHubShutdown(t *testing.T) {
+	hub := webSocket.NewHub()
+	client := newTestClient(t, newMockEngine(), hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &statspb.SubscribeRequest{Tokens: []string{"BTC"}})
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+	// snapshot is queued once the client is subscribed
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Failed to receive snapshot: %v", err)
+	}
+
+	if n := hub.Shutdown(context.Background()); n != 1 {
+		t.Fatalf("Expected 1 client closed, got %d", n)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable on shutdown, got %v", err)
+	}
+}
+
+func TestSubscribeMissingTokens(t *testing.T) {
+	client := newTestClient(t, newMockEngine(), webSocket.NewHub())
+
+	stream, err := client.Subscribe(context.Background(), &statspb.SubscribeRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	client := statspb.NewIngestServiceClient(dialTestServer(t, newMockEngine(), webSocket.NewHub()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := client.Ingest(ctx)
+	if err != nil {
+		t.Fatalf("Ingest() returned error: %v", err)
+	}
+
+	now := timestamppb.Now()
+	events := []*statspb.SwapEvent{
+		{EventId: "ev-1", TokenId: "BTC", Amount: 1, Usd: 100, Side: "buy", Rate: 100, ExecutedAt: now},
+		{EventId: "ev-1", TokenId: "BTC", Amount: 1, Usd: 100, Side: "buy", Rate: 100, ExecutedAt: now},
+		{EventId: "ev-2", TokenId: "BTC", Side: "buy"}, // no executed_at
+	}
+	want := []statspb.IngestResult_Result{
+		statspb.IngestResult_RESULT_APPLIED,
+		statspb.IngestResult_RESULT_DUPLICATE,
+		statspb.IngestResult_RESULT_REJECTED,
+	}
+
+	for i, ev := range events {
+		if err := stream.Send(ev); err != nil {
+			t.Fatalf("Failed to send event: %v", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive result: %v", err)
+		}
+		if res.GetEventId() != ev.GetEventId() || res.GetResult() != want[i] {
+			t.Errorf("Expected %s for %s, got %s for %s", want[i], ev.GetEventId(), res.GetResult(), res.GetEventId())
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() returned error: %v", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Expected EOF after CloseSend, got %v", err)
+	}
+}
+
+func TestIngestOverloaded(t *testing.T) {
+	eng := newMockEngine()
+	eng.applyWait = make(chan struct{})
+	ing := ingest.New(eng, 1, 10*time.Millisecond)
+	client := statspb.NewIngestServiceClient(dialServer(t, NewServer(eng, webSocket.NewHub(), ing)))
+
+	// the only slot is taken by a slow apply
+	go func() {
+		_, _ = ing.Ingest(context.Background(), model.SwapEvent{EventID: "ev-0", TokenID: "BTC", Side: model.Buy,
+			ExecutedAt: time.Now()})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := client.Ingest(ctx)
+	if err != nil {
+		t.Fatalf("Ingest() returned error: %v", err)
+	}
+	now := timestamppb.Now()
+	if err := stream.Send(&statspb.SwapEvent{EventId: "ev-1", TokenId: "BTC", Amount: 1, Usd: 1, Side: "buy", ExecutedAt: now}); err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Expected the stream to go on, got %v", err)
+	}
+	if res.GetEventId() != "ev-1" || res.GetResult() != statspb.IngestResult_RESULT_OVERLOADED {
+		t.Errorf("Expected ev-1 overloaded, got %s for %s", res.GetResult(), res.GetEventId())
+	}
+
+	// the producer resends it once the engine caught up
+	close(eng.applyWait)
+	time.Sleep(20 * time.Millisecond)
+	if err := stream.Send(&statspb.SwapEvent{EventId: "ev-1", TokenId: "BTC", Amount: 1, Usd: 1, Side: "buy", ExecutedAt: now}); err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	if res, err := stream.Recv(); err != nil || res.GetResult() != statspb.IngestResult_RESULT_APPLIED {
+		t.Errorf("Expected ev-1 applied on resend, got %v, %v", res.GetResult(), err)
+	}
+}
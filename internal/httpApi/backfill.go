@@ -0,0 +1,48 @@
+package httpApi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/backfill"
+)
+
+// Backfiller recomputes a range of a token from history, implemented by backfill.Backfiller
+type Backfiller interface {
+	Run(ctx context.Context, token string, from, to time.Time) (backfill.Result, error)
+}
+
+// WithBackfill enables POST /admin/backfill
+func WithBackfill(b Backfiller) Option {
+	return func(s *server) { s.backfill = b }
+}
+
+// handleBackfill replaces buckets of token in [from, to) with the history,
+// to defaults to the start of the current minute which the producer may still be writing
+func (s *server) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, q.Get("from"))
+	if err != nil {
+		http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	to := time.Now().UTC().Truncate(time.Minute)
+	if raw := q.Get("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := s.backfill.Run(r.Context(), q.Get("token"), from, to)
+	switch {
+	case errors.Is(err, backfill.ErrBadRange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, "backfill failed: "+err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, res)
+	}
+}
@@ -0,0 +1,71 @@
+package httpApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/backfill"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+type mockBackfiller struct {
+	err      error
+	from, to time.Time
+}
+
+func (m *mockBackfiller) Run(_ context.Context, token string, from, to time.Time) (backfill.Result, error) {
+	m.from, m.to = from, to
+	return backfill.Result{Token: token, From: from, To: to, Swaps: 4}, m.err
+}
+
+func TestBackfillHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		expected int
+	}{
+		{"range", "token=BTC&from=2026-03-10T12:00:00Z&to=2026-03-10T13:00:00Z", nil, http.StatusOK},
+		{"until now", "token=BTC&from=2026-03-10T12:00:00Z", nil, http.StatusOK},
+		{"no from", "token=BTC", nil, http.StatusBadRequest},
+		{"bad to", "token=BTC&from=2026-03-10T12:00:00Z&to=soon", nil, http.StatusBadRequest},
+		{"bad range", "token=BTC&from=2026-03-10T12:00:00Z", fmt.Errorf("%w: too long", backfill.ErrBadRange), http.StatusBadRequest},
+		{"source fails", "token=BTC&from=2026-03-10T12:00:00Z", errors.New("db is down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &mockBackfiller{err: tt.err}
+			server := NewServer(newMockEngine(), webSocket.NewHub(), nil, WithBackfill(b))
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/backfill?"+tt.query, nil))
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+			var res backfill.Result
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil || res.Swaps != 4 {
+				t.Errorf("Expected backfill result, got %+v, %v", res, err)
+			}
+			if b.to.IsZero() || b.to.Second() != 0 {
+				t.Errorf("Expected the range to end on a minute, got %v", b.to)
+			}
+		})
+	}
+}
+
+func TestBackfillHandlerReadOnly(t *testing.T) {
+	server := NewServer(newMockEngine(), webSocket.NewHub(), nil, WithReadOnly(), WithBackfill(&mockBackfiller{}))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/backfill?token=BTC&from=2026-03-10T12:00:00Z", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected replicas to not backfill, got %d", w.Code)
+	}
+}
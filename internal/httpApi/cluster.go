@@ -0,0 +1,102 @@
+package httpApi
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/cluster"
+)
+
+// Cluster tells which instance owns a token
+type Cluster interface {
+	Owner(token string) (cluster.Member, bool)
+	Self() cluster.Member
+}
+
+// WithCluster proxies token requests to the instance owning the token
+func WithCluster(c Cluster) Option {
+	return func(s *server) { s.cluster = c }
+}
+
+// routed serves h locally if this instance owns ?token= or every one of ?tokens=,
+// otherwise proxies the request to the owner. Tokens of a stream owned by different instances are refused,
+// the client opens a stream per owner. Proxied requests are always served by the receiver,
+// so they never bounce during a rebalance.
+// Long-lived streams lift the server WriteTimeout, see streamWriter.
+func (s *server) routed(h http.Handler, stream bool) http.Handler {
+	if s.cluster == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens := parseTokens(r.URL.Query().Get("tokens"))
+		if token := r.URL.Query().Get("token"); token != "" {
+			tokens = []string{token}
+		}
+		if len(tokens) == 0 || r.Header.Get(cluster.ForwardedHeader) != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		self := s.cluster.Self()
+		owner, ok := s.cluster.Owner(tokens[0])
+		for _, token := range tokens[1:] {
+			if other, otherOK := s.cluster.Owner(token); otherOK != ok || other.ID != owner.ID {
+				http.Error(w, "tokens are owned by different instances, open a stream per owner", http.StatusBadRequest)
+				return
+			}
+		}
+		token := strings.Join(tokens, ",")
+		if !ok || owner.ID == self.ID {
+			h.ServeHTTP(w, r)
+			return
+		}
+		target, err := url.Parse(owner.Addr)
+		if err != nil || owner.Addr == "" {
+			http.Error(w, "owner of token has no address", http.StatusBadGateway)
+			return
+		}
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+				pr.Out.Header.Set(cluster.ForwardedHeader, self.ID)
+			},
+			ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+				log.Printf("[error] Failed to proxy token %s to %s: %v", token, owner.ID, err)
+				http.Error(w, "owner of token is unavailable", http.StatusBadGateway)
+			},
+		}
+		if stream {
+			// server WriteTimeout is meant for short requests: upgraded connections get no deadline,
+			// the owner pings through them, and every proxied SSE write gets its own deadline
+			// a writer without deadlines has nothing to lift
+			rc := http.NewResponseController(w)
+			if err := rc.SetWriteDeadline(time.Time{}); err == nil {
+				w = &streamWriter{ResponseWriter: w, rc: rc, timeout: s.wsHub.Options().WriteTimeout}
+			}
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// streamWriter extends the write deadline before every write of a proxied stream,
+// flush and hijack reach the underlying writer through Unwrap
+type streamWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if err := w.rc.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
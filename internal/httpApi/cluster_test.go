@@ -0,0 +1,153 @@
+package httpApi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/cluster"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+type mockCluster struct {
+	owners map[string]cluster.Member
+}
+
+func (m *mockCluster) Self() cluster.Member { return cluster.Member{ID: "self"} }
+
+func (m *mockCluster) Owner(token string) (cluster.Member, bool) {
+	owner, ok := m.owners[token]
+	return owner, ok
+}
+
+func TestStatsProxiedToOwner(t *testing.T) {
+	var forwardedBy string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(cluster.ForwardedHeader)
+		_ = json.NewEncoder(w).Encode(model.Stats{Token: r.URL.Query().Get("token") + "-remote"})
+	}))
+	defer owner.Close()
+
+	mockEng := newMockEngine()
+	c := &mockCluster{owners: map[string]cluster.Member{
+		"BTC": {ID: "other", Addr: owner.URL},
+		"ETH": {ID: "self"},
+	}}
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second), WithCluster(c))
+
+	tests := []struct {
+		token     string
+		forwarded bool
+		expected  string
+	}{
+		{"BTC", false, "BTC-remote"},
+		{"ETH", false, "ETH"},
+		{"BTC", true, "BTC"}, // already proxied once, served locally
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/stats?token="+tt.token, nil)
+		if tt.forwarded {
+			req.Header.Set(cluster.ForwardedHeader, "other")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", tt.token, w.Code)
+		}
+		var st model.Stats
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatalf("Failed to decode stats: %v", err)
+		}
+		if st.Token != tt.expected {
+			t.Errorf("Expected token %s, got %s", tt.expected, st.Token)
+		}
+	}
+	if forwardedBy != "self" {
+		t.Errorf("Expected forwarded header self, got %q", forwardedBy)
+	}
+}
+
+func TestStatsOwnerUnavailable(t *testing.T) {
+	mockEng := newMockEngine()
+	c := &mockCluster{owners: map[string]cluster.Member{"BTC": {ID: "other", Addr: "http://127.0.0.1:1"}}}
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second), WithCluster(c))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats?token=BTC", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", w.Code)
+	}
+}
+
+func TestStreamRoutedToOwner(t *testing.T) {
+	var proxied string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/event-stream")
+	}))
+	defer owner.Close()
+
+	mockEng := newMockEngine()
+	c := &mockCluster{owners: map[string]cluster.Member{
+		"BTC": {ID: "other", Addr: owner.URL},
+		"SOL": {ID: "other", Addr: owner.URL},
+		"ETH": {ID: "self"},
+	}}
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second), WithCluster(c))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream?tokens=BTC,SOL", nil))
+	if w.Code != http.StatusOK || proxied != "tokens=BTC,SOL" {
+		t.Errorf("Expected stream of tokens of one owner proxied, got status %d, query %q", w.Code, proxied)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream?tokens=BTC,ETH", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for tokens of different owners, got %d", w.Code)
+	}
+}
+
+func TestProxiedStreamOutlivesWriteTimeout(t *testing.T) {
+	const events = 10
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= events; i++ {
+			_, _ = fmt.Fprintf(w, "data: %d\n\n", i)
+			_ = http.NewResponseController(w).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer owner.Close()
+
+	mockEng := newMockEngine()
+	c := &mockCluster{owners: map[string]cluster.Member{"BTC": {ID: "other", Addr: owner.URL}}}
+	front := httptest.NewUnstartedServer(NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second), WithCluster(c)))
+	front.Config.WriteTimeout = 150 * time.Millisecond
+	front.Start()
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/stream?tokens=BTC")
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer resp.Body.Close()
+	var last string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			last = data
+		}
+	}
+	if last != strconv.Itoa(events) {
+		t.Errorf("Expected every event past the write timeout, last one was %q", last)
+	}
+}
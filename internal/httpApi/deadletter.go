@@ -0,0 +1,125 @@
+package httpApi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"Dexcelerate_swap_stats/internal/deadletter"
+	"Dexcelerate_swap_stats/internal/ingest"
+)
+
+const (
+	defaultDeadLetterPage = 100
+	maxDeadLetterPage     = 1000
+)
+
+type deadLetterPage struct {
+	Entries []deadletter.Entry `json:"entries"`
+	Next    string             `json:"next,omitempty"` // pass as after to get the next page
+}
+
+type redriveResult struct {
+	ID string `json:"id"`
+	ingest.Outcome
+}
+
+// handleDeadLetterList pages through entries with ?after=<id>&limit=<n>
+func (s *server) handleDeadLetterList(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeadLetterPage
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(v, maxDeadLetterPage)
+	}
+
+	entries, err := s.dlq.List(r.Context(), r.URL.Query().Get("after"), limit)
+	if err != nil {
+		deadLetterError(w, err)
+		return
+	}
+	page := deadLetterPage{Entries: entries}
+	if page.Entries == nil {
+		page.Entries = []deadletter.Entry{}
+	}
+	if len(entries) == limit {
+		page.Next = entries[len(entries)-1].ID
+	}
+	writeJSON(w, page)
+}
+
+func (s *server) handleDeadLetterGet(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.deadLetter(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, entry)
+}
+
+func (s *server) handleDeadLetterDelete(w http.ResponseWriter, r *http.Request) {
+	if err := s.dlq.Delete(r.Context(), r.PathValue("id")); err != nil {
+		deadLetterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeadLetterRedrive ingests the event again, so it reaches the owner of its token, and removes the entry.
+// If it fails again it is dead-lettered under a new id with the fresh reason.
+// The entry is kept when nobody handled the event: the request was cancelled,
+// the ingestor is overloaded or the owner couldn't be reached.
+func (s *server) handleDeadLetterRedrive(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.deadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	out, err := s.ingestor.Ingest(r.Context(), entry.Event)
+	switch {
+	case errors.Is(err, ingest.ErrOverloaded):
+		w.Header().Set("Retry-After", strconv.Itoa(ingestRetryAfter))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, "redrive interrupted: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	case out.Unrouted:
+		http.Error(w, "redrive failed: "+out.Error, http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.dlq.Delete(r.Context(), entry.ID); err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, redriveResult{ID: entry.ID, Outcome: out})
+}
+
+func (s *server) deadLetter(w http.ResponseWriter, r *http.Request) (deadletter.Entry, bool) {
+	entry, err := s.dlq.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		deadLetterError(w, err)
+		return deadletter.Entry{}, false
+	}
+	return entry, true
+}
+
+func deadLetterError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, deadletter.ErrInvalidID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, deadletter.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,175 @@
+package httpApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/deadletter"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+func newDeadLetterServer(t *testing.T, eng *mockEngine) (http.Handler, *deadletter.Queue) {
+	t.Helper()
+	store, err := deadletter.OpenFileStore(filepath.Join(t.TempDir(), "deadletter.ndjson"))
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	q := deadletter.NewQueue(store, time.Second)
+	return NewServer(eng, webSocket.NewHub(), ingest.New(eng, 1, time.Second), WithDeadLetters(q)), q
+}
+
+func TestDeadLetterListAndGet(t *testing.T) {
+	server, q := newDeadLetterServer(t, newMockEngine())
+	q.Fail(model.SwapEvent{EventID: "ev-1", TokenID: "BTC"}, errors.New("redis is down"))
+	q.Fail(model.SwapEvent{EventID: "ev-2", TokenID: "BTC"}, errors.New("redis is down"))
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/deadletters?limit=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var page deadLetterPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Event.EventID != "ev-1" {
+		t.Fatalf("Expected ev-1 on first page, got %+v", page.Entries)
+	}
+	if page.Next != page.Entries[0].ID {
+		t.Errorf("Expected next %q, got %q", page.Entries[0].ID, page.Next)
+	}
+
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/deadletters/"+page.Entries[0].ID, nil))
+	var entry deadletter.Entry
+	if err := json.NewDecoder(rr.Body).Decode(&entry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if entry.Reason != "redis is down" || entry.Kind != deadletter.KindFailed {
+		t.Errorf("Expected failed entry with reason, got %+v", entry)
+	}
+
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/deadletters/999", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestDeadLetterStatusCodes(t *testing.T) {
+	server, _ := newDeadLetterServer(t, newMockEngine())
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/admin/deadletters/abc", http.StatusBadRequest},
+		{http.MethodDelete, "/admin/deadletters/abc", http.StatusBadRequest},
+		{http.MethodPost, "/admin/deadletters/abc/redrive", http.StatusBadRequest},
+		{http.MethodGet, "/admin/deadletters?after=abc", http.StatusBadRequest},
+		{http.MethodGet, "/admin/deadletters/999", http.StatusNotFound},
+		{http.MethodDelete, "/admin/deadletters/999", http.StatusNotFound},
+		{http.MethodPost, "/admin/deadletters/999/redrive", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.code {
+			t.Errorf("Expected status %d for %s %s, got %d", tt.code, tt.method, tt.path, rr.Code)
+		}
+	}
+}
+
+func TestDeadLetterRedrive(t *testing.T) {
+	eng := newMockEngine()
+	server, q := newDeadLetterServer(t, eng)
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Side: model.Buy, ExecutedAt: time.Now()}
+	q.Fail(ev, errors.New("redis is down"))
+	entries, _ := q.List(context.Background(), "", 10)
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/deadletters/"+entries[0].ID+"/redrive", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var res redriveResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.Result != ingest.ResultApplied || res.Error != "" {
+		t.Errorf("Expected applied without error, got %+v", res)
+	}
+	if !eng.applied["ev-1"] {
+		t.Error("Expected ev-1 applied by the engine")
+	}
+	if _, err := q.Get(context.Background(), entries[0].ID); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("Expected entry removed after redrive, got %v", err)
+	}
+}
+
+func TestDeadLetterRoutesDisabled(t *testing.T) {
+	eng := newMockEngine()
+	server := NewServer(eng, webSocket.NewHub(), ingest.New(eng, 1, time.Second))
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/deadletters", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+type unreachableOwner struct{}
+
+func (unreachableOwner) Owns(string) bool { return false }
+
+func (unreachableOwner) Forward(context.Context, model.SwapEvent) (ingest.Outcome, error) {
+	return ingest.Outcome{}, errors.New("connection refused")
+}
+
+func TestDeadLetterRedriveKeepsUnhandledEntry(t *testing.T) {
+	store, err := deadletter.OpenFileStore(filepath.Join(t.TempDir(), "deadletter.ndjson"))
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	defer store.Close()
+	q := deadletter.NewQueue(store, time.Second)
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Side: model.Buy, ExecutedAt: time.Now()}
+	q.Fail(ev, errors.New("redis is down"))
+	entries, _ := q.List(context.Background(), "", 10)
+	path := "/admin/deadletters/" + entries[0].ID + "/redrive"
+
+	eng := newMockEngine()
+	server := NewServer(eng, webSocket.NewHub(), ingest.New(eng, 1, time.Second), WithDeadLetters(q))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil).WithContext(ctx))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for cancelled redrive, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if _, err := q.Get(context.Background(), entries[0].ID); err != nil {
+		t.Errorf("Expected entry kept after cancelled redrive, got %v", err)
+	}
+
+	routed := ingest.New(eng, 1, time.Second, ingest.WithRouter(unreachableOwner{}))
+	server = NewServer(eng, webSocket.NewHub(), routed, WithDeadLetters(q))
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for unreachable owner, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if _, err := q.Get(context.Background(), entries[0].ID); err != nil {
+		t.Errorf("Expected entry kept when owner is unreachable, got %v", err)
+	}
+	if eng.applied["ev-1"] {
+		t.Error("Expected ev-1 not applied on a non-owner")
+	}
+}
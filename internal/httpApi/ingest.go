@@ -0,0 +1,105 @@
+package httpApi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"Dexcelerate_swap_stats/internal/cluster"
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const (
+	maxIngestBody    = 8 << 20 // 8MB per batch
+	maxIngestLine    = 64 << 10
+	ingestRetryAfter = 1 // seconds
+)
+
+type ingestResult struct {
+	Line int `json:"line"`
+	ingest.Outcome
+}
+
+// ingestStop is the last record of a batch which was not processed to the end,
+// Line is the first line which was not applied, it has no result
+type ingestStop struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// handleIngest applies NDJSON batch of swaps and answers with NDJSON result per line.
+// If the engine falls behind or the batch can't be read, processing stops with 429 or 4xx:
+// results of processed lines are still answered and the last record tells where it stopped,
+// the producer retries the rest later, duplicates are filtered by dedupe.
+func (s *server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxIngestBody)
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 4096), maxIngestLine)
+
+	ctx := r.Context()
+	if r.Header.Get(cluster.ForwardedHeader) != "" {
+		// another instance routed the batch here, don't route it again
+		ctx = ingest.Local(ctx)
+	}
+
+	code := http.StatusOK
+	var results []ingestResult
+	var stop *ingestStop
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var ev model.SwapEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			results = append(results, ingestResult{Line: line, Outcome: ingest.Outcome{
+				Result: ingest.ResultRejected,
+				Error:  "invalid json: " + err.Error(),
+			}})
+			continue
+		}
+		out, err := s.ingestor.Ingest(ctx, ev)
+		if err != nil {
+			if errors.Is(err, ingest.ErrOverloaded) {
+				code = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", strconv.Itoa(ingestRetryAfter))
+				stop = &ingestStop{Line: line, Error: err.Error()}
+				break
+			}
+			// request is cancelled, nobody reads the answer
+			return
+		}
+		results = append(results, ingestResult{Line: line, Outcome: out})
+	}
+	if err := sc.Err(); err != nil && stop == nil {
+		var tooLarge *http.MaxBytesError
+		code = http.StatusBadRequest
+		stop = &ingestStop{Line: line + 1, Error: "failed to read batch: " + err.Error()}
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+			stop.Error = "batch too large"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	for _, res := range results {
+		_ = enc.Encode(res)
+	}
+	if stop != nil {
+		_ = enc.Encode(stop)
+	}
+}
@@ -0,0 +1,147 @@
+package httpApi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/ingest"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+func readIngestResults(t *testing.T, body string) []ingestResult {
+	t.Helper()
+	var out []ingestResult
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		var res ingestResult
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			t.Fatalf("Failed to parse result line %q: %v", sc.Text(), err)
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+func TestIngestHandler(t *testing.T) {
+	mockEng := newMockEngine()
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	batch := strings.Join([]string{
+		`{"event_id":"ev-1","token_id":"BTC","amount":1,"usd":100,"side":"buy","rate":100,"executed_at":"` + now + `"}`,
+		`{"event_id":"ev-1","token_id":"BTC","amount":1,"usd":100,"side":"buy","rate":100,"executed_at":"` + now + `"}`,
+		``,
+		`{"event_id":"ev-2","token_id":"","side":"sell","executed_at":"` + now + `"}`,
+		`not json`,
+	}, "\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(batch))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %s", ct)
+	}
+
+	results := readIngestResults(t, w.Body.String())
+	want := []struct {
+		line   int
+		result ingest.Result
+	}{
+		{1, ingest.ResultApplied},
+		{2, ingest.ResultDuplicate},
+		{4, ingest.ResultRejected},
+		{5, ingest.ResultRejected},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(results))
+	}
+	for i, w := range want {
+		if results[i].Line != w.line || results[i].Result != w.result {
+			t.Errorf("Expected line %d %s, got line %d %s", w.line, w.result, results[i].Line, results[i].Result)
+		}
+	}
+}
+
+func TestIngestHandlerOverloaded(t *testing.T) {
+	mockEng := newMockEngine()
+	mockEng.applyWait = make(chan struct{})
+	ing := ingest.New(mockEng, 1, 10*time.Millisecond)
+	server := NewServer(mockEng, webSocket.NewHub(), ing)
+
+	// the only slot is taken by a slow apply
+	go func() {
+		_, _ = ing.Ingest(context.Background(), model.SwapEvent{
+			EventID:    "ev-0",
+			TokenID:    "BTC",
+			Side:       model.Buy,
+			ExecutedAt: time.Now(),
+		})
+	}()
+	defer close(mockEng.applyWait)
+	time.Sleep(20 * time.Millisecond)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := `{"event_id":"ev-1","token_id":"BTC","side":"buy","executed_at":"` + now + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+	results := readIngestResults(t, w.Body.String())
+	if len(results) != 1 || results[0].Line != 1 || results[0].Result != "" || results[0].Error == "" {
+		t.Errorf("Expected a stop record at line 1, got %+v", results)
+	}
+}
+
+func TestIngestHandlerKeepsResultsOnReadError(t *testing.T) {
+	mockEng := newMockEngine()
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	batch := `{"event_id":"ev-1","token_id":"BTC","amount":1,"usd":100,"side":"buy","rate":100,"executed_at":"` + now + `"}` +
+		"\n" + strings.Repeat("x", maxIngestLine+1) + "\n"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(batch)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	results := readIngestResults(t, w.Body.String())
+	if len(results) != 2 {
+		t.Fatalf("Expected a result and a stop record, got %+v", results)
+	}
+	if results[0].Line != 1 || results[0].Result != ingest.ResultApplied {
+		t.Errorf("Expected line 1 applied, got %+v", results[0])
+	}
+	if results[1].Line != 2 || results[1].Result != "" || results[1].Error == "" {
+		t.Errorf("Expected a stop record at line 2, got %+v", results[1])
+	}
+}
+
+func TestIngestHandlerMethodNotAllowed(t *testing.T) {
+	mockEng := newMockEngine()
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ingest", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
@@ -1,33 +1,72 @@
 package httpApi
 
 import (
+	"context"
 	"encoding/json"
+	"expvar"
 	"net/http"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/deadletter"
 	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/ingest"
 	"Dexcelerate_swap_stats/internal/model"
 	"Dexcelerate_swap_stats/internal/webSocket"
 )
 
 type EngineInterface interface {
 	Stats(token string, now time.Time) model.Stats
-	Load() error
-	Apply(ev model.SwapEvent) (bool, error)
-	StartPeriodicUpdates()
+	StatsView(token string, view model.View, now time.Time) model.Stats
+	Load(ctx context.Context) error
+	Apply(ctx context.Context, ev model.SwapEvent) (bool, error)
+	Retract(ctx context.Context, r model.Retraction) (int, error)
+	Confirm(ctx context.Context, block uint64) (int, error)
+	StartPeriodicUpdates(ctx context.Context)
 }
 
 type server struct {
-	engine EngineInterface
-	wsHub  *webSocket.Hub
-	mux    *http.ServeMux
+	engine    EngineInterface
+	wsHub     *webSocket.Hub
+	ingestor  *ingest.Ingestor
+	dlq       *deadletter.Queue
+	snapshots Snapshotter
+	backfill  Backfiller
+	cluster   Cluster
+	checks    map[string]ReadinessCheck
+	readOnly  bool
+	mux       *http.ServeMux
 }
 
-func NewServer(engine EngineInterface, wsHub *webSocket.Hub) http.Handler {
+type Option func(*server)
+
+// WithDeadLetters enables /admin/deadletters endpoints backed by q
+func WithDeadLetters(q *deadletter.Queue) Option {
+	return func(s *server) { s.dlq = q }
+}
+
+// ReadinessCheck reports whether a part of the instance is ready and details for /readyz
+type ReadinessCheck func() (bool, any)
+
+// WithReadiness adds a check to /readyz, the instance is ready when all checks pass
+func WithReadiness(name string, check ReadinessCheck) Option {
+	return func(s *server) { s.checks[name] = check }
+}
+
+// WithReadOnly serves only reads, for replicas which don't own the data
+func WithReadOnly() Option {
+	return func(s *server) { s.readOnly = true }
+}
+
+func NewServer(engine EngineInterface, wsHub *webSocket.Hub, ingestor *ingest.Ingestor, opts ...Option) http.Handler {
 	s := &server{
-		engine: engine,
-		wsHub:  wsHub,
-		mux:    http.NewServeMux(),
+		engine:   engine,
+		wsHub:    wsHub,
+		ingestor: ingestor,
+		checks:   make(map[string]ReadinessCheck),
+		mux:      http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.routes()
 	return s.mux
@@ -35,10 +74,34 @@ func NewServer(engine EngineInterface, wsHub *webSocket.Hub) http.Handler {
 
 func (s *server) routes() {
 	s.mux.HandleFunc("/healthz", s.handleHealth)
-	s.mux.HandleFunc("/stats", s.handleStats)
+	s.mux.HandleFunc("/readyz", s.handleReady)
+	s.mux.Handle("/debug/vars", expvar.Handler())
+	s.mux.Handle("/stats", s.routed(http.HandlerFunc(s.handleStats), false))
+	s.mux.Handle("/stream", s.routed(http.HandlerFunc(s.handleStream), true))
+	if !s.readOnly {
+		s.mux.HandleFunc("/ingest", s.handleIngest)
+		s.mux.HandleFunc("POST /retract", s.handleRetract)
+		s.mux.HandleFunc("POST /confirm", s.handleConfirm)
+	}
+
+	if s.dlq != nil && !s.readOnly {
+		s.mux.HandleFunc("GET /admin/deadletters", s.handleDeadLetterList)
+		s.mux.HandleFunc("GET /admin/deadletters/{id}", s.handleDeadLetterGet)
+		s.mux.HandleFunc("DELETE /admin/deadletters/{id}", s.handleDeadLetterDelete)
+		s.mux.HandleFunc("POST /admin/deadletters/{id}/redrive", s.handleDeadLetterRedrive)
+	}
+
+	if s.snapshots != nil && !s.readOnly {
+		s.mux.HandleFunc("POST /admin/snapshot", s.handleSnapshot)
+		s.mux.HandleFunc("POST /admin/restore", s.handleRestore)
+	}
+
+	if s.backfill != nil && !s.readOnly {
+		s.mux.Handle("POST /admin/backfill", s.routed(http.HandlerFunc(s.handleBackfill), false))
+	}
 
 	if realEngine, ok := s.engine.(*engine.Engine); ok {
-		s.mux.Handle("/ws", engine.ServeWS(s.wsHub, realEngine))
+		s.mux.Handle("/ws", s.routed(engine.ServeWS(s.wsHub, realEngine), true))
 	} else {
 		s.mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "WebSocket not supported in test mode", http.StatusNotImplemented)
@@ -51,6 +114,22 @@ func (s *server) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "time": time.Now().UTC()})
 }
 
+// handleReady answers 503 until every readiness check passes
+func (s *server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	ready := true
+	details := make(map[string]any, len(s.checks))
+	for name, check := range s.checks {
+		ok, detail := check()
+		ready = ready && ok
+		details[name] = detail
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"ready": ready, "checks": details})
+}
+
 func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 	if token == "" {
@@ -58,7 +137,55 @@ func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	st := s.engine.Stats(token, time.Now())
+	view, err := model.ParseView(r.URL.Query().Get("view"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	st := s.engine.StatsView(token, view, time.Now())
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(st)
 }
+
+// handleRetract subtracts swaps of an orphaned block, body is model.Retraction
+func (s *server) handleRetract(w http.ResponseWriter, r *http.Request) {
+	var req model.Retraction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BlockNumber == 0 {
+		http.Error(w, "block_number required", http.StatusBadRequest)
+		return
+	}
+
+	n, err := s.engine.Retract(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]int{"retracted": n})
+}
+
+// handleConfirm marks blocks up to block_number final and promotes their swaps to the confirmed view
+func (s *server) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BlockNumber uint64 `json:"block_number"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BlockNumber == 0 {
+		http.Error(w, "block_number required", http.StatusBadRequest)
+		return
+	}
+
+	n, err := s.engine.Confirm(r.Context(), req.BlockNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]int{"promoted": n})
+}
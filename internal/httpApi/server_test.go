@@ -1,6 +1,7 @@
 package httpApi
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -8,40 +9,79 @@ import (
 	"testing"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/ingest"
 	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
 	"Dexcelerate_swap_stats/internal/webSocket"
 )
 
 // Mock engine for testing
 type mockEngine struct {
 	statsData map[string]model.Stats
+	applied   map[string]bool
+	applyErr  error
+	applyWait chan struct{} // if set, Apply blocks until it is closed
+	retracted []model.Retraction
+	confirmed []uint64
 }
 
 func newMockEngine() *mockEngine {
 	return &mockEngine{
 		statsData: make(map[string]model.Stats),
+		applied:   make(map[string]bool),
 	}
 }
 
 func (m *mockEngine) Stats(token string, now time.Time) model.Stats {
-	if stats, exists := m.statsData[token]; exists {
+	return m.StatsView(token, model.ViewPending, now)
+}
+
+func (m *mockEngine) StatsView(token string, view model.View, now time.Time) model.Stats {
+	if stats, exists := m.statsData[model.Topic(token, view)]; exists {
 		return stats
 	}
 	return model.Stats{
 		Token:     token,
+		View:      view,
 		UpdatedAt: now,
 	}
 }
 
-func (m *mockEngine) Load() error {
+func (m *mockEngine) Load(context.Context) error {
 	return nil
 }
 
-func (m *mockEngine) Apply(_ model.SwapEvent) (bool, error) {
+func (m *mockEngine) Apply(ctx context.Context, ev model.SwapEvent) (bool, error) {
+	if err := validation.New(validation.Rules{}).Validate(ev); err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if m.applyWait != nil {
+		<-m.applyWait
+	}
+	if m.applyErr != nil {
+		return false, m.applyErr
+	}
+	if m.applied[ev.EventID] {
+		return false, nil
+	}
+	m.applied[ev.EventID] = true
 	return true, nil
 }
 
-func (m *mockEngine) StartPeriodicUpdates() {
+func (m *mockEngine) Retract(_ context.Context, r model.Retraction) (int, error) {
+	m.retracted = append(m.retracted, r)
+	return 1, nil
+}
+
+func (m *mockEngine) Confirm(_ context.Context, block uint64) (int, error) {
+	m.confirmed = append(m.confirmed, block)
+	return 2, nil
+}
+
+func (m *mockEngine) StartPeriodicUpdates(_ context.Context) {
 	// Mock implementation
 }
 
@@ -49,7 +89,7 @@ func TestNewServer(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
 
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	if server == nil {
 		t.Fatal("NewServer() returned nil")
@@ -59,7 +99,7 @@ func TestNewServer(t *testing.T) {
 func TestHealthHandler(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	w := httptest.NewRecorder()
@@ -90,6 +130,42 @@ func TestHealthHandler(t *testing.T) {
 	}
 }
 
+func TestReadyHandler(t *testing.T) {
+	mockEng := newMockEngine()
+	ready := false
+	server := NewServer(mockEng, webSocket.NewHub(), nil, WithReadOnly(),
+		WithReadiness("replica", func() (bool, any) { return ready, map[string]int{"lag_ms": 10} }))
+
+	for _, tt := range []struct {
+		ready    bool
+		expected int
+	}{{false, http.StatusServiceUnavailable}, {true, http.StatusOK}} {
+		ready = tt.ready
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != tt.expected {
+			t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+		}
+		var response struct {
+			Ready  bool                      `json:"ready"`
+			Checks map[string]map[string]int `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response JSON: %v", err)
+		}
+		if response.Ready != tt.ready || response.Checks["replica"]["lag_ms"] != 10 {
+			t.Errorf("Expected ready=%v with replica lag, got %+v", tt.ready, response)
+		}
+	}
+
+	// read-only server has no write endpoints
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader("{}")))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for ingest on read-only server, got %d", w.Code)
+	}
+}
+
 func TestStatsHandlerSuccess(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
@@ -117,7 +193,7 @@ func TestStatsHandlerSuccess(t *testing.T) {
 
 	mockEng.statsData["BTC"] = expectedStats
 
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/stats?token=BTC", nil)
 	w := httptest.NewRecorder()
@@ -152,7 +228,7 @@ func TestStatsHandlerSuccess(t *testing.T) {
 func TestStatsHandlerMissingToken(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/stats", nil)
 	w := httptest.NewRecorder()
@@ -172,7 +248,7 @@ func TestStatsHandlerMissingToken(t *testing.T) {
 func TestStatsHandlerEmptyToken(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/stats?token=", nil)
 	w := httptest.NewRecorder()
@@ -187,7 +263,7 @@ func TestStatsHandlerEmptyToken(t *testing.T) {
 func TestStatsHandlerUnknownToken(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/stats?token=UNKNOWN", nil)
 	w := httptest.NewRecorder()
@@ -217,7 +293,7 @@ func TestStatsHandlerUnknownToken(t *testing.T) {
 func TestInvalidRoute(t *testing.T) {
 	mockEng := newMockEngine()
 	hub := webSocket.NewHub()
-	server := NewServer(mockEng, hub)
+	server := NewServer(mockEng, hub, ingest.New(mockEng, 1, time.Second))
 
 	req := httptest.NewRequest("GET", "/invalid", nil)
 	w := httptest.NewRecorder()
@@ -228,3 +304,80 @@ func TestInvalidRoute(t *testing.T) {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
+
+func TestRetractHandler(t *testing.T) {
+	mockEng := newMockEngine()
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/retract", strings.NewReader(`{"block_number":7,"block_hash":"0xa"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if len(mockEng.retracted) != 1 || mockEng.retracted[0] != (model.Retraction{BlockNumber: 7, BlockHash: "0xa"}) {
+		t.Errorf("Expected retraction of block 7, got %+v", mockEng.retracted)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"retracted":1}` {
+		t.Errorf("Expected {\"retracted\":1}, got %s", body)
+	}
+
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/retract", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestStatsHandlerView(t *testing.T) {
+	mockEng := newMockEngine()
+	mockEng.statsData["BTC"] = model.Stats{Token: "BTC", View: model.ViewPending, BucketMinutes5: model.Bucket{Count: 5}}
+	mockEng.statsData["BTC@confirmed"] = model.Stats{Token: "BTC", View: model.ViewConfirmed, BucketMinutes5: model.Bucket{Count: 3}}
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	tests := []struct {
+		query string
+		code  int
+		count uint64
+	}{
+		{"token=BTC", http.StatusOK, 5},
+		{"token=BTC&view=pending", http.StatusOK, 5},
+		{"token=BTC&view=confirmed", http.StatusOK, 3},
+		{"token=BTC&view=final", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats?"+tt.query, nil))
+			if rr.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d", tt.code, rr.Code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var st model.Stats
+			if err := json.NewDecoder(rr.Body).Decode(&st); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if st.BucketMinutes5.Count != tt.count {
+				t.Errorf("Expected count %d, got %d", tt.count, st.BucketMinutes5.Count)
+			}
+		})
+	}
+}
+
+func TestConfirmHandler(t *testing.T) {
+	mockEng := newMockEngine()
+	server := NewServer(mockEng, webSocket.NewHub(), ingest.New(mockEng, 1, time.Second))
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/confirm", strings.NewReader(`{"block_number":42}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if len(mockEng.confirmed) != 1 || mockEng.confirmed[0] != 42 {
+		t.Errorf("Expected block 42 confirmed, got %v", mockEng.confirmed)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"promoted":2}` {
+		t.Errorf("Expected {\"promoted\":2}, got %s", body)
+	}
+}
@@ -0,0 +1,46 @@
+package httpApi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+
+	"Dexcelerate_swap_stats/internal/engine"
+)
+
+// Snapshotter saves and restores the engine state, implemented by engine.SnapshotFile
+type Snapshotter interface {
+	Save(ctx context.Context) (engine.SnapshotInfo, error)
+	Restore(ctx context.Context) (engine.SnapshotInfo, error)
+}
+
+// WithSnapshots enables POST /admin/snapshot and POST /admin/restore
+func WithSnapshots(sn Snapshotter) Option {
+	return func(s *server) { s.snapshots = sn }
+}
+
+func (s *server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	info, err := s.snapshots.Save(r.Context())
+	if err != nil {
+		http.Error(w, "snapshot failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, info)
+}
+
+// handleRestore replaces the state with the saved snapshot caught up with the update stream,
+// the state is not changed on error
+func (s *server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	info, err := s.snapshots.Restore(r.Context())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "no snapshot saved", http.StatusNotFound)
+	case errors.Is(err, engine.ErrBadSnapshot):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case err != nil:
+		http.Error(w, "restore failed: "+err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, info)
+	}
+}
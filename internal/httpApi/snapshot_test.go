@@ -0,0 +1,69 @@
+package httpApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+type mockSnapshotter struct {
+	err error
+}
+
+func (m *mockSnapshotter) Save(context.Context) (engine.SnapshotInfo, error) {
+	return engine.SnapshotInfo{Version: engine.SnapshotVersion, Tokens: 3}, m.err
+}
+
+func (m *mockSnapshotter) Restore(context.Context) (engine.SnapshotInfo, error) {
+	return engine.SnapshotInfo{Version: engine.SnapshotVersion, Tokens: 3, CaughtUpTo: "5-0"}, m.err
+}
+
+func TestSnapshotHandlers(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		err      error
+		expected int
+	}{
+		{"snapshot", "/admin/snapshot", nil, http.StatusOK},
+		{"snapshot fails", "/admin/snapshot", errors.New("disk full"), http.StatusInternalServerError},
+		{"restore", "/admin/restore", nil, http.StatusOK},
+		{"restore without file", "/admin/restore", fmt.Errorf("open: %w", os.ErrNotExist), http.StatusNotFound},
+		{"restore bad file", "/admin/restore", fmt.Errorf("%w: checksum mismatch", engine.ErrBadSnapshot), http.StatusUnprocessableEntity},
+		{"restore behind stream", "/admin/restore", errors.New("updates were trimmed"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(newMockEngine(), webSocket.NewHub(), nil, WithSnapshots(&mockSnapshotter{err: tt.err}))
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+			var info engine.SnapshotInfo
+			if err := json.NewDecoder(w.Body).Decode(&info); err != nil || info.Tokens != 3 {
+				t.Errorf("Expected snapshot info, got %+v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotHandlersReadOnly(t *testing.T) {
+	server := NewServer(newMockEngine(), webSocket.NewHub(), nil, WithReadOnly(), WithSnapshots(&mockSnapshotter{}))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/restore", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected replicas to not restore snapshots, got %d", w.Code)
+	}
+}
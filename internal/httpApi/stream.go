@@ -0,0 +1,159 @@
+package httpApi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// handleStream streams the same updates as /ws as text/event-stream for clients
+// behind proxies which break WebSocket upgrades.
+// Event id holds the epoch and last seq of every token of the stream, e.g. "kx3f9a/BTC:42,ETH:17",
+// so a reconnecting EventSource resumes all tokens with Last-Event-ID.
+func (s *server) handleStream(w http.ResponseWriter, r *http.Request) {
+	tokens := parseTokens(r.URL.Query().Get("tokens"))
+	if len(tokens) == 0 {
+		http.Error(w, "tokens required", http.StatusBadRequest)
+		return
+	}
+	view, err := model.ParseView(r.URL.Query().Get("view"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	epoch, since, err := parseEventID(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	opts := s.wsHub.Options()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	client := s.wsHub.NewStreamClient()
+	defer s.wsHub.Unsubscribe(client)
+	now := time.Now()
+	for _, token := range tokens {
+		s.wsHub.Subscribe(client, token, epoch, since[token], s.engine.StatsView(token, view, now))
+	}
+
+	// server WriteTimeout is meant for short requests, every write here has its own deadline
+	write := func(f func() error) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(opts.WriteTimeout)); err != nil {
+			return false
+		}
+		if err := f(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	seqs := make(map[string]uint64, len(tokens))
+	sendQueued := func() bool {
+		for _, env := range client.Take() {
+			seqs[env.Token] = env.Seq
+			if !write(func() error { return writeEvent(w, formatEventID(env.Epoch, seqs), env) }) {
+				return false
+			}
+		}
+		return true
+	}
+	heartbeat := opts.Clock.NewTicker(opts.PingInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.Done():
+			// on shutdown the last updates are still queued
+			sendQueued()
+			return
+		case <-heartbeat.C():
+			if !write(func() error {
+				_, err := fmt.Fprint(w, ": ping\n\n")
+				return err
+			}) {
+				return
+			}
+		case <-client.Wake():
+			if !sendQueued() {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, id string, env model.Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, env.Type, data)
+	return err
+}
+
+// parseTokens splits comma separated tokens, dropping empty and repeated ones
+func parseTokens(raw string) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, token := range strings.Split(raw, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+		out = append(out, token)
+	}
+	return out
+}
+
+func formatEventID(epoch string, seqs map[string]uint64) string {
+	tokens := make([]string, 0, len(seqs))
+	for token := range seqs {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	parts := make([]string, len(tokens))
+	for i, token := range tokens {
+		parts[i] = token + ":" + strconv.FormatUint(seqs[token], 10)
+	}
+	return epoch + "/" + strings.Join(parts, ",")
+}
+
+// parseEventID splits an id written by formatEventID, an id without epoch is resumed with a snapshot
+func parseEventID(raw string) (string, map[string]uint64, error) {
+	out := make(map[string]uint64)
+	epoch, seqs, ok := strings.Cut(raw, "/")
+	if !ok {
+		epoch, seqs = "", raw
+	}
+	if seqs == "" {
+		return epoch, out, nil
+	}
+	for _, part := range strings.Split(seqs, ",") {
+		token, seq, ok := strings.Cut(part, ":")
+		if !ok || token == "" {
+			return "", nil, fmt.Errorf("invalid event id part: %q", part)
+		}
+		v, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			return "", nil, err
+		}
+		out[token] = v
+	}
+	return epoch, out, nil
+}
@@ -0,0 +1,184 @@
+package httpApi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/webSocket"
+)
+
+type sseEvent struct {
+	id      string
+	typ     string
+	data    string
+	comment bool
+}
+
+// openStream connects to /stream and returns a function reading the next event
+func openStream(t *testing.T, url, lastEventID string) func() sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %s", ct)
+	}
+
+	events := make(chan sseEvent, 64)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				events <- ev
+				ev = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				ev.comment = true
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	return func() sseEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("Stream closed")
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for event")
+		}
+		return sseEvent{}
+	}
+}
+
+func decodeEnvelope(t *testing.T, ev sseEvent) model.Envelope {
+	t.Helper()
+	var env model.Envelope
+	if err := json.Unmarshal([]byte(ev.data), &env); err != nil {
+		t.Fatalf("Failed to decode event data %q: %v", ev.data, err)
+	}
+	if string(env.Type) != ev.typ {
+		t.Errorf("Expected event type %s, got %s", env.Type, ev.typ)
+	}
+	return env
+}
+
+func TestStreamHandlerStreamsUpdates(t *testing.T) {
+	hub := webSocket.NewHub()
+	server := httptest.NewServer(NewServer(newMockEngine(), hub, nil))
+	t.Cleanup(server.Close)
+
+	next := openStream(t, server.URL+"/stream?tokens=BTC,ETH,BTC", "")
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		env := decodeEnvelope(t, next())
+		if env.Type != model.MessageSnapshot {
+			t.Errorf("Expected initial snapshot, got %s", env.Type)
+		}
+		seen[env.Token] = true
+	}
+	if !seen["BTC"] || !seen["ETH"] {
+		t.Fatalf("Expected snapshots for BTC and ETH, got %v", seen)
+	}
+
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC"})
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: 3}})
+
+	ev := next()
+	if env := decodeEnvelope(t, ev); env.Seq != 1 {
+		t.Errorf("Expected seq 1, got %d", env.Seq)
+	}
+	ev = next()
+	env := decodeEnvelope(t, ev)
+	if env.Type != model.MessageDelta || env.Delta.BucketMinutes5.Count != 3 {
+		t.Errorf("Expected delta of 3 transactions, got %+v", env)
+	}
+	if ev.id != hub.Options().Epoch+"/BTC:2,ETH:0" {
+		t.Errorf("Expected id to carry seq of every token, got %q", ev.id)
+	}
+}
+
+func TestStreamHandlerResumesFromLastEventID(t *testing.T) {
+	hub := webSocket.NewHub()
+	server := httptest.NewServer(NewServer(newMockEngine(), hub, nil))
+	t.Cleanup(server.Close)
+
+	for i := uint64(1); i <= 3; i++ {
+		hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: i}})
+	}
+
+	next := openStream(t, server.URL+"/stream?tokens=BTC", hub.Options().Epoch+"/BTC:1")
+	for _, want := range []uint64{2, 3} {
+		env := decodeEnvelope(t, next())
+		if env.Type != model.MessageDelta || env.Seq != want {
+			t.Errorf("Expected replayed delta #%d, got %s #%d", want, env.Type, env.Seq)
+		}
+	}
+}
+
+func TestStreamHandlerHeartbeat(t *testing.T) {
+	hub := webSocket.NewHub(webSocket.WithKeepalive(20*time.Millisecond, time.Second))
+	server := httptest.NewServer(NewServer(newMockEngine(), hub, nil))
+	t.Cleanup(server.Close)
+
+	next := openStream(t, server.URL+"/stream?tokens=BTC", "")
+	next() // initial snapshot
+	if ev := next(); !ev.comment {
+		t.Errorf("Expected heartbeat comment, got %+v", ev)
+	}
+}
+
+func TestStreamHandlerBadRequests(t *testing.T) {
+	hub := webSocket.NewHub()
+	handler := NewServer(newMockEngine(), hub, nil)
+
+	tests := []struct {
+		name        string
+		url         string
+		lastEventID string
+	}{
+		{"no tokens", "/stream", ""},
+		{"empty tokens", "/stream?tokens=,,", ""},
+		{"bad last event id", "/stream?tokens=BTC", "e/BTC:x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
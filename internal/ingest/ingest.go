@@ -0,0 +1,157 @@
+// Package ingest lets producers push swaps directly through HTTP and gRPC
+package ingest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
+)
+
+type Result string
+
+const (
+	ResultApplied   Result = "applied"
+	ResultDuplicate Result = "duplicate"
+	ResultRejected  Result = "rejected" // invalid event, retry won't help
+	ResultFailed    Result = "failed"   // engine or storage error, producer should retry
+)
+
+// Outcome is a per-event answer for producers
+type Outcome struct {
+	EventID string `json:"event_id"`
+	Result  Result `json:"result"`
+	Error   string `json:"error,omitempty"`
+	// Unrouted is set when the owner of the token couldn't be reached, no instance handled the event
+	Unrouted bool `json:"-"`
+}
+
+// ErrOverloaded means no apply slot was freed in time, producer should back off
+var ErrOverloaded = errors.New("ingest: engine is overloaded")
+
+// Applier is the part of engine used for ingestion
+type Applier interface {
+	Apply(ctx context.Context, ev model.SwapEvent) (bool, error)
+}
+
+// Router sends events of tokens owned by other instances to their owner
+type Router interface {
+	Owns(token string) bool
+	Forward(ctx context.Context, ev model.SwapEvent) (Outcome, error)
+}
+
+// Ingestor applies pushed events with bounded concurrency,
+// it is shared by all transports so the limit is global for the instance
+type Ingestor struct {
+	engine      Applier
+	slots       chan struct{}
+	waitTimeout time.Duration
+	router      Router
+}
+
+type Option func(*Ingestor)
+
+// WithRouter forwards events of tokens this instance doesn't own
+func WithRouter(r Router) Option {
+	return func(i *Ingestor) { i.router = r }
+}
+
+// New creates Ingestor with at most maxInFlight concurrent applies,
+// a caller waits for a free slot up to waitTimeout before ErrOverloaded
+func New(engine Applier, maxInFlight int, waitTimeout time.Duration, opts ...Option) *Ingestor {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	i := &Ingestor{
+		engine:      engine,
+		slots:       make(chan struct{}, maxInFlight),
+		waitTimeout: waitTimeout,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+type localKey struct{}
+
+// Local marks ctx of an event forwarded by another instance,
+// it is applied here even if ownership moved meanwhile, so events never loop
+func Local(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localKey{}, true)
+}
+
+func isLocal(ctx context.Context) bool {
+	v, _ := ctx.Value(localKey{}).(bool)
+	return v
+}
+
+// Ingest applies a single event, engine validation errors are reported as rejected.
+// Events without id get one derived from chain, tx hash and log index,
+// so retries of the same swap are deduplicated.
+func (i *Ingestor) Ingest(ctx context.Context, ev model.SwapEvent) (Outcome, error) {
+	if ev.EventID == "" && ev.TxHash != "" {
+		ev.EventID = dedupe.EventID(ev)
+	}
+	if i.router != nil && !isLocal(ctx) && !i.router.Owns(ev.TokenID) {
+		out, err := i.router.Forward(ctx, ev)
+		if err != nil && ctx.Err() != nil {
+			return Outcome{EventID: ev.EventID}, ctx.Err()
+		}
+		if errors.Is(err, ErrOverloaded) {
+			return Outcome{EventID: ev.EventID}, err
+		}
+		if err != nil {
+			// owner is unreachable, producer should retry
+			return Outcome{EventID: ev.EventID, Result: ResultFailed, Error: err.Error(), Unrouted: true}, nil
+		}
+		return out, nil
+	}
+	out := Outcome{EventID: ev.EventID}
+	if err := i.acquire(ctx); err != nil {
+		return out, err
+	}
+	applied, err := i.engine.Apply(ctx, ev)
+	<-i.slots
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// cancelled before it was written, nobody reads the outcome
+		return out, err
+	}
+
+	var invalid *validation.Error
+	switch {
+	case errors.As(err, &invalid):
+		out.Result = ResultRejected
+		out.Error = err.Error()
+	case err != nil:
+		out.Result = ResultFailed
+		out.Error = err.Error()
+	case applied:
+		out.Result = ResultApplied
+	default:
+		out.Result = ResultDuplicate
+	}
+	return out, nil
+}
+
+func (i *Ingestor) acquire(ctx context.Context) error {
+	select {
+	case i.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(i.waitTimeout)
+	defer timer.Stop()
+	select {
+	case i.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrOverloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/validation"
+)
+
+type mockApplier struct {
+	mu      sync.Mutex
+	applied map[string]bool
+	err     error
+	wait    chan struct{}
+}
+
+func newMockApplier() *mockApplier {
+	return &mockApplier{applied: make(map[string]bool)}
+}
+
+func (m *mockApplier) Apply(_ context.Context, ev model.SwapEvent) (bool, error) {
+	if err := validation.New(validation.Rules{}).Validate(ev); err != nil {
+		return false, err
+	}
+	if m.wait != nil {
+		<-m.wait
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.applied[ev.EventID] {
+		return false, nil
+	}
+	m.applied[ev.EventID] = true
+	return true, nil
+}
+
+func validEvent(id string) model.SwapEvent {
+	return model.SwapEvent{
+		EventID:    id,
+		TokenID:    "BTC",
+		Amount:     1.0,
+		USD:        50000.0,
+		Side:       model.Buy,
+		Rate:       50000.0,
+		ExecutedAt: time.Now(),
+	}
+}
+
+func TestIngestResults(t *testing.T) {
+	eng := newMockApplier()
+	ing := New(eng, 1, time.Second)
+	ctx := context.Background()
+
+	noToken := validEvent("ev-2")
+	noToken.TokenID = ""
+
+	tests := []struct {
+		name string
+		ev   model.SwapEvent
+		want Result
+	}{
+		{"applied", validEvent("ev-1"), ResultApplied},
+		{"duplicate", validEvent("ev-1"), ResultDuplicate},
+		{"rejected", noToken, ResultRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ing.Ingest(ctx, tt.ev)
+			if err != nil {
+				t.Fatalf("Ingest() returned error: %v", err)
+			}
+			if out.Result != tt.want {
+				t.Errorf("Expected %s, got %s (%s)", tt.want, out.Result, out.Error)
+			}
+			if out.EventID != tt.ev.EventID {
+				t.Errorf("Expected event id %s, got %s", tt.ev.EventID, out.EventID)
+			}
+		})
+	}
+}
+
+func TestIngestEngineError(t *testing.T) {
+	eng := newMockApplier()
+	eng.err = errors.New("redis is down")
+	ing := New(eng, 1, time.Second)
+
+	out, err := ing.Ingest(context.Background(), validEvent("ev-1"))
+	if err != nil {
+		t.Fatalf("Ingest() returned error: %v", err)
+	}
+	if out.Result != ResultFailed || out.Error != "redis is down" {
+		t.Errorf("Expected failed result with engine error, got %+v", out)
+	}
+}
+
+func TestIngestBackpressure(t *testing.T) {
+	eng := newMockApplier()
+	eng.wait = make(chan struct{})
+	ing := New(eng, 1, 20*time.Millisecond)
+
+	// occupy the only slot
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = ing.Ingest(context.Background(), validEvent("ev-1"))
+	}()
+	for len(ing.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := ing.Ingest(context.Background(), validEvent("ev-2"))
+	if !errors.Is(err, ErrOverloaded) {
+		t.Errorf("Expected ErrOverloaded, got %v", err)
+	}
+
+	close(eng.wait)
+	<-done
+	out, err := ing.Ingest(context.Background(), validEvent("ev-2"))
+	if err != nil || out.Result != ResultApplied {
+		t.Errorf("Expected event to be applied after slot is freed, got %+v, %v", out, err)
+	}
+}
+
+func TestIngestDerivesEventID(t *testing.T) {
+	eng := newMockApplier()
+	ing := New(eng, 1, time.Second)
+	ctx := context.Background()
+
+	ev := validEvent("")
+	ev.Chain, ev.TxHash, ev.LogIndex = "ethereum", "0xabc", 1
+	first, err := ing.Ingest(ctx, ev)
+	if err != nil {
+		t.Fatalf("Ingest() returned error: %v", err)
+	}
+	if first.Result != ResultApplied || first.EventID == "" {
+		t.Fatalf("Expected applied with derived id, got %+v", first)
+	}
+
+	// retry of the same swap gets the same id
+	retry, _ := ing.Ingest(ctx, ev)
+	if retry.Result != ResultDuplicate || retry.EventID != first.EventID {
+		t.Errorf("Expected duplicate of %s, got %+v", first.EventID, retry)
+	}
+}
+
+type mockRouter struct {
+	owned     map[string]bool
+	forwarded []string
+	err       error
+}
+
+func (m *mockRouter) Owns(token string) bool { return m.owned[token] }
+
+func (m *mockRouter) Forward(_ context.Context, ev model.SwapEvent) (Outcome, error) {
+	if m.err != nil {
+		return Outcome{}, m.err
+	}
+	m.forwarded = append(m.forwarded, ev.EventID)
+	return Outcome{EventID: ev.EventID, Result: ResultApplied}, nil
+}
+
+func TestIngestRoutesForeignTokens(t *testing.T) {
+	eng := newMockApplier()
+	router := &mockRouter{owned: map[string]bool{"ETH": true}}
+	ing := New(eng, 1, time.Second, WithRouter(router))
+	ctx := context.Background()
+
+	out, err := ing.Ingest(ctx, validEvent("ev-1"))
+	if err != nil || out.Result != ResultApplied {
+		t.Fatalf("Expected forwarded event applied, got %+v, %v", out, err)
+	}
+	if len(router.forwarded) != 1 || eng.applied["ev-1"] {
+		t.Errorf("Expected event of foreign token forwarded, not applied locally")
+	}
+
+	// forwarded events are applied by the receiver, whoever owns the token now
+	if _, err := ing.Ingest(Local(ctx), validEvent("ev-2")); err != nil {
+		t.Fatalf("Ingest() returned error: %v", err)
+	}
+	if !eng.applied["ev-2"] || len(router.forwarded) != 1 {
+		t.Errorf("Expected local event applied without forwarding")
+	}
+
+	router.err = errors.New("connection refused")
+	out, err = ing.Ingest(ctx, validEvent("ev-3"))
+	if err != nil || out.Result != ResultFailed {
+		t.Errorf("Expected failed result when owner is unreachable, got %+v, %v", out, err)
+	}
+	router.err = fmt.Errorf("owner B: %w", ErrOverloaded)
+	if _, err := ing.Ingest(ctx, validEvent("ev-4")); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("Expected ErrOverloaded when owner is overloaded, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+// Package leader elects one instance to run singleton background jobs.
+// The leader holds a Redis lease and renews it, every new lease gets a fencing token
+// which grows monotonically, so writes of a stale leader can be rejected by the resource.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultTTL = 10 * time.Second
+
+// acquires a free lease or renews the one held by the caller,
+// returns {fence, holder}, fence is 0 when the lease is held by another instance
+// KEYS: lease, fence ARGV: id, ttl ms, fence held by the caller (0 if none)
+var acquireScript = redis.NewScript(`
+local mine = ARGV[1] .. "/" .. ARGV[3]
+local cur = redis.call("GET", KEYS[1])
+if not cur then
+  local fence = redis.call("INCR", KEYS[2])
+  local value = ARGV[1] .. "/" .. fence
+  redis.call("SET", KEYS[1], value, "NX", "PX", ARGV[2])
+  return {fence, value}
+end
+if cur == mine then
+  redis.call("PEXPIRE", KEYS[1], ARGV[2])
+  return {tonumber(ARGV[3]), cur}
+end
+return {0, cur}
+`)
+
+// deletes the lease only if it is still held by the caller
+// KEYS: lease ARGV: value
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Job runs while the instance is the leader, ctx is cancelled when leadership is lost.
+// fence identifies the term, pass it to writes which must not be done by a stale leader.
+type Job func(ctx context.Context, fence uint64)
+
+type namedJob struct {
+	name string
+	job  Job
+}
+
+// Status is reported in /readyz
+type Status struct {
+	Self     string `json:"self"`
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"is_leader"`
+	Fence    uint64 `json:"fence,omitempty"`
+}
+
+type Elector struct {
+	cli      *redis.Client
+	leaseKey string
+	fenceKey string
+	id       string
+	ttl      time.Duration
+	renew    time.Duration
+	jobs     []namedJob
+
+	mu        sync.Mutex
+	fence     uint64 // 0 while not the leader
+	leader    string
+	lastRenew time.Time
+	stopJobs  context.CancelFunc
+	running   sync.WaitGroup
+}
+
+type Option func(*Elector)
+
+// WithTTL sets lease time to live, it is renewed three times per ttl
+func WithTTL(ttl time.Duration) Option {
+	return func(e *Elector) {
+		if ttl > 0 {
+			e.ttl, e.renew = ttl, ttl/3
+		}
+	}
+}
+
+func NewElector(cli *redis.Client, prefix, id string, opts ...Option) *Elector {
+	e := &Elector{
+		cli:      cli,
+		leaseKey: prefix + "lease",
+		fenceKey: prefix + "fence",
+		id:       id,
+		ttl:      defaultTTL,
+		renew:    defaultTTL / 3,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Register adds a leader-only job, must be called before Run
+func (e *Elector) Register(name string, job Job) {
+	e.jobs = append(e.jobs, namedJob{name: name, job: job})
+}
+
+// Every makes a job calling fn each interval, errors are logged
+func Every(interval time.Duration, fn func(ctx context.Context, fence uint64) error) Job {
+	return func(ctx context.Context, fence uint64) {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := fn(ctx, fence); err != nil && ctx.Err() == nil {
+					log.Println("[error] Leader job failed:", err)
+				}
+			}
+		}
+	}
+}
+
+// Run campaigns for the lease until ctx is done, then stops jobs and releases the lease
+func (e *Elector) Run(ctx context.Context) error {
+	t := time.NewTicker(e.renew)
+	defer t.Stop()
+	for {
+		e.step(ctx)
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// step acquires or renews the lease and starts or stops jobs accordingly
+func (e *Elector) step(ctx context.Context) {
+	e.mu.Lock()
+	held := e.fence
+	e.mu.Unlock()
+
+	fence, holder, err := e.acquire(ctx, held)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("[error] Leader lease renewal failed:", err)
+		e.mu.Lock()
+		// the lease may be taken by another instance already, stop before it surely expired
+		expired := held != 0 && time.Since(e.lastRenew) >= e.ttl-e.renew
+		e.mu.Unlock()
+		if expired {
+			e.stepDown("lease is not renewed in time")
+		}
+		return
+	}
+
+	e.mu.Lock()
+	e.leader = holder
+	if fence != 0 {
+		e.lastRenew = time.Now()
+	}
+	e.mu.Unlock()
+
+	switch {
+	case fence != 0 && held == 0:
+		e.becomeLeader(ctx, fence)
+	case fence == 0 && held != 0:
+		e.stepDown("lease is held by " + holder)
+	case fence != 0 && fence != held:
+		// the lease expired and was acquired again, jobs of the old term must not outlive it
+		e.stepDown(fmt.Sprintf("term %d expired", held))
+		e.becomeLeader(ctx, fence)
+	}
+}
+
+func (e *Elector) acquire(ctx context.Context, held uint64) (uint64, string, error) {
+	res, err := acquireScript.Run(ctx, e.cli, []string{e.leaseKey, e.fenceKey},
+		e.id, e.ttl.Milliseconds(), held).Slice()
+	if err != nil {
+		return 0, "", err
+	}
+	if len(res) != 2 {
+		return 0, "", fmt.Errorf("unexpected lease result: %v", res)
+	}
+	fence, ok := res[0].(int64)
+	if !ok {
+		return 0, "", fmt.Errorf("unexpected fence: %v", res[0])
+	}
+	value, _ := res[1].(string)
+	holder, _, _ := strings.Cut(value, "/")
+	return uint64(fence), holder, nil
+}
+
+// Holder returns the instance holding the lease under prefix, empty when no instance runs the election
+func Holder(ctx context.Context, cli *redis.Client, prefix string) (string, error) {
+	value, err := cli.Get(ctx, prefix+"lease").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	holder, _, _ := strings.Cut(value, "/")
+	return holder, nil
+}
+
+func (e *Elector) becomeLeader(ctx context.Context, fence uint64) {
+	jobsCtx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.fence, e.stopJobs = fence, cancel
+	e.mu.Unlock()
+	log.Printf("[leader] %s is the leader, fence %d", e.id, fence)
+
+	for _, j := range e.jobs {
+		e.running.Add(1)
+		go func(j namedJob) {
+			defer e.running.Done()
+			log.Println("[leader] Starting job", j.name)
+			j.job(jobsCtx, fence)
+		}(j)
+	}
+}
+
+// stepDown cancels jobs and waits until they return
+func (e *Elector) stepDown(reason string) {
+	e.mu.Lock()
+	stop := e.stopJobs
+	e.fence, e.stopJobs = 0, nil
+	e.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	log.Printf("[leader] %s is not the leader anymore: %s", e.id, reason)
+	stop()
+	e.running.Wait()
+}
+
+// resign steps down and frees the lease, so another instance doesn't wait for it to expire
+func (e *Elector) resign() {
+	e.mu.Lock()
+	fence := e.fence
+	e.mu.Unlock()
+	if fence == 0 {
+		return
+	}
+	e.stepDown("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	value := e.id + "/" + strconv.FormatUint(fence, 10)
+	if err := releaseScript.Run(ctx, e.cli, []string{e.leaseKey}, value).Err(); err != nil {
+		log.Println("[warning] Failed to release leader lease:", err)
+	}
+}
+
+// IsLeader reports whether jobs of this instance are running
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.fence != 0
+}
+
+// Status returns the last observed leader
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Status{Self: e.id, Leader: e.leader, IsLeader: e.fence != 0, Fence: e.fence}
+}
+
+// Check is a readiness check, an instance is ready whoever is the leader
+func (e *Elector) Check() (bool, any) {
+	return true, e.Status()
+}
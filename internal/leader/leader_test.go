@@ -0,0 +1,171 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingJob struct {
+	running atomic.Int32
+	fence   atomic.Uint64
+}
+
+func (j *recordingJob) run(ctx context.Context, fence uint64) {
+	j.running.Add(1)
+	j.fence.Store(fence)
+	<-ctx.Done()
+	j.running.Add(-1)
+}
+
+func newTestElector(t *testing.T, mr *miniredis.Miniredis, id string) (*Elector, *recordingJob) {
+	t.Helper()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	e := NewElector(cli, "leader:", id, WithTTL(3*time.Second))
+	job := &recordingJob{}
+	e.Register("record", job.run)
+	return e, job
+}
+
+// waitFor polls cond because jobs start in their own goroutines
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElectorSingleLeader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	a, jobA := newTestElector(t, mr, "a")
+	b, jobB := newTestElector(t, mr, "b")
+
+	a.step(ctx)
+	b.step(ctx)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("Expected a leader and b follower, got %v and %v", a.IsLeader(), b.IsLeader())
+	}
+	waitFor(t, func() bool { return jobA.running.Load() == 1 }, "Expected job running on the leader")
+	if jobB.running.Load() != 0 {
+		t.Error("Expected no job running on the follower")
+	}
+	if st := b.Status(); st.Leader != "a" || st.IsLeader {
+		t.Errorf("Expected b to see leader a, got %+v", st)
+	}
+
+	// renewal keeps the term
+	a.step(ctx)
+	if st := a.Status(); st.Fence != 1 || jobA.fence.Load() != 1 {
+		t.Errorf("Expected fence 1 kept on renewal, got %+v", st)
+	}
+}
+
+func TestElectorFailover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	a, jobA := newTestElector(t, mr, "a")
+	b, jobB := newTestElector(t, mr, "b")
+	a.step(ctx)
+	b.step(ctx)
+
+	// a stops renewing, the lease expires and b takes over with a newer fence
+	mr.FastForward(4 * time.Second)
+	b.step(ctx)
+	if !b.IsLeader() {
+		t.Fatal("Expected b to become the leader after the lease expired")
+	}
+	waitFor(t, func() bool { return jobB.fence.Load() == 2 }, "Expected job of b with fence 2")
+
+	// a notices it lost the lease and stops its jobs
+	a.step(ctx)
+	if a.IsLeader() || jobA.running.Load() != 0 {
+		t.Errorf("Expected a stepped down, leader %v, running jobs %d", a.IsLeader(), jobA.running.Load())
+	}
+	if st := a.Status(); st.Leader != "b" {
+		t.Errorf("Expected a to see leader b, got %+v", st)
+	}
+}
+
+func TestElectorReacquiresExpiredLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	a, jobA := newTestElector(t, mr, "a")
+	a.step(ctx)
+	waitFor(t, func() bool { return jobA.fence.Load() == 1 }, "Expected job with fence 1")
+
+	// a misses renewals, the lease expires and a takes it again in a new term
+	mr.FastForward(4 * time.Second)
+	a.step(ctx)
+	if st := a.Status(); !st.IsLeader || st.Fence != 2 {
+		t.Fatalf("Expected a leader with fence 2, got %+v", st)
+	}
+	waitFor(t, func() bool { return jobA.fence.Load() == 2 }, "Expected job restarted with fence 2")
+	if n := jobA.running.Load(); n != 1 {
+		t.Errorf("Expected only the job of the new term running, got %d", n)
+	}
+}
+
+func TestElectorResign(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	a, jobA := newTestElector(t, mr, "a")
+	b, _ := newTestElector(t, mr, "b")
+
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+	waitFor(t, a.IsLeader, "Expected a to become the leader")
+	cancel()
+	<-done
+	if jobA.running.Load() != 0 {
+		t.Error("Expected jobs stopped on shutdown")
+	}
+
+	// released lease is free at once
+	b.step(context.Background())
+	if !b.IsLeader() {
+		t.Error("Expected b to take the released lease without waiting for expiry")
+	}
+}
+
+func TestHolder(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+
+	if holder, err := Holder(ctx, cli, "leader:"); err != nil || holder != "" {
+		t.Fatalf("Expected no holder before an election, got %q, %v", holder, err)
+	}
+	a, _ := newTestElector(t, mr, "a")
+	a.step(ctx)
+	if holder, err := Holder(ctx, cli, "leader:"); err != nil || holder != "a" {
+		t.Errorf("Expected holder a, got %q, %v", holder, err)
+	}
+}
+
+func TestElectorStepsDownWhenRedisIsUnreachable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	a, jobA := newTestElector(t, mr, "a")
+	a.step(ctx)
+	waitFor(t, func() bool { return jobA.running.Load() == 1 }, "Expected job running")
+
+	mr.SetError("connection lost")
+	a.mu.Lock()
+	a.lastRenew = time.Now().Add(-2 * time.Second) // ttl is 3s, renewal every 1s
+	a.mu.Unlock()
+	a.step(ctx)
+	if a.IsLeader() || jobA.running.Load() != 0 {
+		t.Error("Expected leader to step down before its lease surely expired")
+	}
+}
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type Side string
 
@@ -20,6 +23,82 @@ type SwapEvent struct {
 	Rate       float64   `json:"rate"` //usd per token
 	CreatedAt  time.Time `json:"created_at"`
 	ExecutedAt time.Time `json:"executed_at"`
+
+	// on-chain position, zero BlockNumber means the event is not tracked for reorgs
+	Chain       string `json:"chain,omitempty"`
+	BlockNumber uint64 `json:"block_number,omitempty"`
+	BlockHash   string `json:"block_hash,omitempty"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	LogIndex    uint32 `json:"log_index,omitempty"`
+}
+
+// Retraction invalidates swaps of an orphaned block,
+// empty BlockHash retracts every swap applied with BlockNumber
+type Retraction struct {
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash,omitempty"`
+}
+
+// BlockSwap is what a swap of a not yet final block added to a minute bucket of a token
+type BlockSwap struct {
+	Token     string
+	Minute    int64
+	USD       float64
+	Quantity  float64
+	BlockHash string
+}
+
+type UpdateKind string
+
+const (
+	UpdateSwap     UpdateKind = "swap"
+	UpdateRetract  UpdateKind = "retract"
+	UpdateBackfill UpdateKind = "backfill"
+	UpdateConfirm  UpdateKind = "confirm"
+)
+
+// Update is a change of series applied by a writer, reader replicas replay them in order.
+// Swap update has a single swap, retract update has every swap subtracted from the block,
+// backfill update replaces buckets of Token in minutes [FromMinute, ToMinute),
+// confirm update marks every block up to BlockNumber final.
+type Update struct {
+	ID          string
+	Kind        UpdateKind
+	BlockNumber uint64
+	BlockHash   string
+	Swaps       []BlockSwap
+
+	Token      string
+	FromMinute int64
+	ToMinute   int64
+	Buckets    []MinuteBucket
+}
+
+// View selects which swaps stats include
+type View string
+
+const (
+	ViewPending   View = "pending"   // every applied swap, the live numbers
+	ViewConfirmed View = "confirmed" // only swaps with enough confirmations
+)
+
+// ParseView accepts "pending" and "confirmed", empty string is pending
+func ParseView(s string) (View, error) {
+	switch View(s) {
+	case "", ViewPending:
+		return ViewPending, nil
+	case ViewConfirmed:
+		return ViewConfirmed, nil
+	}
+	return "", fmt.Errorf("unknown view: %q", s)
+}
+
+// Topic identifies an update stream of a token view, pending view is the token itself
+func Topic(token string, view View) string {
+	if view == "" || view == ViewPending {
+		return token
+	}
+	return token + "@" + string(view)
 }
 
 type Bucket struct {
@@ -28,11 +107,91 @@ type Bucket struct {
 	Quantity float64 `json:"total token volume"`
 }
 
+// MinuteBucket is the total of a token in a minute since the epoch
+type MinuteBucket struct {
+	Minute int64 `json:"minute"`
+	Bucket
+}
+
 // Stats: if more various time Interval needed we can add here or create custom one
 type Stats struct {
 	Token          string    `json:"token"`
 	BucketMinutes5 Bucket    `json:"bucket_minutes_5"`
 	BucketHours1   Bucket    `json:"bucket_hours_1"`
 	BucketHours24  Bucket    `json:"bucket_hours_24"`
+	View           View      `json:"view,omitempty"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
+
+type MessageType string
+
+const (
+	MessageSnapshot MessageType = "snapshot"
+	MessageDelta    MessageType = "delta"
+)
+
+// BucketDelta is a signed difference between two buckets
+type BucketDelta struct {
+	Count    int64   `json:"transaction counts"`
+	USD      float64 `json:"total usd volume"`
+	Quantity float64 `json:"total token volume"`
+}
+
+type StatsDelta struct {
+	BucketMinutes5 BucketDelta `json:"bucket_minutes_5"`
+	BucketHours1   BucketDelta `json:"bucket_hours_1"`
+	BucketHours24  BucketDelta `json:"bucket_hours_24"`
+}
+
+// Envelope is a single pushed update. Seq grows by one per token view,
+// so a client can detect gaps and resume with since=<seq>.
+// Epoch names the numbering of Seq, it changes when the server restarts,
+// resuming with seq of another epoch gets a snapshot.
+// Snapshot carries full Stats, delta must be applied to the state at Seq-1.
+type Envelope struct {
+	Type      MessageType `json:"type"`
+	Token     string      `json:"token"`
+	View      View        `json:"view,omitempty"`
+	Epoch     string      `json:"epoch"`
+	Seq       uint64      `json:"seq"`
+	Stats     *Stats      `json:"stats,omitempty"`
+	Delta     *StatsDelta `json:"delta,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func diffBucket(prev, next Bucket) BucketDelta {
+	return BucketDelta{
+		Count:    int64(next.Count) - int64(prev.Count),
+		USD:      next.USD - prev.USD,
+		Quantity: next.Quantity - prev.Quantity,
+	}
+}
+
+func applyBucket(b Bucket, d BucketDelta) Bucket {
+	return Bucket{
+		Count:    uint64(int64(b.Count) + d.Count),
+		USD:      b.USD + d.USD,
+		Quantity: b.Quantity + d.Quantity,
+	}
+}
+
+// Diff returns delta which turns prev into next
+func Diff(prev, next Stats) StatsDelta {
+	return StatsDelta{
+		BucketMinutes5: diffBucket(prev.BucketMinutes5, next.BucketMinutes5),
+		BucketHours1:   diffBucket(prev.BucketHours1, next.BucketHours1),
+		BucketHours24:  diffBucket(prev.BucketHours24, next.BucketHours24),
+	}
+}
+
+// ApplyDelta returns stats with delta applied, inverse of Diff
+func (s Stats) ApplyDelta(d StatsDelta, updatedAt time.Time) Stats {
+	return Stats{
+		Token:          s.Token,
+		BucketMinutes5: applyBucket(s.BucketMinutes5, d.BucketMinutes5),
+		BucketHours1:   applyBucket(s.BucketHours1, d.BucketHours1),
+		BucketHours24:  applyBucket(s.BucketHours24, d.BucketHours24),
+		View:           s.View,
+		UpdatedAt:      updatedAt,
+	}
+}
@@ -0,0 +1,192 @@
+// Package reconcile periodically compares the state in memory with Redis, the source of truth.
+// A write may reach Redis and fail before memory follows, so they can silently diverge.
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/clock"
+	"Dexcelerate_swap_stats/internal/engine"
+)
+
+const (
+	defaultInterval = 5 * time.Minute
+	maxReported     = 20 // drifted tokens kept in a report
+)
+
+// Target is what gets reconciled, implemented by engine.Engine
+type Target interface {
+	Tokens() []string
+	Reconcile(ctx context.Context, token string, heal bool) (engine.Drift, error)
+}
+
+// Report describes a single pass
+type Report struct {
+	At       time.Time      `json:"at"`
+	Duration time.Duration  `json:"duration"`
+	Tokens   int            `json:"tokens"`
+	Drifted  int            `json:"drifted"` // tokens with at least one differing minute
+	Healed   int            `json:"healed"`
+	Errors   int            `json:"errors"`
+	Minutes  int            `json:"minutes"`
+	Count    uint64         `json:"count"`
+	USD      float64        `json:"usd"`
+	Quantity float64        `json:"quantity"`
+	Drifts   []engine.Drift `json:"drifts,omitempty"` // the first drifted tokens
+}
+
+// Stats are totals since start and the last report, published to /debug/vars
+type Stats struct {
+	Runs    int64  `json:"runs"`
+	Drifted int64  `json:"drifted"`
+	Healed  int64  `json:"healed"`
+	Errors  int64  `json:"errors"`
+	Last    Report `json:"last"`
+}
+
+type Reconciler struct {
+	target   Target
+	tokens   func(ctx context.Context) ([]string, error)
+	interval time.Duration
+	heal     bool
+	clock    clock.Clock
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+type Option func(*Reconciler)
+
+// WithInterval sets the time between passes, 5m by default
+func WithInterval(d time.Duration) Option {
+	return func(r *Reconciler) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// WithHeal replaces drifted memory with Redis, drift is only reported by default
+func WithHeal(heal bool) Option {
+	return func(r *Reconciler) { r.heal = heal }
+}
+
+// WithTokens also checks tokens known to Redis, so a series missing in memory is found.
+// Only tokens in memory are checked by default, with cluster it is just the owned ones.
+func WithTokens(list func(ctx context.Context) ([]string, error)) Option {
+	return func(r *Reconciler) { r.tokens = list }
+}
+
+// WithClock sets the clock of passes, the real one by default
+func WithClock(c clock.Clock) Option {
+	return func(r *Reconciler) {
+		if c != nil {
+			r.clock = c
+		}
+	}
+}
+
+func New(target Target, opts ...Option) *Reconciler {
+	r := &Reconciler{
+		target:   target,
+		interval: defaultInterval,
+		clock:    clock.Real(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run reconciles every interval until ctx is done
+func (r *Reconciler) Run(ctx context.Context) error {
+	t := r.clock.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C():
+			r.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce compares every token and logs drift
+func (r *Reconciler) RunOnce(ctx context.Context) Report {
+	started := r.clock.Now()
+	rep := Report{At: started}
+	for _, token := range r.list(ctx, &rep) {
+		if ctx.Err() != nil {
+			break
+		}
+		drift, err := r.target.Reconcile(ctx, token, r.heal)
+		if err != nil {
+			rep.Errors++
+			log.Printf("[error] Failed to reconcile %s: %v", token, err)
+			continue
+		}
+		rep.Tokens++
+		if drift.Minutes == 0 {
+			continue
+		}
+		rep.Drifted++
+		rep.Minutes += drift.Minutes
+		rep.Count += drift.Count
+		rep.USD += drift.USD
+		rep.Quantity += drift.Quantity
+		if drift.Healed {
+			rep.Healed++
+		}
+		if len(rep.Drifts) < maxReported {
+			rep.Drifts = append(rep.Drifts, drift)
+		}
+		log.Printf("[warning] Memory of %s differs from redis in %d minutes: %d swaps, %g usd, %g quantity, healed: %v",
+			token, drift.Minutes, drift.Count, drift.USD, drift.Quantity, drift.Healed)
+	}
+	rep.Duration = r.clock.Now().Sub(started)
+
+	r.mu.Lock()
+	r.stats.Runs++
+	r.stats.Drifted += int64(rep.Drifted)
+	r.stats.Healed += int64(rep.Healed)
+	r.stats.Errors += int64(rep.Errors)
+	r.stats.Last = rep
+	r.mu.Unlock()
+	return rep
+}
+
+// list returns tokens of memory and of the optional lister, each once
+func (r *Reconciler) list(ctx context.Context, rep *Report) []string {
+	tokens := r.target.Tokens()
+	if r.tokens == nil {
+		return tokens
+	}
+	more, err := r.tokens(ctx)
+	if err != nil {
+		rep.Errors++
+		log.Println("[error] Failed to list tokens to reconcile:", err)
+		return tokens
+	}
+	seen := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		seen[token] = true
+	}
+	for _, token := range more {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Stats returns totals and the last report
+func (r *Reconciler) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
@@ -0,0 +1,133 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/clock"
+	"Dexcelerate_swap_stats/internal/engine"
+)
+
+type fakeTarget struct {
+	mu     sync.Mutex
+	tokens []string
+	drifts map[string]engine.Drift
+	errs   map[string]error
+	calls  []string
+	heal   bool
+}
+
+func (f *fakeTarget) Tokens() []string { return f.tokens }
+
+func (f *fakeTarget) Reconcile(_ context.Context, token string, heal bool) (engine.Drift, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, token)
+	f.heal = heal
+	d := f.drifts[token]
+	d.Token = token
+	d.Healed = heal && d.Minutes > 0
+	return d, f.errs[token]
+}
+
+func (f *fakeTarget) called() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+func TestRunOnce(t *testing.T) {
+	target := &fakeTarget{
+		tokens: []string{"BTC", "ETH", "SOL"},
+		drifts: map[string]engine.Drift{
+			"BTC":  {Minutes: 2, Count: 3, USD: 10, Quantity: 1},
+			"DOGE": {Minutes: 1, Count: 1, USD: 2, Quantity: 2}, // in redis only
+		},
+		errs: map[string]error{"SOL": errors.New("redis is down")},
+	}
+	lister := func(context.Context) ([]string, error) { return []string{"ETH", "DOGE"}, nil }
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		calls  int
+		tokens int
+		healed int
+	}{
+		{"memory tokens", nil, 3, 2, 0},
+		{"with redis tokens", []Option{WithTokens(lister)}, 4, 3, 0},
+		{"heal", []Option{WithTokens(lister), WithHeal(true)}, 4, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target.calls = nil
+			r := New(target, tt.opts...)
+			rep := r.RunOnce(context.Background())
+			if len(target.calls) != tt.calls || rep.Tokens != tt.tokens || rep.Errors != 1 || rep.Healed != tt.healed {
+				t.Errorf("Expected %d calls, %d tokens, 1 error and %d healed, got %v and %+v",
+					tt.calls, tt.tokens, tt.healed, target.calls, rep)
+			}
+			drifted := 1 + tt.calls - 3 // DOGE drifts too when redis tokens are listed
+			if rep.Drifted != drifted || len(rep.Drifts) != drifted {
+				t.Errorf("Expected %d drifted tokens, got %+v", drifted, rep)
+			}
+			if stats := r.Stats(); stats.Runs != 1 || stats.Errors != 1 || stats.Last.Drifted != rep.Drifted {
+				t.Errorf("Expected stats of 1 run, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestRunOnceTotals(t *testing.T) {
+	target := &fakeTarget{
+		tokens: []string{"BTC", "ETH"},
+		drifts: map[string]engine.Drift{
+			"BTC": {Minutes: 2, Count: 3, USD: 10, Quantity: 1},
+			"ETH": {Minutes: 1, Count: 1, USD: 0.5, Quantity: 4},
+		},
+	}
+	r := New(target)
+	rep := r.RunOnce(context.Background())
+	if rep.Minutes != 3 || rep.Count != 4 || rep.USD != 10.5 || rep.Quantity != 5 {
+		t.Errorf("Expected summed drift, got %+v", rep)
+	}
+	r.RunOnce(context.Background())
+	if stats := r.Stats(); stats.Runs != 2 || stats.Drifted != 4 {
+		t.Errorf("Expected 4 drifted tokens in 2 runs, got %+v", stats)
+	}
+}
+
+func TestRunFollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	target := &fakeTarget{tokens: []string{"BTC"}}
+	r := New(target, WithInterval(time.Minute), WithClock(clk))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+	for clk.Tickers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clk.Advance(30 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if n := target.called(); n != 0 {
+		t.Errorf("Expected no pass before the interval, got %d", n)
+	}
+	clk.Advance(30 * time.Second)
+	deadline := time.Now().Add(time.Second)
+	for target.called() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := target.called(); n != 1 {
+		t.Errorf("Expected a pass after the interval, got %d", n)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled, got %v", err)
+	}
+}
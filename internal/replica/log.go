@@ -0,0 +1,54 @@
+package replica
+
+import (
+	"context"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+// Log replays the update stream once up to its end, an engine restored
+// from a snapshot catches up with it, see engine.UpdateLog
+type Log struct {
+	source Source
+	batch  int64
+}
+
+func NewLog(source Source) *Log {
+	return &Log{source: source, batch: defaultBatch}
+}
+
+// Follow replays updates after the given id until the stream is drained and returns
+// id of the last one. ErrGap means the stream doesn't reach back to after any more,
+// an empty stream too unless after is its start. ErrNoStream means writers don't record updates.
+func (l *Log) Follow(ctx context.Context, after string, replay func(model.Update)) (string, error) {
+	if !l.source.UpdatesEnabled() {
+		return after, ErrNoStream
+	}
+	oldest, err := l.source.OldestUpdateID(ctx)
+	if err != nil {
+		return after, err
+	}
+	if oldest != "" && (after == "" || trimmedAfter(after, oldest)) {
+		return after, ErrGap
+	}
+	if oldest == "" && after != "" && after != "0-0" {
+		// the stream was deleted since after was read
+		return after, ErrGap
+	}
+	if after == "" {
+		after = "0-0" // nothing was ever written
+	}
+	for {
+		updates, err := l.source.ReadUpdates(ctx, after, l.batch, 0)
+		if err != nil {
+			return after, err
+		}
+		for _, u := range updates {
+			replay(u)
+			after = u.ID
+		}
+		if int64(len(updates)) < l.batch {
+			return after, nil
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+	"Dexcelerate_swap_stats/internal/webSocket"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRestoreCatchesUpWithLog(t *testing.T) {
+	writer, store, restored := newTestCluster(t, 1000)
+	ctx := context.Background()
+
+	applyEvents(t, writer, 0, 5, 10)
+	var snap bytes.Buffer
+	info, err := writer.WriteSnapshot(ctx, &snap)
+	if err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+
+	// written after the snapshot, replayed from the stream
+	applyEvents(t, writer, 5, 9, 11)
+	applyEvents(t, writer, 9, 10, 13)
+	if _, err := writer.Retract(ctx, model.Retraction{BlockNumber: 13}); err != nil {
+		t.Fatalf("Retract: %v", err)
+	}
+
+	got, err := restored.Restore(ctx, &snap, NewLog(store))
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got.UpdateID != info.UpdateID || got.CaughtUpTo == info.UpdateID {
+		t.Errorf("Expected restore to catch up after %s, got %+v", info.UpdateID, got)
+	}
+	assertSameStats(t, writer, restored)
+}
+
+func TestRestoreFailsBehindTrimmedLog(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	ctx := context.Background()
+	store := redisStorage.NewStore(cli, "token_set", time.Hour, redisStorage.WithUpdateStream("updates", 1000))
+	writer := engine.NewEngine(store, webSocket.NewHub())
+	restored := engine.NewEngine(store, webSocket.NewHub())
+
+	applyEvents(t, writer, 0, 2, 0)
+	var snap bytes.Buffer
+	if _, err := writer.WriteSnapshot(ctx, &snap); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	applyEvents(t, writer, 2, 6, 0)
+	if err := cli.XTrimMaxLen(ctx, "updates", 1).Err(); err != nil {
+		t.Fatalf("XTrim: %v", err)
+	}
+
+	if _, err := restored.Restore(ctx, &snap, NewLog(store)); !errors.Is(err, ErrGap) {
+		t.Fatalf("Expected gap error, got %v", err)
+	}
+	if got := restored.Stats("BTC", time.Now()).BucketHours24.Count; got != 0 {
+		t.Errorf("Expected state unchanged after failed restore, got %d swaps", got)
+	}
+}
+
+func TestRestoreFailsWithoutStream(t *testing.T) {
+	writer, store, restored := newTestCluster(t, 0)
+	ctx := context.Background()
+
+	applyEvents(t, writer, 0, 2, 0)
+	var snap bytes.Buffer
+	if _, err := writer.WriteSnapshot(ctx, &snap); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	// nowhere recorded, a restore would drop them
+	applyEvents(t, writer, 2, 6, 0)
+
+	if _, err := restored.Restore(ctx, &snap, NewLog(store)); !errors.Is(err, ErrNoStream) {
+		t.Fatalf("Expected disabled stream error, got %v", err)
+	}
+	if got := restored.Stats("BTC", time.Now()).BucketHours24.Count; got != 0 {
+		t.Errorf("Expected state unchanged after failed restore, got %d swaps", got)
+	}
+}
+
+func TestRestoreFailsBehindDeletedLog(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	ctx := context.Background()
+	store := redisStorage.NewStore(cli, "token_set", time.Hour, redisStorage.WithUpdateStream("updates", 1000))
+	writer := engine.NewEngine(store, webSocket.NewHub())
+	restored := engine.NewEngine(store, webSocket.NewHub())
+
+	applyEvents(t, writer, 0, 2, 0)
+	var snap bytes.Buffer
+	if _, err := writer.WriteSnapshot(ctx, &snap); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	applyEvents(t, writer, 2, 6, 0)
+	if err := cli.Del(ctx, "updates").Err(); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+
+	if _, err := restored.Restore(ctx, &snap, NewLog(store)); !errors.Is(err, ErrGap) {
+		t.Fatalf("Expected gap error, got %v", err)
+	}
+}
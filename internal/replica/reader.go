@@ -0,0 +1,251 @@
+// Package replica keeps the engine of a read-only instance in sync with writers,
+// it loads a snapshot from Redis and then replays the update stream written with every swap
+package replica
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const (
+	defaultBatch  = 1000
+	defaultPoll   = time.Second
+	defaultMaxLag = 5 * time.Second
+	retryDelay    = time.Second
+)
+
+// ErrGap means updates after the last replayed one may have been trimmed from the stream
+var ErrGap = errors.New("replica: updates were trimmed, snapshot required")
+
+// ErrNoStream means writers don't record updates, nothing written after a snapshot can be replayed
+var ErrNoStream = errors.New("replica: update stream is disabled")
+
+// Source is the writers' state in Redis
+type Source interface {
+	Snapshot(ctx context.Context) (map[string]map[string]string, map[uint64][]model.BlockSwap, string, error)
+	ReadUpdates(ctx context.Context, after string, count int64, block time.Duration) ([]model.Update, error)
+	OldestUpdateID(ctx context.Context) (string, error)
+	UpdatesEnabled() bool
+}
+
+// Target is the engine kept in sync
+type Target interface {
+	Reset(all map[string]map[string]string, blocks map[uint64][]model.BlockSwap)
+	Replay(u model.Update)
+}
+
+// Status is reported in /readyz
+type Status struct {
+	Synced bool   `json:"synced"`
+	LastID string `json:"last_id"`
+	LagMs  int64  `json:"lag_ms"`
+	MaxLag int64  `json:"max_lag_ms"`
+}
+
+// Reader tails writers' updates, state is consistent with writers as of caughtUpAt
+type Reader struct {
+	source Source
+	target Target
+	batch  int64
+	poll   time.Duration
+	maxLag time.Duration
+
+	mu         sync.Mutex
+	synced     bool
+	lastID     string
+	caughtUpAt time.Time
+}
+
+type Option func(*Reader)
+
+// WithBatch sets how many updates are read at once
+func WithBatch(n int64) Option {
+	return func(r *Reader) {
+		if n > 0 {
+			r.batch = n
+		}
+	}
+}
+
+// WithPoll sets how long a read waits for new updates
+func WithPoll(d time.Duration) Option {
+	return func(r *Reader) {
+		if d > 0 {
+			r.poll = d
+		}
+	}
+}
+
+// WithMaxLag sets the lag above which the replica is not ready
+func WithMaxLag(d time.Duration) Option {
+	return func(r *Reader) {
+		if d > 0 {
+			r.maxLag = d
+		}
+	}
+}
+
+func NewReader(source Source, target Target, opts ...Option) *Reader {
+	r := &Reader{
+		source: source,
+		target: target,
+		batch:  defaultBatch,
+		poll:   defaultPoll,
+		maxLag: defaultMaxLag,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run keeps target in sync until ctx is done, errors are retried
+func (r *Reader) Run(ctx context.Context) error {
+	for {
+		if err := r.sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Println("[error] Replica snapshot failed:", err)
+			if !sleep(ctx, retryDelay) {
+				return ctx.Err()
+			}
+			continue
+		}
+		for {
+			err := r.tail(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, ErrGap) {
+				log.Println("[warning] Replica fell behind the update stream, reloading snapshot")
+				break
+			}
+			if err != nil {
+				log.Println("[error] Replica failed to read updates:", err)
+				if !sleep(ctx, retryDelay) {
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// sync replaces the target state with a snapshot
+func (r *Reader) sync(ctx context.Context) error {
+	start := time.Now()
+	all, blocks, lastID, err := r.source.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	r.target.Reset(all, blocks)
+
+	r.mu.Lock()
+	r.synced, r.lastID, r.caughtUpAt = true, lastID, start
+	r.mu.Unlock()
+	log.Printf("[replica] Loaded %d token series at update %s", len(all), lastID)
+	return nil
+}
+
+// tail replays one batch of updates
+func (r *Reader) tail(ctx context.Context) error {
+	r.mu.Lock()
+	lastID := r.lastID
+	r.mu.Unlock()
+
+	oldest, err := r.source.OldestUpdateID(ctx)
+	if err != nil {
+		return err
+	}
+	if oldest != "" && trimmedAfter(lastID, oldest) {
+		return ErrGap
+	}
+
+	start := time.Now()
+	updates, err := r.source.ReadUpdates(ctx, lastID, r.batch, r.poll)
+	if err != nil {
+		return err
+	}
+	for _, u := range updates {
+		if ctx.Err() != nil {
+			// the rest is replayed by the next run
+			return ctx.Err()
+		}
+		r.target.Replay(u)
+		lastID = u.ID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID = lastID
+	// a short batch drained the stream, everything written before the read is replayed
+	if int64(len(updates)) < r.batch {
+		r.caughtUpAt = start
+	}
+	return nil
+}
+
+// Status returns sync progress, lag grows while the reader is behind or can't reach Redis
+func (r *Reader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := Status{Synced: r.synced, LastID: r.lastID, MaxLag: r.maxLag.Milliseconds()}
+	if r.synced {
+		st.LagMs = time.Since(r.caughtUpAt).Milliseconds()
+	}
+	return st
+}
+
+// Check reports readiness: synced and not lagging more than max lag
+func (r *Reader) Check() (bool, any) {
+	st := r.Status()
+	return st.Synced && st.LagMs <= st.MaxLag, st
+}
+
+// trimmedAfter reports whether updates right after last may be gone from a stream starting at oldest.
+// Ids between last and its successor can't exist, so oldest being the successor is no gap.
+func trimmedAfter(last, oldest string) bool {
+	ms, seq := splitID(last)
+	if seq == math.MaxUint64 {
+		ms, seq = ms+1, 0
+	} else {
+		seq++
+	}
+	return idLess(strconv.FormatUint(ms, 10)+"-"+strconv.FormatUint(seq, 10), oldest)
+}
+
+// idLess compares stream ids "<ms>-<seq>"
+func idLess(a, b string) bool {
+	am, as := splitID(a)
+	bm, bs := splitID(b)
+	if am != bm {
+		return am < bm
+	}
+	return as < bs
+}
+
+func splitID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
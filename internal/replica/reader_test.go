@@ -0,0 +1,202 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/engine"
+	"Dexcelerate_swap_stats/internal/model"
+	"Dexcelerate_swap_stats/internal/storage/redisStorage"
+	"Dexcelerate_swap_stats/internal/webSocket"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCluster(t *testing.T, maxLen int64) (*engine.Engine, *redisStorage.Store, *engine.Engine) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	store := redisStorage.NewStore(cli, "token_set", time.Hour, redisStorage.WithUpdateStream("updates", maxLen))
+	writer := engine.NewEngine(store, webSocket.NewHub(), engine.WithConfirmations(2))
+	reader := engine.NewEngine(store, webSocket.NewHub(), engine.WithConfirmations(2))
+	return writer, store, reader
+}
+
+func applyEvents(t *testing.T, eng *engine.Engine, from, to int, block uint64) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		ev := model.SwapEvent{EventID: "ev-" + strconv.Itoa(i), TokenID: "BTC", Side: model.Buy,
+			Amount: 1, USD: 100, Rate: 100, ExecutedAt: time.Now(), BlockNumber: block, BlockHash: "0xa"}
+		if _, err := eng.Apply(context.Background(), ev); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+}
+
+func assertSameStats(t *testing.T, writer, reader *engine.Engine) {
+	t.Helper()
+	now := time.Now()
+	for _, view := range []model.View{model.ViewPending, model.ViewConfirmed} {
+		w, r := writer.StatsView("BTC", view, now), reader.StatsView("BTC", view, now)
+		if w.BucketHours24 != r.BucketHours24 {
+			t.Errorf("Expected %s view of reader %+v, got %+v", view, w.BucketHours24, r.BucketHours24)
+		}
+	}
+}
+
+func TestReaderFollowsWriter(t *testing.T) {
+	writer, store, readerEngine := newTestCluster(t, 1000)
+	ctx := context.Background()
+	r := NewReader(store, readerEngine, WithPoll(10*time.Millisecond), WithBatch(3))
+
+	applyEvents(t, writer, 0, 5, 10)
+	if err := r.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	assertSameStats(t, writer, readerEngine)
+
+	applyEvents(t, writer, 5, 9, 11)
+	applyEvents(t, writer, 9, 10, 13) // block 10 and 11 are final now
+	if _, err := writer.Retract(context.Background(), model.Retraction{BlockNumber: 13}); err != nil {
+		t.Fatalf("Retract: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := r.tail(ctx); err != nil {
+			t.Fatalf("tail: %v", err)
+		}
+	}
+	assertSameStats(t, writer, readerEngine)
+	if got := readerEngine.StatsView("BTC", model.ViewConfirmed, time.Now()).BucketHours24.Count; got != 9 {
+		t.Errorf("Expected 9 confirmed swaps on reader, got %d", got)
+	}
+
+	if ok, detail := r.Check(); !ok {
+		t.Errorf("Expected caught up reader ready, got %+v", detail)
+	}
+}
+
+func TestReaderResyncsAfterTrim(t *testing.T) {
+	writer, store, readerEngine := newTestCluster(t, 1000)
+	ctx := context.Background()
+	r := NewReader(store, readerEngine, WithPoll(10*time.Millisecond))
+	applyEvents(t, writer, 0, 2, 0)
+	if err := r.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	applyEvents(t, writer, 2, 6, 0)
+	r.mu.Lock()
+	r.lastID = "1-0" // as if updates after it were trimmed
+	r.mu.Unlock()
+	if err := r.tail(ctx); !errors.Is(err, ErrGap) {
+		t.Fatalf("Expected gap error, got %v", err)
+	}
+	if err := r.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	assertSameStats(t, writer, readerEngine)
+}
+
+func TestReaderNotReadyBeforeSync(t *testing.T) {
+	_, store, readerEngine := newTestCluster(t, 1000)
+	r := NewReader(store, readerEngine, WithMaxLag(time.Second))
+	if ok, _ := r.Check(); ok {
+		t.Error("Expected reader without snapshot not ready")
+	}
+	r.mu.Lock()
+	r.synced, r.caughtUpAt = true, time.Now().Add(-2*time.Second)
+	r.mu.Unlock()
+	if ok, detail := r.Check(); ok {
+		t.Errorf("Expected lagging reader not ready, got %+v", detail)
+	}
+}
+
+func TestIDLess(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"0-0", "1-0", true},
+		{"5-1", "5-2", true},
+		{"10-0", "9-5", false},
+		{"7-3", "7-3", false},
+	}
+	for _, tt := range tests {
+		if got := idLess(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Expected idLess(%s, %s) %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestTrimmedAfter(t *testing.T) {
+	tests := []struct {
+		last, oldest string
+		expected     bool
+	}{
+		{"5-1", "5-1", false}, // last is still in the stream
+		{"5-1", "5-2", false}, // only last was trimmed
+		{"5-1", "5-3", true},
+		{"5-1", "6-0", true},
+		{"5-18446744073709551615", "6-0", false},
+		{"9-0", "5-0", false},
+	}
+	for _, tt := range tests {
+		if got := trimmedAfter(tt.last, tt.oldest); got != tt.expected {
+			t.Errorf("Expected trimmedAfter(%s, %s) %v, got %v", tt.last, tt.oldest, tt.expected, got)
+		}
+	}
+}
+
+func TestReaderReplaysBackfill(t *testing.T) {
+	writer, store, readerEngine := newTestCluster(t, 1000)
+	ctx := context.Background()
+	r := NewReader(store, readerEngine, WithPoll(10*time.Millisecond))
+
+	applyEvents(t, writer, 0, 5, 0)
+	if err := r.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	nowMin := time.Now().Unix() / 60
+	buckets := []model.MinuteBucket{
+		{Minute: nowMin - 3, Bucket: model.Bucket{Count: 2, USD: 7, Quantity: 3}},
+		{Minute: nowMin, Bucket: model.Bucket{Count: 1, USD: 1, Quantity: 1}},
+	}
+	if err := writer.ReplaceRange(ctx, "BTC", nowMin-10, nowMin+1, buckets, nil); err != nil {
+		t.Fatalf("ReplaceRange: %v", err)
+	}
+	if err := r.tail(ctx); err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	assertSameStats(t, writer, readerEngine)
+	if got := readerEngine.Stats("BTC", time.Now()).BucketHours24; got.Count != 3 || got.USD != 8 {
+		t.Errorf("Expected backfilled stats on reader, got %+v", got)
+	}
+}
+
+func TestReaderReplaysConfirm(t *testing.T) {
+	writer, store, readerEngine := newTestCluster(t, 1000)
+	ctx := context.Background()
+	r := NewReader(store, readerEngine, WithPoll(10*time.Millisecond))
+
+	applyEvents(t, writer, 0, 3, 10)
+	if err := r.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	if n, err := writer.Confirm(ctx, 10); err != nil || n != 3 {
+		t.Fatalf("Expected 3 promoted swaps, got %d, %v", n, err)
+	}
+	if err := r.tail(ctx); err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	assertSameStats(t, writer, readerEngine)
+	if got := readerEngine.StatsView("BTC", model.ViewConfirmed, time.Now()).BucketHours24.Count; got != 3 {
+		t.Errorf("Expected 3 confirmed swaps on reader, got %d", got)
+	}
+}
@@ -0,0 +1,244 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const scanCount = 500
+
+// rebuildSeq tells apart temporary hashes of rebuilds started within the same nanosecond
+var rebuildSeq atomic.Uint64
+
+// DedupeKey is a stored dedupe marker, zero TTL means it never expires
+type DedupeKey struct {
+	Key string        `json:"key"`
+	TTL time.Duration `json:"ttl"`
+}
+
+// DedupeKeys lists up to limit dedupe markers whose key after the prefix matches a glob pattern,
+// zero limit lists all of them
+func (s *Store) DedupeKeys(ctx context.Context, match string, limit int) ([]DedupeKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
+
+	var keys []string
+	iter := s.cli.Scan(ctx, 0, dedupePattern(match), scanCount).Iterator()
+	for (limit <= 0 || len(keys) < limit) && iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := s.cli.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			ttls[i] = p.TTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DedupeKey, 0, len(keys))
+	for i, key := range keys {
+		ttl := ttls[i].Val()
+		if ttl == -2 { // expired meanwhile
+			continue
+		}
+		out = append(out, DedupeKey{Key: key, TTL: max(ttl, 0)})
+	}
+	return out, nil
+}
+
+// ClearDedupe deletes dedupe markers, so the events are applied again when they are delivered.
+// Keys are taken with or without the prefix, the number of deleted ones is returned.
+func (s *Store) ClearDedupe(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		if !strings.HasPrefix(key, dedupe.Prefix) {
+			key = dedupe.Prefix + key
+		}
+		full[i] = key
+	}
+	return s.cli.Del(ctx, full...).Result()
+}
+
+// ClearDedupeMatching deletes every dedupe marker whose key after the prefix matches a glob pattern
+func (s *Store) ClearDedupeMatching(ctx context.Context, match string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
+
+	var deleted int64
+	batch := make([]string, 0, scanCount)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := s.cli.Unlink(ctx, batch...).Result()
+		deleted += n
+		batch = batch[:0]
+		return err
+	}
+	iter := s.cli.Scan(ctx, 0, dedupePattern(match), scanCount).Iterator()
+	for iter.Next(ctx) {
+		if batch = append(batch, iter.Val()); len(batch) == scanCount {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	return deleted, flush()
+}
+
+func dedupePattern(match string) string {
+	if match == "" {
+		match = "*"
+	}
+	return dedupe.Prefix + match
+}
+
+// RebuildSeries replaces the series of a token with the sum of events, events of other tokens are skipped.
+// The new hash is written side by side and switched with RENAME, readers never see a partial series.
+// Its name is unique to the call and it expires with loadTimeout, so concurrent rebuilds of a token
+// don't share it and a failed one leaves nothing behind.
+// Dedupe markers of the events are set, so they are not counted again when redelivered.
+// The whole series is written to the updates stream as a backfill, so reader replicas follow.
+// Pending block entries of the token are dropped like replaceRange.lua does, the memory of writers
+// is not touched: they must be stopped while it runs.
+func (s *Store) RebuildSeries(ctx context.Context, token string, events []model.SwapEvent) (int, error) {
+	if token == "" {
+		return 0, errors.New("token required")
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
+
+	type minuteSum struct {
+		count         int64
+		usd, quantity float64
+	}
+	sums := make(map[int64]*minuteSum)
+	var dedupeKeys []string
+	for _, ev := range events {
+		if ev.TokenID != token {
+			continue
+		}
+		key, err := s.dedupeKey.Key(ev)
+		if err != nil {
+			return 0, fmt.Errorf("event %q: %w", ev.EventID, err)
+		}
+		dedupeKeys = append(dedupeKeys, key)
+
+		minute := ev.ExecutedAt.UTC().Unix() / 60
+		sum, ok := sums[minute]
+		if !ok {
+			sum = &minuteSum{}
+			sums[minute] = sum
+		}
+		sum.count++
+		sum.usd += ev.USD
+		sum.quantity += ev.Amount
+	}
+
+	fields := make(map[string]any, 3*len(sums))
+	buckets := make([]model.MinuteBucket, 0, len(sums))
+	for minute, sum := range sums {
+		m := strconv.FormatInt(minute, 10)
+		fields[m+"#c"] = sum.count
+		fields[m+"#u"] = strconv.FormatFloat(sum.usd, 'f', -1, 64)
+		fields[m+"#q"] = strconv.FormatFloat(sum.quantity, 'f', -1, 64)
+		buckets = append(buckets, model.MinuteBucket{Minute: minute,
+			Bucket: model.Bucket{Count: uint64(sum.count), USD: sum.usd, Quantity: sum.quantity}})
+	}
+	raw, err := encodeBuckets(buckets)
+	if err != nil {
+		return 0, err
+	}
+
+	blockFields, err := s.tokenBlockEntries(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+
+	key := seriesPrefix + token
+	tmp := key + ":rebuild:" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.FormatUint(rebuildSeq.Add(1), 36)
+	ttl := time.Duration(s.dedupleTTL) * time.Second
+	_, err = s.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for blockKey, fields := range blockFields {
+			p.HDel(ctx, blockKey, fields...)
+		}
+		if len(fields) == 0 {
+			p.Del(ctx, key)
+			p.SRem(ctx, s.tokensKey, token)
+		} else {
+			p.HSet(ctx, tmp, fields)
+			p.Expire(ctx, tmp, s.loadTimeout)
+			p.Rename(ctx, tmp, key)
+			p.Persist(ctx, key) // RENAME keeps the TTL of tmp
+			p.SAdd(ctx, s.tokensKey, token)
+			for _, k := range dedupeKeys {
+				p.Set(ctx, k, 1, ttl)
+			}
+		}
+		// the same entry as replaceRange.lua writes, over every minute
+		if s.updatesMaxLen > 0 {
+			p.XAdd(ctx, &redis.XAddArgs{
+				Stream: s.updatesKey,
+				MaxLen: s.updatesMaxLen,
+				Approx: true,
+				Values: []any{"kind", string(model.UpdateBackfill), "block", "0", "token", token,
+					"from", "0", "to", strconv.FormatInt(math.MaxInt64, 10), "buckets", raw},
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("rebuild %s: %w", key, err)
+	}
+	return len(dedupeKeys), nil
+}
+
+// tokenBlockEntries returns fields of pending block entries of token by block key
+func (s *Store) tokenBlockEntries(ctx context.Context, token string) (map[string][]string, error) {
+	numbers, err := s.cli.ZRange(ctx, blocksKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]string)
+	for _, n := range numbers {
+		entries, err := s.cli.HGetAll(ctx, blockPrefix+n).Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, raw := range entries {
+			swap, err := decodeBlockSwap(raw)
+			if err != nil {
+				return nil, err
+			}
+			if swap.Token == token {
+				out[blockPrefix+n] = append(out[blockPrefix+n], field)
+			}
+		}
+	}
+	return out, nil
+}
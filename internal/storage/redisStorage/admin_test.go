@@ -0,0 +1,189 @@
+package redisStorage
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+func TestDedupeKeys(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	at := time.Unix(1700000040, 0)
+	for _, id := range []string{"a-1", "a-2", "b-1"} {
+		if _, err := store.ApplyEvent(ctx, model.SwapEvent{EventID: id, TokenID: "BTC", Amount: 1, USD: 1, ExecutedAt: at}); err != nil {
+			t.Fatalf("ApplyEvent: %v", err)
+		}
+	}
+	cli.Set(ctx, "dedupe:forever", 1, 0)
+
+	tests := []struct {
+		match    string
+		limit    int
+		expected int
+	}{
+		{"", 0, 4},
+		{"a-*", 0, 2},
+		{"*", 2, 2},
+		{"c-*", 0, 0},
+	}
+	for _, tt := range tests {
+		keys, err := store.DedupeKeys(ctx, tt.match, tt.limit)
+		if err != nil {
+			t.Fatalf("DedupeKeys(%q): %v", tt.match, err)
+		}
+		if len(keys) != tt.expected {
+			t.Errorf("Expected %d keys for %q limit %d, got %+v", tt.expected, tt.match, tt.limit, keys)
+		}
+	}
+
+	keys, _ := store.DedupeKeys(ctx, "forever", 0)
+	if len(keys) != 1 || keys[0].TTL != 0 {
+		t.Errorf("Expected a key without TTL, got %+v", keys)
+	}
+	keys, _ = store.DedupeKeys(ctx, "a-1", 0)
+	if len(keys) != 1 || keys[0].TTL <= 0 || keys[0].TTL > time.Hour {
+		t.Errorf("Expected a key with the dedupe TTL, got %+v", keys)
+	}
+}
+
+func TestClearDedupe(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	ev := model.SwapEvent{EventID: "a-1", TokenID: "BTC", Amount: 1, USD: 1, ExecutedAt: time.Unix(1700000040, 0)}
+	if _, err := store.ApplyEvent(ctx, ev); err != nil {
+		t.Fatalf("ApplyEvent: %v", err)
+	}
+	cli.Set(ctx, "dedupe:a-2", 1, 0)
+	cli.Set(ctx, "dedupe:b-1", 1, 0)
+
+	if n, err := store.ClearDedupe(ctx, "a-1", "dedupe:a-2", "missing"); err != nil || n != 2 {
+		t.Fatalf("Expected 2 keys deleted, got %d, %v", n, err)
+	}
+	// cleared event is applied again
+	if applied, err := store.ApplyEvent(ctx, ev); err != nil || !applied {
+		t.Errorf("Expected the event applied again, got %v, %v", applied, err)
+	}
+
+	if n, err := store.ClearDedupeMatching(ctx, "*"); err != nil || n != 2 {
+		t.Errorf("Expected 2 keys deleted, got %d, %v", n, err)
+	}
+	if n := cli.Exists(ctx, "token_set").Val(); n != 1 {
+		t.Errorf("Expected only dedupe keys deleted")
+	}
+}
+
+func TestRebuildSeries(t *testing.T) {
+	store, cli := newTestStore(t, WithUpdateStream("updates", 100))
+	ctx := context.Background()
+	at := time.Unix(1700000040, 0)
+	minute := "28333334"
+
+	// drifted series, counted twice
+	for _, id := range []string{"ev-1", "ev-1b"} {
+		if _, err := store.ApplyEvent(ctx, model.SwapEvent{EventID: id, TokenID: "BTC", Amount: 1, USD: 100, ExecutedAt: at}); err != nil {
+			t.Fatalf("ApplyEvent: %v", err)
+		}
+	}
+	cli.HSet(ctx, "series:BTC", "1#c", 5) // garbage field
+
+	events := []model.SwapEvent{
+		{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 100, ExecutedAt: at},
+		{EventID: "ev-2", TokenID: "BTC", Amount: 0.5, USD: 50.25, ExecutedAt: at.Add(10 * time.Second)},
+		{EventID: "ev-3", TokenID: "BTC", Amount: 2, USD: 10, ExecutedAt: at.Add(time.Minute)},
+		{EventID: "ev-4", TokenID: "ETH", Amount: 7, USD: 7, ExecutedAt: at}, // other token
+	}
+	n, err := store.RebuildSeries(ctx, "BTC", events)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 events rebuilt, got %d, %v", n, err)
+	}
+
+	fields := cli.HGetAll(ctx, "series:BTC").Val()
+	expected := map[string]string{
+		minute + "#c": "2", minute + "#u": "150.25", minute + "#q": "1.5",
+		"28333335#c": "1", "28333335#u": "10", "28333335#q": "2",
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("Expected %s = %s, got %q", k, v, fields[k])
+		}
+	}
+	if len(cli.Keys(ctx, "series:BTC:rebuild*").Val()) != 0 || cli.Exists(ctx, "series:ETH").Val() != 0 {
+		t.Errorf("Expected only the BTC series written")
+	}
+	if ttl := cli.TTL(ctx, "series:BTC").Val(); ttl != -1 {
+		t.Errorf("Expected the series without TTL, got %v", ttl)
+	}
+	// replicas replay the whole series
+	msgs := cli.XRange(ctx, "updates", "-", "+").Val()
+	u, err := decodeUpdate(msgs[len(msgs)-1])
+	if err != nil {
+		t.Fatalf("decodeUpdate: %v", err)
+	}
+	if u.Kind != model.UpdateBackfill || u.Token != "BTC" || u.FromMinute != 0 || len(u.Buckets) != 2 {
+		t.Errorf("Expected backfill update of both BTC minutes, got %+v", u)
+	}
+
+	// rebuilt events are not counted again
+	if applied, err := store.ApplyEvent(ctx, events[2]); err != nil || applied {
+		t.Errorf("Expected rebuilt event to be a duplicate, got %v, %v", applied, err)
+	}
+
+	if _, err := store.RebuildSeries(ctx, "BTC", nil); err != nil {
+		t.Fatalf("RebuildSeries: %v", err)
+	}
+	if cli.Exists(ctx, "series:BTC").Val() != 0 || cli.SIsMember(ctx, "token_set", "BTC").Val() {
+		t.Errorf("Expected an empty rebuild to drop the series")
+	}
+}
+
+func TestRebuildSeriesConcurrent(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	at := time.Unix(1700000040, 0)
+
+	// two rebuilds of the same token from different event sets, one of them wins as a whole
+	sets := [][]model.SwapEvent{
+		{{EventID: "a-1", TokenID: "BTC", Amount: 1, USD: 100, ExecutedAt: at}},
+		{
+			{EventID: "b-1", TokenID: "BTC", Amount: 2, USD: 20, ExecutedAt: at},
+			{EventID: "b-2", TokenID: "BTC", Amount: 3, USD: 30, ExecutedAt: at.Add(time.Minute)},
+		},
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(sets))
+	for range 2 {
+		for _, events := range sets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.RebuildSeries(ctx, "BTC", events); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("RebuildSeries: %v", err)
+	}
+
+	fields := cli.HGetAll(ctx, "series:BTC").Val()
+	a := map[string]string{"28333334#c": "1", "28333334#u": "100", "28333334#q": "1"}
+	b := map[string]string{"28333334#c": "1", "28333334#u": "20", "28333334#q": "2",
+		"28333335#c": "1", "28333335#u": "30", "28333335#q": "3"}
+	if !maps.Equal(fields, a) && !maps.Equal(fields, b) {
+		t.Errorf("Expected the series of one rebuild, got %v", fields)
+	}
+	if keys := cli.Keys(ctx, "series:BTC:rebuild*").Val(); len(keys) != 0 {
+		t.Errorf("Expected no temporary hashes left, got %v", keys)
+	}
+}
@@ -0,0 +1,118 @@
+package redisStorage
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/bloom"
+)
+
+const filterCompleteCheck = time.Second
+
+// dedupeFilter is the first level dedupe check in front of the exact Redis key
+type dedupeFilter struct {
+	f bloom.Filter
+
+	complete  atomic.Bool  // once complete the filter stays complete
+	checkedAt atomic.Int64 // unix nano of the last completeness check
+
+	skipped        atomic.Uint64 // filter was sure the event is new
+	warming        atomic.Uint64 // new for the filter, but it is not complete yet
+	maybe          atomic.Uint64 // possible duplicates, checked exactly
+	falsePositives atomic.Uint64 // maybe, but the exact check said new
+	errors         atomic.Uint64
+}
+
+// DedupeFilterStats is reported in metrics
+type DedupeFilterStats struct {
+	bloom.Stats
+	Complete       bool    `json:"complete"`
+	Skipped        uint64  `json:"skipped"`
+	Warming        uint64  `json:"warming"`
+	Maybe          uint64  `json:"maybe"`
+	FalsePositives uint64  `json:"false_positives"`
+	ObservedFPRate float64 `json:"observed_fp_rate"` // false positives of all "maybe" answers
+	Errors         uint64  `json:"errors"`
+}
+
+// WithDedupeFilter puts a Bloom filter in front of the exact dedupe check
+func WithDedupeFilter(f bloom.Filter) Option {
+	return func(s *Store) {
+		if f != nil {
+			s.filter = &dedupeFilter{f: f}
+		}
+	}
+}
+
+// check adds key to the filter, skip is true if the exact check is not needed
+func (d *dedupeFilter) check(ctx context.Context, key string) (maybe, skip bool) {
+	seen, err := d.f.TestAndAdd(ctx, key)
+	switch {
+	case err != nil:
+		d.errors.Add(1)
+		log.Printf("[warning] Dedupe filter failed: %v", err)
+		return false, false
+	case seen:
+		d.maybe.Add(1)
+		return true, false
+	case !d.isComplete(ctx):
+		d.warming.Add(1)
+		return false, false
+	}
+	d.skipped.Add(1)
+	return false, true
+}
+
+// add puts keys written without ApplyEvent into the filter
+func (d *dedupeFilter) add(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if _, err := d.f.TestAndAdd(ctx, key); err != nil {
+			d.errors.Add(1)
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dedupeFilter) isComplete(ctx context.Context) bool {
+	if d.complete.Load() {
+		return true
+	}
+	now := time.Now().UnixNano()
+	last := d.checkedAt.Load()
+	if now-last < int64(filterCompleteCheck) || !d.checkedAt.CompareAndSwap(last, now) {
+		return false
+	}
+	ok, err := d.f.Complete(ctx)
+	if err != nil {
+		d.errors.Add(1)
+		return false
+	}
+	if ok {
+		d.complete.Store(true)
+	}
+	return ok
+}
+
+// DedupeFilterStats returns nil if there is no filter
+func (s *Store) DedupeFilterStats() *DedupeFilterStats {
+	if s.filter == nil {
+		return nil
+	}
+	d := s.filter
+	st := &DedupeFilterStats{
+		Stats:          d.f.Stats(),
+		Complete:       d.complete.Load(),
+		Skipped:        d.skipped.Load(),
+		Warming:        d.warming.Load(),
+		Maybe:          d.maybe.Load(),
+		FalsePositives: d.falsePositives.Load(),
+		Errors:         d.errors.Load(),
+	}
+	if st.Maybe > 0 {
+		st.ObservedFPRate = float64(st.FalsePositives) / float64(st.Maybe)
+	}
+	return st
+}
@@ -1,17 +1,23 @@
--- KEYS: dedupeKey, seriesKey, tokensSet
--- ARGV:  minute, usd, qty, ttlSeconds, token
+-- KEYS: dedupeKey, seriesKey, tokensSet, blockKey, blocksSet, updatesStream
+-- ARGV:  eventID, minute, usd, qty, ttlSeconds, token, blockNumber, blockHash, known, updatesMaxLen
+-- known == "0" when the dedupe filter is sure the event is new, the exact check is skipped
+-- updatesMaxLen == "0" disables the update stream for reader replicas
 local dedupeKey = KEYS[1]
 local seriesKey = KEYS[2]
 local tokensSet = KEYS[3]
+local blockKey  = KEYS[4]
+local blocksSet = KEYS[5]
+local updates   = KEYS[6]
 
 local _ = ARGV[1] --eventID
 local minute = ARGV[2]
 local usd    = ARGV[3]
 local qty    = ARGV[4]
 local ttl    = tonumber(ARGV[5])
+local block  = tonumber(ARGV[7])
 
 -- check for duplicate event
-if redis.call("EXISTS", dedupeKey) == 1 then
+if ARGV[9] ~= "0" and redis.call("EXISTS", dedupeKey) == 1 then
   return 0
 end
 
@@ -30,4 +36,18 @@ redis.call("HINCRBYFLOAT",  seriesKey, minute .. "#q", qty)
 -- this is used to prevent duplicate events in the same minute
 redis.call("SADD", tokensSet, ARGV[6])
 
-return 1
\ No newline at end of file
+-- readers replay the stream in the order of writes
+local maxLen = tonumber(ARGV[10])
+if maxLen and maxLen > 0 then
+  redis.call("XADD", updates, "MAXLEN", "~", maxLen, "*",
+    "kind", "swap", "token", ARGV[6], "minute", minute, "usd", usd, "qty", qty, "block", ARGV[7], "hash", ARGV[8])
+end
+
+-- remember what the event added, so an orphaned block can be retracted,
+-- final blocks are pruned by the caller with pruneBlocks.lua
+if block and block > 0 then
+  redis.call("HSET", blockKey, dedupeKey, cjson.encode({ARGV[6], minute, usd, qty, ARGV[8]}))
+  redis.call("ZADD", blocksSet, block, ARGV[7])
+end
+
+return 1
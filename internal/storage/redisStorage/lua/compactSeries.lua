@@ -0,0 +1,20 @@
+-- KEYS: seriesKey, fenceKey
+-- ARGV:  cutoffMinute, fence
+-- deletes buckets older than cutoff, returns -1 if a newer leader has compacted already
+local seen = tonumber(redis.call("GET", KEYS[2]) or "0")
+local fence = tonumber(ARGV[2])
+if fence < seen then
+  return -1
+end
+redis.call("SET", KEYS[2], ARGV[2])
+
+local cutoff = tonumber(ARGV[1])
+local removed = 0
+for _, field in ipairs(redis.call("HKEYS", KEYS[1])) do
+  local minute = tonumber(string.match(field, "^(%d+)#"))
+  if minute and minute < cutoff then
+    redis.call("HDEL", KEYS[1], field)
+    removed = removed + 1
+  end
+end
+return removed
@@ -0,0 +1,14 @@
+-- KEYS: blocksSet, then the block keys
+-- ARGV:  cutoff (blocks below it are final), then the number of every block key
+-- forgets final blocks read by the caller, a block retracted meanwhile is skipped
+local cutoff = tonumber(ARGV[1])
+local pruned = 0
+for i = 2, #KEYS do
+  local score = redis.call("ZSCORE", KEYS[1], ARGV[i])
+  if score and tonumber(score) < cutoff then
+    redis.call("DEL", KEYS[i])
+    redis.call("ZREM", KEYS[1], ARGV[i])
+    pruned = pruned + 1
+  end
+end
+return pruned
@@ -0,0 +1,46 @@
+-- KEYS: seriesKey, tokensSet, updatesStream, blocksSet, then the key of every pending block
+-- ARGV:  token, fromMinute, toMinute (exclusive), buckets, updatesMaxLen, blockPrefix
+-- buckets is a json array of [minute, count, usd, qty] strings, minutes without one are left empty
+-- replaces buckets of the range and drops block entries of the token in it, dedupe keys are set by the caller
+local seriesKey = KEYS[1]
+local from = tonumber(ARGV[2])
+local to   = tonumber(ARGV[3])
+
+for _, field in ipairs(redis.call("HKEYS", seriesKey)) do
+  local minute = tonumber(string.match(field, "^(%d+)#"))
+  if minute and minute >= from and minute < to then
+    redis.call("HDEL", seriesKey, field)
+  end
+end
+
+local buckets = cjson.decode(ARGV[4])
+for _, b in ipairs(buckets) do
+  redis.call("HSET", seriesKey, b[1] .. "#c", b[2], b[1] .. "#u", b[3], b[1] .. "#q", b[4])
+end
+if #buckets > 0 then
+  redis.call("SADD", KEYS[2], ARGV[1])
+end
+
+-- swaps of the range are part of the new totals, a retraction must not subtract them again
+for i = 5, #KEYS do
+  local blockKey = KEYS[i]
+  local entries = redis.call("HGETALL", blockKey)
+  for j = 1, #entries, 2 do
+    local e = cjson.decode(entries[j + 1]) -- token, minute, usd, qty, blockHash
+    local minute = tonumber(e[2])
+    if e[1] == ARGV[1] and minute >= from and minute < to then
+      redis.call("HDEL", blockKey, entries[j])
+    end
+  end
+  if redis.call("HLEN", blockKey) == 0 then
+    redis.call("ZREM", KEYS[4], string.sub(blockKey, #ARGV[6] + 1))
+  end
+end
+
+local maxLen = tonumber(ARGV[5])
+if maxLen and maxLen > 0 then
+  redis.call("XADD", KEYS[3], "MAXLEN", "~", maxLen, "*",
+    "kind", "backfill", "block", "0", "token", ARGV[1], "from", ARGV[2], "to", ARGV[3], "buckets", ARGV[4])
+end
+
+return #buckets
@@ -0,0 +1,56 @@
+-- KEYS: blockKey, blocksSet, updatesStream, then the dedupe and series keys of the retracted swaps
+-- ARGV:  blockNumber, blockHash (empty retracts the whole block), seriesPrefix, updatesMaxLen
+-- returns stored entries of retracted swaps. The caller reads the block to name every key,
+-- when a swap of another key was added since, nothing is changed and false is returned.
+local blockKey  = KEYS[1]
+local blocksSet = KEYS[2]
+local hash      = ARGV[2]
+
+local declared = {}
+for i = 4, #KEYS do
+  declared[KEYS[i]] = true
+end
+
+local function negate(v)
+  if string.sub(v, 1, 1) == "-" then
+    return string.sub(v, 2)
+  end
+  return "-" .. v
+end
+
+local entries = redis.call("HGETALL", blockKey)
+local matched = {}
+for i = 1, #entries, 2 do
+  local e = cjson.decode(entries[i + 1]) -- token, minute, usd, qty, blockHash
+  if hash == "" or e[5] == hash then
+    if not declared[entries[i]] or not declared[ARGV[3] .. e[1]] then
+      return false
+    end
+    table.insert(matched, {entries[i], entries[i + 1], e})
+  end
+end
+
+local out = {}
+for _, m in ipairs(matched) do
+  local dedupeKey, e = m[1], m[3]
+  local seriesKey = ARGV[3] .. e[1]
+  redis.call("HINCRBY",      seriesKey, e[2] .. "#c", -1)
+  redis.call("HINCRBYFLOAT", seriesKey, e[2] .. "#u", negate(e[3]))
+  redis.call("HINCRBYFLOAT", seriesKey, e[2] .. "#q", negate(e[4]))
+  -- the swap may be included again by the canonical chain
+  redis.call("DEL", dedupeKey)
+  redis.call("HDEL", blockKey, dedupeKey)
+  table.insert(out, m[2])
+end
+
+local maxLen = tonumber(ARGV[4])
+if #out > 0 and maxLen and maxLen > 0 then
+  redis.call("XADD", KEYS[3], "MAXLEN", "~", maxLen, "*",
+    "kind", "retract", "block", ARGV[1], "hash", hash, "swaps", cjson.encode(out))
+end
+
+if redis.call("HLEN", blockKey) == 0 then
+  redis.call("ZREM", blocksSet, ARGV[1])
+end
+
+return out
@@ -0,0 +1,219 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const snapshotAttempts = 5
+
+// Snapshot reads every series, pending blocks and id of the last update in one transaction,
+// so a reader which replays updates after lastID neither misses nor doubles a swap.
+// Keys are listed before the transaction, it is retried if tokens or blocks changed meanwhile.
+func (s *Store) Snapshot(ctx context.Context) (map[string]map[string]string, map[uint64][]model.BlockSwap, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
+	for attempt := 0; attempt < snapshotAttempts; attempt++ {
+		tokens, err := s.cli.SMembers(ctx, s.tokensKey).Result()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		numbers, err := s.cli.ZRange(ctx, blocksKey, 0, -1).Result()
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		var (
+			tokensCmd  *redis.StringSliceCmd
+			numbersCmd *redis.StringSliceCmd
+			seriesCmds = make([]*redis.MapStringStringCmd, len(tokens))
+			blockCmds  = make([]*redis.StringSliceCmd, len(numbers))
+			lastCmd    *redis.XMessageSliceCmd
+		)
+		_, err = s.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			tokensCmd = p.SMembers(ctx, s.tokensKey)
+			numbersCmd = p.ZRange(ctx, blocksKey, 0, -1)
+			for i, token := range tokens {
+				seriesCmds[i] = p.HGetAll(ctx, seriesPrefix+token)
+			}
+			for i, n := range numbers {
+				blockCmds[i] = p.HVals(ctx, blockPrefix+n)
+			}
+			lastCmd = p.XRevRangeN(ctx, s.updatesKey, "+", "-", 1)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if !sameMembers(tokens, tokensCmd.Val()) || !slices.Equal(numbers, numbersCmd.Val()) {
+			continue
+		}
+
+		series := make(map[string]map[string]string, len(tokens))
+		for i, token := range tokens {
+			series[token] = seriesCmds[i].Val()
+		}
+		blocks := make(map[uint64][]model.BlockSwap, len(numbers))
+		for i, n := range numbers {
+			number, err := strconv.ParseUint(n, 10, 64)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("bad block number %q: %w", n, err)
+			}
+			for _, raw := range blockCmds[i].Val() {
+				swap, err := decodeBlockSwap(raw)
+				if err != nil {
+					return nil, nil, "", err
+				}
+				blocks[number] = append(blocks[number], swap)
+			}
+		}
+		lastID := "0-0"
+		if last := lastCmd.Val(); len(last) > 0 {
+			lastID = last[0].ID
+		}
+		return series, blocks, lastID, nil
+	}
+	return nil, nil, "", errors.New("snapshot: tokens and blocks kept changing")
+}
+
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// ReadUpdates returns at most count updates after id, waiting up to block for new ones
+// (block <= 0 doesn't wait), no updates and no error means the reader is caught up
+func (s *Store) ReadUpdates(ctx context.Context, after string, count int64, block time.Duration) ([]model.Update, error) {
+	if block <= 0 {
+		block = -1 // go-redis omits BLOCK, zero would wait forever
+	}
+	ctx, cancel := context.WithTimeout(ctx, max(block, 0)+s.readTimeout)
+	defer cancel()
+	streams, err := s.cli.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{s.updatesKey, after},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []model.Update
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			u, err := decodeUpdate(msg)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// UpdatesEnabled reports whether writes are recorded in the update stream
+func (s *Store) UpdatesEnabled() bool {
+	return s.updatesMaxLen > 0
+}
+
+// OldestUpdateID returns id of the first update still kept, empty for an empty stream.
+// A reader behind it has missed trimmed updates and must take a new snapshot.
+func (s *Store) OldestUpdateID(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.readTimeout)
+	defer cancel()
+	msgs, err := s.cli.XRangeN(ctx, s.updatesKey, "-", "+", 1).Result()
+	if err != nil || len(msgs) == 0 {
+		return "", err
+	}
+	return msgs[0].ID, nil
+}
+
+// LastUpdateID returns id of the newest update, "0-0" for an empty stream.
+// Callers serialize it with writes they want it to cover.
+func (s *Store) LastUpdateID(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.readTimeout)
+	defer cancel()
+	msgs, err := s.cli.XRevRangeN(ctx, s.updatesKey, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "0-0", nil
+	}
+	return msgs[0].ID, nil
+}
+
+// decodeUpdate parses stream entry written by applyEvent.lua, retractBlock.lua, replaceRange.lua or ConfirmBlocks
+func decodeUpdate(msg redis.XMessage) (model.Update, error) {
+	field := func(name string) string {
+		v, _ := msg.Values[name].(string)
+		return v
+	}
+	u := model.Update{
+		ID:        msg.ID,
+		Kind:      model.UpdateKind(field("kind")),
+		BlockHash: field("hash"),
+	}
+	var err error
+	if u.BlockNumber, err = strconv.ParseUint(field("block"), 10, 64); err != nil {
+		return model.Update{}, fmt.Errorf("update %s: bad block: %w", msg.ID, err)
+	}
+
+	switch u.Kind {
+	case model.UpdateSwap:
+		swap := model.BlockSwap{Token: field("token"), BlockHash: u.BlockHash}
+		if swap.Minute, err = strconv.ParseInt(field("minute"), 10, 64); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad minute: %w", msg.ID, err)
+		}
+		if swap.USD, err = strconv.ParseFloat(field("usd"), 64); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad usd: %w", msg.ID, err)
+		}
+		if swap.Quantity, err = strconv.ParseFloat(field("qty"), 64); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad qty: %w", msg.ID, err)
+		}
+		u.Swaps = []model.BlockSwap{swap}
+	case model.UpdateRetract:
+		var entries []string
+		if err := json.Unmarshal([]byte(field("swaps")), &entries); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad swaps: %w", msg.ID, err)
+		}
+		for _, raw := range entries {
+			swap, err := decodeBlockSwap(raw)
+			if err != nil {
+				return model.Update{}, err
+			}
+			u.Swaps = append(u.Swaps, swap)
+		}
+	case model.UpdateBackfill:
+		u.Token = field("token")
+		if u.FromMinute, err = strconv.ParseInt(field("from"), 10, 64); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad from: %w", msg.ID, err)
+		}
+		if u.ToMinute, err = strconv.ParseInt(field("to"), 10, 64); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad to: %w", msg.ID, err)
+		}
+		if u.Buckets, err = decodeBuckets(field("buckets")); err != nil {
+			return model.Update{}, fmt.Errorf("update %s: bad buckets: %w", msg.ID, err)
+		}
+	case model.UpdateConfirm:
+	default:
+		return model.Update{}, fmt.Errorf("update %s: unknown kind %q", msg.ID, u.Kind)
+	}
+	return u, nil
+}
@@ -0,0 +1,294 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SchemaVersion is the Redis layout this build reads and writes:
+//
+//	series:<token>      hash "<minute>#c|u|q" -> count, usd, quantity
+//	<tokens key>        set of tokens with a series
+//	dedupe:<key>        applied event marker with TTL
+//	lastEventID         checkpoint
+//	blocks, block:<n>   swaps of blocks which are not final yet
+//	updates             stream of applied swaps, retractions and backfills for replicas
+const SchemaVersion = 1
+
+const (
+	schemaKey      = "schema:version"
+	schemaLockKey  = "schema:lock"
+	defaultLockTTL = time.Minute
+)
+
+var (
+	// ErrSchemaOutdated means data was written by an older build, run migrate
+	ErrSchemaOutdated = errors.New("redis schema is outdated, run migrate")
+	// ErrSchemaUnknown means data was written by a newer build
+	ErrSchemaUnknown = errors.New("redis schema is unknown to this build")
+	// ErrMigrationRunning means another instance holds the migration lock
+	ErrMigrationRunning = errors.New("another migration is running")
+	// ErrMigrationLockLost means the lock expired during a migration, another instance may have taken it
+	ErrMigrationLockLost = errors.New("migration lock lost")
+)
+
+// Migration upgrades the layout to Version. Up must be idempotent: the version is saved
+// after every migration, a migration interrupted midway is run again from the start.
+// It changes keys in place or writes new ones side by side and switches with RENAME.
+// Nil Up only records the version, writers stamp such migrations themselves.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, cli *redis.Client) error
+}
+
+// migrations in order, the last one is SchemaVersion
+var migrations = []Migration{
+	// layout written before the version was stored, nothing to change
+	{Version: 1, Name: "baseline"},
+}
+
+// Migrator checks and upgrades the Redis layout
+type Migrator struct {
+	cli        *redis.Client
+	tokensKey  string
+	migrations []Migration
+	latest     int
+	lockTTL    time.Duration
+}
+
+func NewMigrator(cli *redis.Client, tokensKey string) *Migrator {
+	return &Migrator{
+		cli:        cli,
+		tokensKey:  tokensKey,
+		migrations: migrations,
+		latest:     SchemaVersion,
+		lockTTL:    defaultLockTTL,
+	}
+}
+
+// Version returns the stored schema version, 0 for data written before versioning
+// and for an empty database, empty tells them apart
+func (m *Migrator) Version(ctx context.Context) (version int, empty bool, err error) {
+	raw, err := m.cli.Get(ctx, schemaKey).Result()
+	if err == nil {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, false, fmt.Errorf("bad schema version %q: %w", raw, err)
+		}
+		return v, false, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return 0, false, err
+	}
+
+	n, err := m.cli.Exists(ctx, m.tokensKey).Result()
+	if err != nil || n > 0 {
+		return 0, false, err
+	}
+	// a page may have no match while later ones have, the iterator goes on until the cursor is 0
+	iter := m.cli.Scan(ctx, 0, seriesPrefix+"*", 100).Iterator()
+	found := iter.Next(ctx)
+	if err := iter.Err(); err != nil {
+		return 0, false, err
+	}
+	return 0, !found, nil
+}
+
+// EnsureSchema lets an instance start only on the layout of this build.
+// An empty database is stamped with the current version when writable is set,
+// so is data whose pending migrations only record the version, like unversioned data of the baseline.
+func (m *Migrator) EnsureSchema(ctx context.Context, writable bool) error {
+	version, empty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == m.latest:
+		return nil
+	case version > m.latest:
+		return fmt.Errorf("%w: version %d, this build knows up to %d", ErrSchemaUnknown, version, m.latest)
+	case empty && !writable:
+		return nil // a replica of a writer which has not started yet
+	case empty:
+		// another writer may stamp it meanwhile, both stamp the same version
+		return m.cli.SetNX(ctx, schemaKey, m.latest, 0).Err()
+	case m.onlyStamps(version) && !writable:
+		return nil // the layout is the same, a writer stamps it
+	case m.onlyStamps(version):
+		return m.stamp(ctx)
+	default:
+		return fmt.Errorf("%w: version %d, this build needs %d", ErrSchemaOutdated, version, m.latest)
+	}
+}
+
+// onlyStamps reports whether every migration after version leaves the data as it is
+func (m *Migrator) onlyStamps(version int) bool {
+	for _, mg := range m.migrations {
+		if mg.Version > version && mg.Up != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// stamp records migrations which don't change data under the migration lock,
+// a writer starting meanwhile waits for the one holding the lock
+func (m *Migrator) stamp(ctx context.Context) error {
+	deadline := time.Now().Add(m.lockTTL)
+	for {
+		_, err := m.Migrate(ctx)
+		if !errors.Is(err, ErrMigrationRunning) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		version, _, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if version >= m.latest {
+			return m.EnsureSchema(ctx, true)
+		}
+	}
+}
+
+// Pending returns migrations which are not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	version, _, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > m.latest {
+		return nil, fmt.Errorf("%w: version %d, this build knows up to %d", ErrSchemaUnknown, version, m.latest)
+	}
+	var pending []Migration
+	for _, mg := range m.migrations {
+		if mg.Version > version {
+			pending = append(pending, mg)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies pending migrations in order under a lock, so two instances never migrate at once.
+// The lock is renewed while migrating and every version is saved only while it is still held.
+// Every applied migration is returned, also when a later one fails.
+func (m *Migrator) Migrate(ctx context.Context) ([]Migration, error) {
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ok, err := m.cli.SetNX(ctx, schemaLockKey, token, m.lockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMigrationRunning
+	}
+	defer func() {
+		// a fresh ctx, the lock must be freed when ctx is cancelled too
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		defer cancel()
+		_ = releaseLockScript.Run(ctx, m.cli, []string{schemaLockKey}, token).Err()
+	}()
+
+	// migrations stop once the lock is lost, before the release above
+	ctx, cancel := context.WithCancelCause(ctx)
+	var renewing sync.WaitGroup
+	renewing.Add(1)
+	go func() {
+		defer renewing.Done()
+		m.keepLock(ctx, cancel, token)
+	}()
+	defer func() {
+		cancel(nil)
+		renewing.Wait()
+	}()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, mg := range pending {
+		if mg.Up != nil {
+			if err := mg.Up(ctx, m.cli); err != nil {
+				if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+					err = cause
+				}
+				return applied, fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, err)
+			}
+		}
+		saved, err := saveVersionScript.Run(ctx, m.cli, []string{schemaLockKey, schemaKey}, token, mg.Version).Int()
+		if err != nil {
+			return applied, fmt.Errorf("save schema version %d: %w", mg.Version, err)
+		}
+		if saved == 0 {
+			return applied, fmt.Errorf("save schema version %d: %w", mg.Version, ErrMigrationLockLost)
+		}
+		applied = append(applied, mg)
+	}
+	return applied, nil
+}
+
+// keepLock renews the lock three times per ttl until ctx is done, a lost lock cancels ctx
+func (m *Migrator) keepLock(ctx context.Context, cancel context.CancelCauseFunc, token string) {
+	t := time.NewTicker(m.lockTTL / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			held, err := renewLockScript.Run(ctx, m.cli, []string{schemaLockKey}, token, m.lockTTL.Milliseconds()).Int()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println("[warning] Failed to renew migration lock:", err)
+				}
+				continue // the version is saved only under the lock anyway
+			}
+			if held == 0 {
+				cancel(ErrMigrationLockLost)
+				return
+			}
+		}
+	}
+}
+
+// deletes the lock only if it is still held by the caller
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// extends the lock only if it is still held by the caller
+// KEYS: lock ARGV: token, ttl ms
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// saves the version only if the lock is still held by the caller
+// KEYS: lock, version ARGV: token, version
+var saveVersionScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  redis.call("SET", KEYS[2], ARGV[2])
+  return 1
+end
+return 0
+`)
@@ -0,0 +1,232 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSchemaVersionMatchesMigrations(t *testing.T) {
+	last := migrations[len(migrations)-1]
+	if last.Version != SchemaVersion {
+		t.Errorf("Expected the last migration to be version %d, got %d", SchemaVersion, last.Version)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, m.Version)
+		}
+	}
+}
+
+func TestEnsureSchema(t *testing.T) {
+	current := strconv.Itoa(SchemaVersion)
+	tests := []struct {
+		name     string
+		setup    func(cli *redis.Client)
+		writable bool
+		want     error
+		version  string
+	}{
+		{"empty writer stamps", func(*redis.Client) {}, true, nil, current},
+		{"empty reader waits", func(*redis.Client) {}, false, nil, ""},
+		{"current", func(cli *redis.Client) { cli.Set(context.Background(), schemaKey, SchemaVersion, 0) }, true, nil, current},
+		{"unversioned data writer stamps", func(cli *redis.Client) { cli.SAdd(context.Background(), "token_set", "BTC") }, true, nil, current},
+		{"unversioned series reader starts", func(cli *redis.Client) { cli.HSet(context.Background(), "series:BTC", "1#c", 1) }, false, nil, ""},
+		{"newer", func(cli *redis.Client) { cli.Set(context.Background(), schemaKey, SchemaVersion+1, 0) }, true, ErrSchemaUnknown, strconv.Itoa(SchemaVersion + 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cli := newTestStore(t)
+			ctx := context.Background()
+			tt.setup(cli)
+
+			err := NewMigrator(cli, "token_set").EnsureSchema(ctx, tt.writable)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if got, _ := cli.Get(ctx, schemaKey).Result(); got != tt.version {
+				t.Errorf("Expected stored version %q, got %q", tt.version, got)
+			}
+		})
+	}
+}
+
+func TestEnsureSchemaWaitsForStamp(t *testing.T) {
+	_, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.SAdd(ctx, "token_set", "BTC")
+	cli.Set(ctx, schemaLockKey, "other", time.Minute) // another writer is stamping
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		cli.Set(ctx, schemaKey, SchemaVersion, 0)
+		cli.Del(ctx, schemaLockKey)
+	}()
+	if err := NewMigrator(cli, "token_set").EnsureSchema(ctx, true); err != nil {
+		t.Fatalf("Expected the stamp of the other writer accepted, got %v", err)
+	}
+}
+
+// splits "<minute>#c" counts of every series into buys and sells, all old swaps count as buys
+func splitSides(ctx context.Context, cli *redis.Client) error {
+	iter := cli.Scan(ctx, 0, seriesPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		fields, err := cli.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		for field, v := range fields {
+			if minute, ok := strings.CutSuffix(field, "#c"); ok {
+				if err := cli.HSet(ctx, key, minute+"#cb", v, minute+"#cs", 0).Err(); err != nil {
+					return err
+				}
+				if err := cli.HDel(ctx, key, field).Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return iter.Err()
+}
+
+func newTestMigrator(cli *redis.Client, up func(ctx context.Context, cli *redis.Client) error) *Migrator {
+	m := NewMigrator(cli, "token_set")
+	m.migrations = []Migration{
+		{Version: 1, Name: "baseline"},
+		{Version: 2, Name: "split sides", Up: up},
+	}
+	m.latest = 2
+	return m
+}
+
+func TestMigrate(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.SAdd(ctx, "token_set", "BTC", "ETH")
+	cli.HSet(ctx, "series:BTC", "100#c", 2, "100#u", 30.5, "100#q", 1)
+	cli.HSet(ctx, "series:ETH", "101#c", 1, "101#u", 4, "101#q", 2)
+
+	m := newTestMigrator(cli, splitSides)
+	if err := m.EnsureSchema(ctx, true); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("Expected outdated schema before migrate, got %v", err)
+	}
+
+	applied, err := m.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) != 2 || applied[1].Name != "split sides" {
+		t.Fatalf("Expected 2 applied migrations, got %+v", applied)
+	}
+	if err := m.EnsureSchema(ctx, true); err != nil {
+		t.Errorf("Expected current schema after migrate, got %v", err)
+	}
+	btc := cli.HGetAll(ctx, "series:BTC").Val()
+	if btc["100#cb"] != "2" || btc["100#cs"] != "0" || btc["100#u"] != "30.5" || btc["100#c"] != "" {
+		t.Errorf("Expected BTC series rewritten, got %v", btc)
+	}
+	// the data layout of this build still loads the untouched fields
+	if tokens, err := store.Tokens(ctx); err != nil || len(tokens) != 2 {
+		t.Errorf("Expected 2 tokens, got %v, %v", tokens, err)
+	}
+
+	if applied, err := m.Migrate(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing to migrate twice, got %+v, %v", applied, err)
+	}
+}
+
+func TestMigrateResumesAfterFailure(t *testing.T) {
+	_, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.HSet(ctx, "series:BTC", "100#c", 2)
+
+	fail := errors.New("connection lost")
+	calls := 0
+	m := newTestMigrator(cli, func(context.Context, *redis.Client) error {
+		calls++
+		if calls == 1 {
+			return fail
+		}
+		return nil
+	})
+
+	applied, err := m.Migrate(ctx)
+	if !errors.Is(err, fail) || len(applied) != 1 {
+		t.Fatalf("Expected baseline applied before the failure, got %+v, %v", applied, err)
+	}
+	if v, _, _ := m.Version(ctx); v != 1 {
+		t.Errorf("Expected version 1 after the failure, got %d", v)
+	}
+	if n := cli.Exists(ctx, schemaLockKey).Val(); n != 0 {
+		t.Errorf("Expected lock released after the failure")
+	}
+
+	applied, err = m.Migrate(ctx)
+	if err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("Expected migration 2 applied on retry, got %+v, %v", applied, err)
+	}
+}
+
+func TestMigrateLocked(t *testing.T) {
+	_, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.Set(ctx, schemaLockKey, "other", 0)
+
+	if _, err := NewMigrator(cli, "token_set").Migrate(ctx); !errors.Is(err, ErrMigrationRunning) {
+		t.Fatalf("Expected %v, got %v", ErrMigrationRunning, err)
+	}
+	if got := cli.Get(ctx, schemaLockKey).Val(); got != "other" {
+		t.Errorf("Expected the lock of the other instance kept, got %q", got)
+	}
+}
+
+func TestMigrateRenewsLock(t *testing.T) {
+	_, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.HSet(ctx, "series:BTC", "100#c", 2)
+
+	var ttl time.Duration
+	m := newTestMigrator(cli, func(ctx context.Context, cli *redis.Client) error {
+		// a migration longer than the lock ttl
+		cli.PExpire(ctx, schemaLockKey, time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		ttl = cli.PTTL(ctx, schemaLockKey).Val()
+		return nil
+	})
+	m.lockTTL = 90 * time.Millisecond
+
+	if _, err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if ttl != m.lockTTL {
+		t.Errorf("Expected lock renewed to %v while migrating, got %v", m.lockTTL, ttl)
+	}
+}
+
+func TestMigrateStopsWhenLockLost(t *testing.T) {
+	_, cli := newTestStore(t)
+	ctx := context.Background()
+	cli.HSet(ctx, "series:BTC", "100#c", 2)
+
+	m := newTestMigrator(cli, func(ctx context.Context, cli *redis.Client) error {
+		// the lock expired and another instance took it
+		cli.Set(ctx, schemaLockKey, "other", 0)
+		return nil
+	})
+	applied, err := m.Migrate(ctx)
+	if !errors.Is(err, ErrMigrationLockLost) || len(applied) != 1 {
+		t.Fatalf("Expected %v after the baseline, got %+v, %v", ErrMigrationLockLost, applied, err)
+	}
+	if v, _, _ := m.Version(ctx); v != 1 {
+		t.Errorf("Expected version 1 kept without the lock, got %d", v)
+	}
+	if got := cli.Get(ctx, schemaLockKey).Val(); got != "other" {
+		t.Errorf("Expected the lock of the other instance kept, got %q", got)
+	}
+}
@@ -2,11 +2,14 @@ package redisStorage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/dedupe"
 	"Dexcelerate_swap_stats/internal/model"
 
 	"github.com/redis/go-redis/v9"
@@ -19,42 +22,154 @@ import (
 //go:embed lua/applyEvent.lua
 var LuaScript string
 
+//go:embed lua/retractBlock.lua
+var retractScript string
+
+//go:embed lua/compactSeries.lua
+var compactScript string
+
+//go:embed lua/replaceRange.lua
+var replaceRangeScript string
+
+//go:embed lua/pruneBlocks.lua
+var pruneBlocksScript string
+
+// Scripts touch only keys passed in KEYS, as Redis requires for proxies and Redis Cluster to route them.
+// Keys which depend on stored data are read by the caller first and checked again by the script.
+
+// ErrFenced means a leader with a newer fencing token has written already
+var ErrFenced = errors.New("redis storage: stale fencing token")
+
+const (
+	blockPrefix          = "block:"
+	defaultUpdatesKey    = "updates"
+	blocksKey            = "blocks"
+	compactFenceKey      = "compact:fence"
+	seriesPrefix         = "series:"
+	defaultConfirmations = 64
+	defaultReadTimeout   = 2 * time.Second
+	defaultWriteTimeout  = 2 * time.Second
+	defaultLoadTimeout   = 30 * time.Second
+)
+
 type Store struct {
-	cli          *redis.Client
-	dedupleTTL   int64
-	tokensKey    string
-	ctx          context.Context
-	script       string
-	eventCounter int64
-	lastEventKey string
+	cli           *redis.Client
+	dedupleTTL    int64
+	tokensKey     string
+	readTimeout   time.Duration // single reads
+	writeTimeout  time.Duration // single writes and scripts
+	loadTimeout   time.Duration // whole state loads
+	script        string
+	eventCounter  int64
+	lastEventKey  string
+	lastApplied   string // not yet checkpointed event id
+	confirmations uint64
+	dedupeKey     *dedupe.Keyer
+	filter        *dedupeFilter
+	updatesKey    string
+	updatesMaxLen int64 // 0 disables the update stream
 }
 
-func NewStore(cli *redis.Client, tokensKey string, dedupleTTL time.Duration) *Store {
-	return &Store{
-		cli:          cli,
-		dedupleTTL:   int64(dedupleTTL.Seconds()),
-		tokensKey:    tokensKey,
-		ctx:          context.Background(),
-		script:       LuaScript,
-		eventCounter: 0,
-		lastEventKey: "lastEventID",
+type Option func(*Store)
+
+// WithConfirmations sets how many blocks applied swaps are remembered for retraction
+func WithConfirmations(n uint64) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.confirmations = n
+		}
+	}
+}
+
+// WithDedupeKey sets how the dedupe key of an event is derived, event id by default
+func WithDedupeKey(k *dedupe.Keyer) Option {
+	return func(s *Store) {
+		if k != nil {
+			s.dedupeKey = k
+		}
 	}
 }
 
+// WithTimeouts bounds every operation on top of the caller's ctx:
+// read for single reads, write for writes and scripts, load for loading the whole state.
+// Zero keeps the default.
+func WithTimeouts(read, write, load time.Duration) Option {
+	return func(s *Store) {
+		if read > 0 {
+			s.readTimeout = read
+		}
+		if write > 0 {
+			s.writeTimeout = write
+		}
+		if load > 0 {
+			s.loadTimeout = load
+		}
+	}
+}
+
+// WithUpdateStream publishes applied swaps and retractions to a stream
+// capped at about maxLen entries, reader replicas tail it
+func WithUpdateStream(key string, maxLen int64) Option {
+	return func(s *Store) {
+		if key != "" {
+			s.updatesKey = key
+		}
+		s.updatesMaxLen = maxLen
+	}
+}
+
+func NewStore(cli *redis.Client, tokensKey string, dedupleTTL time.Duration, opts ...Option) *Store {
+	s := &Store{
+		cli:           cli,
+		dedupleTTL:    int64(dedupleTTL.Seconds()),
+		tokensKey:     tokensKey,
+		readTimeout:   defaultReadTimeout,
+		writeTimeout:  defaultWriteTimeout,
+		loadTimeout:   defaultLoadTimeout,
+		script:        LuaScript,
+		eventCounter:  0,
+		lastEventKey:  "lastEventID",
+		confirmations: defaultConfirmations,
+		dedupeKey:     dedupe.ByEventID(),
+		updatesKey:    defaultUpdatesKey,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 // ApplyEvent processes a swap event atomically using a Lua script,
 // returns true if applied and not duplicated
-func (s *Store) ApplyEvent(ev model.SwapEvent) (bool, error) {
+func (s *Store) ApplyEvent(ctx context.Context, ev model.SwapEvent) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+
 	// Prepare keys and values for Lua script execution
-	dedupeKey := "dedupe:" + ev.EventID
-	seriesKey := "series:" + ev.TokenID
+	dedupeKey, err := s.dedupeKey.Key(ev)
+	if err != nil {
+		return false, err
+	}
+	seriesKey := seriesPrefix + ev.TokenID
 	tokenSet := s.tokensKey
+	blockStr := strconv.FormatUint(ev.BlockNumber, 10)
 	minute := strconv.FormatInt(ev.ExecutedAt.UTC().Unix()/60, 10)
 	usdStr := strconv.FormatFloat(ev.USD, 'f', -1, 64)
 	quantityStr := strconv.FormatFloat(ev.Amount, 'f', -1, 64)
 	ttlStr := strconv.FormatInt(s.dedupleTTL, 10)
+	maxLenStr := strconv.FormatInt(s.updatesMaxLen, 10)
+	var maybe bool
+	knownStr := "1"
+	if s.filter != nil {
+		var skip bool
+		if maybe, skip = s.filter.check(ctx, dedupeKey); skip {
+			knownStr = "0"
+		}
+	}
 
-	res, err := s.cli.Eval(s.ctx, s.script, []string{dedupeKey, seriesKey, tokenSet},
-		ev.EventID, minute, usdStr, quantityStr, ttlStr, ev.TokenID).Result()
+	res, err := s.cli.Eval(ctx, s.script, []string{dedupeKey, seriesKey, tokenSet, blockPrefix + blockStr, blocksKey, s.updatesKey},
+		ev.EventID, minute, usdStr, quantityStr, ttlStr, ev.TokenID,
+		blockStr, ev.BlockHash, knownStr, maxLenStr).Result()
 	if err != nil {
 		return false, err
 	}
@@ -70,10 +185,21 @@ func (s *Store) ApplyEvent(ev model.SwapEvent) (bool, error) {
 		return false, fmt.Errorf("unexpected result from redis: %v", res)
 	}
 
+	if applied && maybe {
+		s.filter.falsePositives.Add(1)
+	}
+
+	if applied && ev.BlockNumber > 0 {
+		if err := s.pruneBlocks(ctx, ev.BlockNumber); err != nil {
+			log.Printf("[warning] Failed to prune final blocks: %v", err)
+		}
+	}
+
 	if applied {
 		s.eventCounter++
+		s.lastApplied = ev.EventID
 		if s.eventCounter%100 == 0 {
-			if err := s.setLastEventID(ev.EventID); err != nil {
+			if err := s.Checkpoint(ctx); err != nil {
 				log.Printf("[warning] Failed to set lastEventID: %v", err)
 			}
 		}
@@ -82,12 +208,285 @@ func (s *Store) ApplyEvent(ev model.SwapEvent) (bool, error) {
 	return applied, nil
 }
 
-func (s *Store) setLastEventID(eventID string) error {
-	return s.cli.Set(s.ctx, s.lastEventKey, eventID, 0).Err()
+// pruneBlocks forgets a few blocks deeper than the confirmation depth below head, they are final
+func (s *Store) pruneBlocks(ctx context.Context, head uint64) error {
+	if head <= s.confirmations {
+		return nil
+	}
+	cutoff := strconv.FormatUint(head-s.confirmations, 10)
+	numbers, err := s.cli.ZRangeByScore(ctx, blocksKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff, Count: 16}).Result()
+	if err != nil || len(numbers) == 0 {
+		return err
+	}
+	keys := []string{blocksKey}
+	args := []interface{}{cutoff}
+	for _, n := range numbers {
+		keys = append(keys, blockPrefix+n)
+		args = append(args, n)
+	}
+	return s.cli.Eval(ctx, pruneBlocksScript, keys, args...).Err()
+}
+
+// retractAttempts bounds how often a block changing under RetractBlock is read again
+const retractAttempts = 3
+
+// RetractBlock atomically subtracts swaps of an orphaned block from series
+// and forgets their dedupe keys, empty hash retracts every swap with the block number.
+// Blocks deeper than the confirmation depth are already forgotten and retract nothing.
+func (s *Store) RetractBlock(ctx context.Context, number uint64, hash string) ([]model.BlockSwap, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	blockStr := strconv.FormatUint(number, 10)
+	blockKey := blockPrefix + blockStr
+
+	var res interface{}
+	for attempt := 1; ; attempt++ {
+		entries, err := s.cli.HGetAll(ctx, blockKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{blockKey, blocksKey, s.updatesKey}
+		series := make(map[string]bool)
+		for dedupeKey, raw := range entries {
+			swap, err := decodeBlockSwap(raw)
+			if err != nil {
+				return nil, err
+			}
+			if hash != "" && swap.BlockHash != hash {
+				continue
+			}
+			keys = append(keys, dedupeKey)
+			if !series[swap.Token] {
+				series[swap.Token] = true
+				keys = append(keys, seriesPrefix+swap.Token)
+			}
+		}
+
+		res, err = s.cli.Eval(ctx, retractScript, keys,
+			blockStr, hash, seriesPrefix, strconv.FormatInt(s.updatesMaxLen, 10)).Result()
+		if err == nil {
+			break
+		}
+		// nil reply: a swap was added to the block after it was read
+		if !errors.Is(err, redis.Nil) || attempt == retractAttempts {
+			return nil, fmt.Errorf("retract block %d: %w", number, err)
+		}
+	}
+
+	rows, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected result from redis: %v", res)
+	}
+	out := make([]model.BlockSwap, 0, len(rows))
+	for _, row := range rows {
+		raw, ok := row.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected retracted swap: %v", row)
+		}
+		swap, err := decodeBlockSwap(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, swap)
+	}
+	return out, nil
+}
+
+// ConfirmBlocks records that blocks up to number were confirmed explicitly,
+// reader replicas promote their swaps when they replay the update
+func (s *Store) ConfirmBlocks(ctx context.Context, number uint64) error {
+	if s.updatesMaxLen <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	return s.cli.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.updatesKey,
+		MaxLen: s.updatesMaxLen,
+		Approx: true,
+		Values: []interface{}{"kind", string(model.UpdateConfirm), "block", strconv.FormatUint(number, 10), "hash", ""},
+	}).Err()
+}
+
+// LoadPendingBlocks returns swaps of blocks which can still be retracted
+func (s *Store) LoadPendingBlocks(ctx context.Context) (map[uint64][]model.BlockSwap, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
+	numbers, err := s.cli.ZRange(ctx, blocksKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64][]model.BlockSwap, len(numbers))
+	for _, n := range numbers {
+		number, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad block number %q: %w", n, err)
+		}
+		entries, err := s.cli.HVals(ctx, blockPrefix+n).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range entries {
+			swap, err := decodeBlockSwap(raw)
+			if err != nil {
+				return nil, err
+			}
+			out[number] = append(out[number], swap)
+		}
+	}
+	return out, nil
+}
+
+// decodeBlockSwap parses block entry written by applyEvent.lua: [token, minute, usd, qty, blockHash]
+func decodeBlockSwap(raw string) (model.BlockSwap, error) {
+	var fields []string
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil || len(fields) != 5 {
+		return model.BlockSwap{}, fmt.Errorf("unexpected block entry: %s", raw)
+	}
+	swap := model.BlockSwap{Token: fields[0], BlockHash: fields[4]}
+	var err error
+	if swap.Minute, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return model.BlockSwap{}, err
+	}
+	if swap.USD, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return model.BlockSwap{}, err
+	}
+	if swap.Quantity, err = strconv.ParseFloat(fields[3], 64); err != nil {
+		return model.BlockSwap{}, err
+	}
+	return swap, nil
+}
+
+// Compact deletes buckets of minutes before cutoff from every series, it is a leader job
+// and fence of the leader term protects against a stale leader running concurrently
+func (s *Store) Compact(ctx context.Context, cutoff int64, fence uint64) (int, error) {
+	tokens, err := s.Tokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, token := range tokens {
+		n, err := s.compactSeries(ctx, token, cutoff, fence)
+		if err != nil {
+			return removed, err
+		}
+		if n < 0 {
+			return removed, ErrFenced
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (s *Store) compactSeries(ctx context.Context, token string, cutoff int64, fence uint64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	return s.cli.Eval(ctx, compactScript, []string{seriesPrefix + token, compactFenceKey}, cutoff, fence).Int()
+}
+
+// ReplaceRange atomically replaces buckets of a token in minutes [from, to) with the given ones,
+// minutes without a bucket become empty. dedupeKeys of the swaps summed into the buckets are set
+// with the dedupe TTL in the same transaction, so a redelivered swap is not counted on top.
+// Pending block entries of the token in the range are dropped: their swaps are in the new totals
+// and can't be retracted from them any more.
+func (s *Store) ReplaceRange(ctx context.Context, token string, from, to int64, buckets []model.MinuteBucket, dedupeKeys []string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	raw, err := encodeBuckets(buckets)
+	if err != nil {
+		return err
+	}
+	if s.filter != nil {
+		// a filter missing the keys would skip the exact check of a redelivered swap
+		if err := s.filter.add(ctx, dedupeKeys); err != nil {
+			return fmt.Errorf("add dedupe keys to filter: %w", err)
+		}
+	}
+	numbers, err := s.cli.ZRange(ctx, blocksKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{seriesPrefix + token, s.tokensKey, s.updatesKey, blocksKey}
+	for _, n := range numbers {
+		keys = append(keys, blockPrefix+n)
+	}
+
+	ttl := time.Duration(s.dedupleTTL) * time.Second
+	_, err = s.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Eval(ctx, replaceRangeScript, keys, token, from, to, raw, s.updatesMaxLen, blockPrefix)
+		for _, k := range dedupeKeys {
+			p.Set(ctx, k, 1, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// encodeBuckets builds [minute, count, usd, qty] rows of replaceRange.lua, decodeBuckets parses them back
+func encodeBuckets(buckets []model.MinuteBucket) (string, error) {
+	rows := make([][4]string, 0, len(buckets))
+	for _, b := range buckets {
+		if b.Count == 0 {
+			continue
+		}
+		rows = append(rows, [4]string{
+			strconv.FormatInt(b.Minute, 10),
+			strconv.FormatUint(b.Count, 10),
+			strconv.FormatFloat(b.USD, 'f', -1, 64),
+			strconv.FormatFloat(b.Quantity, 'f', -1, 64),
+		})
+	}
+	raw, err := json.Marshal(rows)
+	return string(raw), err
 }
 
-func (s *Store) GetLastEventID() (string, error) {
-	result, err := s.cli.Get(s.ctx, s.lastEventKey).Result()
+func decodeBuckets(raw string) ([]model.MinuteBucket, error) {
+	var rows [][4]string
+	if err := json.Unmarshal([]byte(raw), &rows); err != nil {
+		return nil, err
+	}
+	out := make([]model.MinuteBucket, len(rows))
+	for i, row := range rows {
+		var err error
+		b := &out[i]
+		if b.Minute, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+			return nil, err
+		}
+		if b.Count, err = strconv.ParseUint(row[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if b.USD, err = strconv.ParseFloat(row[2], 64); err != nil {
+			return nil, err
+		}
+		if b.Quantity, err = strconv.ParseFloat(row[3], 64); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Checkpoint saves id of the last applied event, callers serialize it with ApplyEvent
+func (s *Store) Checkpoint(ctx context.Context) error {
+	if s.lastApplied == "" {
+		return nil
+	}
+	if err := s.setLastEventID(ctx, s.lastApplied); err != nil {
+		return err
+	}
+	s.lastApplied = ""
+	return nil
+}
+
+func (s *Store) setLastEventID(ctx context.Context, eventID string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+	defer cancel()
+	return s.cli.Set(ctx, s.lastEventKey, eventID, 0).Err()
+}
+
+func (s *Store) GetLastEventID(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.readTimeout)
+	defer cancel()
+	result, err := s.cli.Get(ctx, s.lastEventKey).Result()
 	if err == redis.Nil {
 		return "", nil
 	}
@@ -104,17 +503,37 @@ func (s *Store) SetEventCounter(counter int64) {
 	s.eventCounter = counter
 }
 
-func (s *Store) LoadAllSeries() (map[string]map[string]string, error) {
+// Tokens returns every token with a series
+func (s *Store) Tokens(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.readTimeout)
+	defer cancel()
+	return s.cli.SMembers(ctx, s.tokensKey).Result()
+}
+
+// LoadSeries returns raw series fields of a single token
+func (s *Store) LoadSeries(ctx context.Context, token string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.readTimeout)
+	defer cancel()
+	return s.cli.HGetAll(ctx, seriesPrefix+token).Result()
+}
+
+// LoadAllSeries returns raw fields of every series, it stops when ctx is done
+func (s *Store) LoadAllSeries(ctx context.Context) (map[string]map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.loadTimeout)
+	defer cancel()
 	out := make(map[string]map[string]string)
 
 	//read all tokens
-	tokens, err := s.cli.SMembers(s.ctx, s.tokensKey).Result()
+	tokens, err := s.cli.SMembers(ctx, s.tokensKey).Result()
 	if err != nil {
 		return nil, err
 	}
 	for _, token := range tokens {
-		key := "series:" + token
-		fields, err := s.cli.HGetAll(s.ctx, key).Result()
+		key := seriesPrefix + token
+		fields, err := s.cli.HGetAll(ctx, key).Result()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if err != nil {
 			log.Printf("Failed to get key %s: %v", key, err)
 			//or we can return with error and stop processing
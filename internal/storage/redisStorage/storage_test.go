@@ -0,0 +1,390 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/bloom"
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStore(t *testing.T, opts ...Option) (*Store, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	return NewStore(cli, "token_set", time.Hour, opts...), cli
+}
+
+func TestRetractBlock(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	at := time.Unix(1700000040, 0)
+	minute := "28333334"
+
+	events := []model.SwapEvent{
+		{EventID: "ev-1", TokenID: "BTC", Amount: 1.5, USD: 150.25, ExecutedAt: at, BlockNumber: 7, BlockHash: "0xa"},
+		{EventID: "ev-2", TokenID: "BTC", Amount: 2, USD: 200, ExecutedAt: at, BlockNumber: 7, BlockHash: "0xb"},
+		{EventID: "ev-3", TokenID: "BTC", Amount: 4, USD: 400, ExecutedAt: at}, // not tracked
+	}
+	for _, ev := range events {
+		if applied, err := store.ApplyEvent(ctx, ev); err != nil || !applied {
+			t.Fatalf("ApplyEvent(%s): %v, %v", ev.EventID, applied, err)
+		}
+	}
+
+	pending, err := store.LoadPendingBlocks(ctx)
+	if err != nil {
+		t.Fatalf("LoadPendingBlocks: %v", err)
+	}
+	if len(pending) != 1 || len(pending[7]) != 2 {
+		t.Fatalf("Expected 2 pending swaps of block 7, got %+v", pending)
+	}
+
+	swaps, err := store.RetractBlock(ctx, 7, "0xa")
+	if err != nil {
+		t.Fatalf("RetractBlock: %v", err)
+	}
+	if len(swaps) != 1 {
+		t.Fatalf("Expected 1 retracted swap, got %d", len(swaps))
+	}
+	want := model.BlockSwap{Token: "BTC", Minute: 28333334, USD: 150.25, Quantity: 1.5, BlockHash: "0xa"}
+	if swaps[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, swaps[0])
+	}
+
+	fields := cli.HGetAll(ctx, "series:BTC").Val()
+	if fields[minute+"#c"] != "2" {
+		t.Errorf("Expected count 2, got %s", fields[minute+"#c"])
+	}
+	if fields[minute+"#u"] != "600" {
+		t.Errorf("Expected usd 600, got %s", fields[minute+"#u"])
+	}
+	if cli.Exists(ctx, "dedupe:ev-1").Val() != 0 {
+		t.Error("Expected dedupe key of retracted event removed")
+	}
+	if cli.Exists(ctx, "dedupe:ev-2").Val() != 1 {
+		t.Error("Expected dedupe key of other hash kept")
+	}
+
+	// whole block, then nothing is left to retract
+	if swaps, _ := store.RetractBlock(ctx, 7, ""); len(swaps) != 1 {
+		t.Errorf("Expected 1 retracted swap, got %d", len(swaps))
+	}
+	if swaps, _ := store.RetractBlock(ctx, 7, ""); len(swaps) != 0 {
+		t.Errorf("Expected nothing retracted, got %d", len(swaps))
+	}
+	if cli.ZCard(ctx, "blocks").Val() != 0 {
+		t.Error("Expected empty block removed from blocks set")
+	}
+}
+
+func TestRetractScriptNeedsDeclaredKeys(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 10, ExecutedAt: time.Unix(1700000040, 0),
+		BlockNumber: 7, BlockHash: "0xa"}
+	if _, err := store.ApplyEvent(ctx, ev); err != nil {
+		t.Fatalf("ApplyEvent: %v", err)
+	}
+
+	// as if the swap was added after the caller read the block
+	err := cli.Eval(ctx, retractScript, []string{"block:7", "blocks", "updates", "dedupe:ev-1"},
+		"7", "", seriesPrefix, "0").Err()
+	if !errors.Is(err, redis.Nil) {
+		t.Fatalf("Expected nil reply for an undeclared series key, got %v", err)
+	}
+	if got := cli.HGet(ctx, "series:BTC", "28333334#c").Val(); got != "1" {
+		t.Errorf("Expected series untouched, got count %q", got)
+	}
+	if cli.Exists(ctx, "dedupe:ev-1").Val() != 1 {
+		t.Error("Expected dedupe key kept")
+	}
+}
+
+func TestConfirmedBlocksAreForgotten(t *testing.T) {
+	store, cli := newTestStore(t, WithConfirmations(2))
+	ctx := context.Background()
+
+	for i, block := range []uint64{1, 2, 3, 4} {
+		ev := model.SwapEvent{EventID: "ev-" + string(rune('a'+i)), TokenID: "ETH", Amount: 1, USD: 1,
+			ExecutedAt: time.Now(), BlockNumber: block, BlockHash: "0x"}
+		if _, err := store.ApplyEvent(ctx, ev); err != nil {
+			t.Fatalf("ApplyEvent: %v", err)
+		}
+	}
+
+	blocks := cli.ZRange(ctx, "blocks", 0, -1).Val()
+	if len(blocks) != 3 || blocks[0] != "2" {
+		t.Errorf("Expected blocks 2..4 tracked, got %v", blocks)
+	}
+	if cli.Exists(ctx, "block:1").Val() != 0 {
+		t.Error("Expected block:1 removed")
+	}
+	if swaps, _ := store.RetractBlock(ctx, 1, ""); len(swaps) != 0 {
+		t.Errorf("Expected final block not retracted, got %d", len(swaps))
+	}
+}
+
+func TestApplyEventDedupeKey(t *testing.T) {
+	keyer, err := dedupe.New(dedupe.StrategyTx)
+	if err != nil {
+		t.Fatalf("dedupe.New: %v", err)
+	}
+	store, cli := newTestStore(t, WithDedupeKey(keyer))
+	ctx := context.Background()
+
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "ETH", Amount: 1, USD: 1, ExecutedAt: time.Now(),
+		Chain: "ethereum", TxHash: "0xabc", LogIndex: 2}
+	if applied, err := store.ApplyEvent(ctx, ev); err != nil || !applied {
+		t.Fatalf("Expected applied, got %v, %v", applied, err)
+	}
+	// producer retry with a regenerated id
+	ev.EventID = "ev-retry"
+	if applied, err := store.ApplyEvent(ctx, ev); err != nil || applied {
+		t.Errorf("Expected duplicate, got %v, %v", applied, err)
+	}
+	key, _ := keyer.Key(ev)
+	if cli.Exists(ctx, key).Val() != 1 {
+		t.Errorf("Expected dedupe key %s", key)
+	}
+
+	ev.TxHash = ""
+	if _, err := store.ApplyEvent(ctx, ev); err == nil {
+		t.Error("Expected error for event without tx hash")
+	}
+}
+
+// fakeFilter answers as told and records keys
+type fakeFilter struct {
+	seen     bool
+	complete bool
+	keys     []string
+}
+
+func (f *fakeFilter) TestAndAdd(_ context.Context, key string) (bool, error) {
+	f.keys = append(f.keys, key)
+	return f.seen, nil
+}
+
+func (f *fakeFilter) Complete(context.Context) (bool, error) { return f.complete, nil }
+func (f *fakeFilter) Stats() bloom.Stats                     { return bloom.Stats{Backend: "fake"} }
+
+func TestApplyEventDedupeFilter(t *testing.T) {
+	filter := &fakeFilter{}
+	store, cli := newTestStore(t, WithDedupeFilter(filter))
+	ctx := context.Background()
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "ETH", Amount: 1, USD: 1, ExecutedAt: time.Now()}
+
+	// filter is not complete yet, new for it still means the exact check
+	if applied, _ := store.ApplyEvent(ctx, ev); !applied {
+		t.Fatal("Expected applied")
+	}
+	if applied, _ := store.ApplyEvent(ctx, ev); applied {
+		t.Error("Expected duplicate caught by the exact check while warming")
+	}
+
+	// complete filter: "new" skips the exact check, the dedupe key is still written
+	filter.complete = true
+	store.filter.checkedAt.Store(0)
+	ev.EventID = "ev-2"
+	if applied, _ := store.ApplyEvent(ctx, ev); !applied {
+		t.Fatal("Expected applied")
+	}
+	if cli.Exists(ctx, "dedupe:ev-2").Val() != 1 {
+		t.Error("Expected dedupe key written")
+	}
+
+	// "maybe" falls through to the exact check
+	filter.seen = true
+	if applied, _ := store.ApplyEvent(ctx, ev); applied {
+		t.Error("Expected duplicate")
+	}
+	ev.EventID = "ev-3"
+	if applied, _ := store.ApplyEvent(ctx, ev); !applied {
+		t.Error("Expected false positive applied")
+	}
+
+	st := store.DedupeFilterStats()
+	if st.Warming != 2 || st.Skipped != 1 || st.Maybe != 2 || st.FalsePositives != 1 {
+		t.Errorf("Unexpected filter stats %+v", st)
+	}
+	if st.ObservedFPRate != 0.5 {
+		t.Errorf("Expected observed rate 0.5, got %v", st.ObservedFPRate)
+	}
+	if len(filter.keys) != 5 || filter.keys[0] != "dedupe:ev-1" {
+		t.Errorf("Expected every dedupe key tested, got %v", filter.keys)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	for i, at := range []time.Time{time.Unix(60*100, 0), time.Unix(60*200, 0)} {
+		ev := model.SwapEvent{EventID: "ev-" + string(rune('a'+i)), TokenID: "BTC", Amount: 1, USD: 10, ExecutedAt: at}
+		if _, err := store.ApplyEvent(ctx, ev); err != nil {
+			t.Fatalf("ApplyEvent: %v", err)
+		}
+	}
+
+	removed, err := store.Compact(ctx, 150, 2)
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 fields of minute 100 removed, got %d", removed)
+	}
+	fields := cli.HKeys(ctx, "series:BTC").Val()
+	if len(fields) != 3 || fields[0][:3] != "200" {
+		t.Errorf("Expected only minute 200 kept, got %v", fields)
+	}
+
+	// a previous leader must not compact after the new one
+	if _, err := store.Compact(ctx, 250, 1); !errors.Is(err, ErrFenced) {
+		t.Errorf("Expected ErrFenced for stale fence, got %v", err)
+	}
+	if n := cli.HLen(ctx, "series:BTC").Val(); n != 3 {
+		t.Errorf("Expected stale leader to remove nothing, got %d fields", n)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	if err := store.Checkpoint(ctx); err != nil {
+		t.Fatalf("Checkpoint without events: %v", err)
+	}
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 10, ExecutedAt: time.Now()}
+	if _, err := store.ApplyEvent(ctx, ev); err != nil {
+		t.Fatalf("ApplyEvent: %v", err)
+	}
+	if id, _ := store.GetLastEventID(ctx); id != "" {
+		t.Fatalf("Expected no checkpoint before 100 events, got %q", id)
+	}
+	if err := store.Checkpoint(ctx); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if id, _ := store.GetLastEventID(ctx); id != "ev-1" {
+		t.Errorf("Expected checkpoint ev-1, got %q", id)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	store, _ := newTestStore(t, WithTimeouts(time.Second, time.Second, time.Second))
+	ev := model.SwapEvent{EventID: "ev-1", TokenID: "BTC", Amount: 1, USD: 10, ExecutedAt: time.Now()}
+	if _, err := store.ApplyEvent(context.Background(), ev); err != nil {
+		t.Fatalf("ApplyEvent: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.ApplyEvent(ctx, ev); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from ApplyEvent, got %v", err)
+	}
+	if _, err := store.LoadAllSeries(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from LoadAllSeries, got %v", err)
+	}
+	if all, err := store.LoadAllSeries(context.Background()); err != nil || len(all) != 1 {
+		t.Errorf("Expected 1 series, got %d, %v", len(all), err)
+	}
+}
+
+func TestReplaceRange(t *testing.T) {
+	store, cli := newTestStore(t, WithUpdateStream("updates", 100))
+	ctx := context.Background()
+	cli.HSet(ctx, "series:BTC", "99#c", 1, "99#u", 5, "99#q", 1, // before the range
+		"100#c", 3, "100#u", 30, "100#q", 3, // replaced
+		"101#c", 1, "101#u", 1, "101#q", 1, // dropped, no swaps in history
+		"105#c", 7, "105#u", 7, "105#q", 7) // after the range
+
+	buckets := []model.MinuteBucket{
+		{Minute: 100, Bucket: model.Bucket{Count: 2, USD: 20.5, Quantity: 2}},
+		{Minute: 103, Bucket: model.Bucket{Count: 1, USD: 4, Quantity: 0.25}},
+	}
+	if err := store.ReplaceRange(ctx, "BTC", 100, 105, buckets, nil); err != nil {
+		t.Fatalf("ReplaceRange: %v", err)
+	}
+
+	expected := map[string]string{
+		"99#c": "1", "99#u": "5", "99#q": "1",
+		"100#c": "2", "100#u": "20.5", "100#q": "2",
+		"103#c": "1", "103#u": "4", "103#q": "0.25",
+		"105#c": "7", "105#u": "7", "105#q": "7",
+	}
+	fields := cli.HGetAll(ctx, "series:BTC").Val()
+	if len(fields) != len(expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("Expected %s = %s, got %q", k, v, fields[k])
+		}
+	}
+	if keys := cli.Keys(ctx, "dedupe:*").Val(); len(keys) != 0 {
+		t.Errorf("Expected no dedupe keys, got %v", keys)
+	}
+	if !cli.SIsMember(ctx, "token_set", "BTC").Val() {
+		t.Errorf("Expected BTC in the token set")
+	}
+
+	updates, err := store.ReadUpdates(ctx, "0-0", 10, 0)
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("Expected 1 update, got %+v, %v", updates, err)
+	}
+	u := updates[0]
+	if u.Kind != model.UpdateBackfill || u.Token != "BTC" || u.FromMinute != 100 || u.ToMinute != 105 ||
+		len(u.Buckets) != 2 || u.Buckets[1] != buckets[1] {
+		t.Errorf("Expected backfill update of BTC, got %+v", u)
+	}
+}
+
+func TestReplaceRangeMarksSwapsSeen(t *testing.T) {
+	store, cli := newTestStore(t)
+	ctx := context.Background()
+	at := time.Unix(100*60+5, 0) // minute 100
+	live := model.SwapEvent{EventID: "live", TokenID: "BTC", Amount: 1, USD: 10, ExecutedAt: at, BlockNumber: 7, BlockHash: "0xa"}
+	other := model.SwapEvent{EventID: "other", TokenID: "ETH", Amount: 1, USD: 3, ExecutedAt: at, BlockNumber: 7, BlockHash: "0xa"}
+	for _, ev := range []model.SwapEvent{live, other} {
+		if _, err := store.ApplyEvent(ctx, ev); err != nil {
+			t.Fatalf("ApplyEvent: %v", err)
+		}
+	}
+
+	// the history has the live swap and one the hash lost
+	buckets := []model.MinuteBucket{{Minute: 100, Bucket: model.Bucket{Count: 2, USD: 15, Quantity: 2}}}
+	if err := store.ReplaceRange(ctx, "BTC", 100, 101, buckets, []string{"dedupe:live", "dedupe:lost"}); err != nil {
+		t.Fatalf("ReplaceRange: %v", err)
+	}
+
+	// both are delivered again, neither is counted on top
+	for _, id := range []string{"live", "lost"} {
+		applied, err := store.ApplyEvent(ctx, model.SwapEvent{EventID: id, TokenID: "BTC", Amount: 1, USD: 5, ExecutedAt: at})
+		if err != nil || applied {
+			t.Errorf("Expected backfilled %s deduplicated, got %v, %v", id, applied, err)
+		}
+	}
+	if got := cli.HGet(ctx, "series:BTC", "100#c").Val(); got != "2" {
+		t.Errorf("Expected count 2 after redelivery, got %s", got)
+	}
+	if ttl := cli.TTL(ctx, "dedupe:lost").Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected dedupe TTL of an hour, got %v", ttl)
+	}
+
+	// the swap of block 7 is in the totals now, only the swap of the other token is retracted
+	swaps, err := store.RetractBlock(ctx, 7, "")
+	if err != nil {
+		t.Fatalf("RetractBlock: %v", err)
+	}
+	if len(swaps) != 1 || swaps[0].Token != "ETH" {
+		t.Errorf("Expected only ETH swap retracted, got %+v", swaps)
+	}
+	if got := cli.HGet(ctx, "series:BTC", "100#c").Val(); got != "2" {
+		t.Errorf("Expected count 2 after retraction, got %s", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Package validation checks swap events before they reach storage
+package validation
+
+import (
+	"fmt"
+	"math"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+type Reason string
+
+const (
+	ReasonEmptyEventID    Reason = "empty_event_id"
+	ReasonEmptyToken      Reason = "empty_token"
+	ReasonTokenNotAllowed Reason = "token_not_allowed"
+	ReasonBadAmount       Reason = "bad_amount"
+	ReasonBadUSD          Reason = "bad_usd"
+	ReasonUSDTooLarge     Reason = "usd_too_large"
+	ReasonBadRate         Reason = "bad_rate"
+	ReasonRateMismatch    Reason = "rate_mismatch"
+	ReasonUnknownSide     Reason = "unknown_side"
+	ReasonNoExecutedAt    Reason = "no_executed_at"
+	ReasonNoBlockHash     Reason = "no_block_hash"
+	ReasonNoDedupeKey     Reason = "no_dedupe_key"
+)
+
+// Error describes why an event was rejected
+type Error struct {
+	Reason Reason
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return "invalid event: " + string(e.Reason)
+	}
+	return "invalid event: " + string(e.Reason) + ": " + e.Detail
+}
+
+func reject(reason Reason, format string, args ...any) *Error {
+	return &Error{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Rules are optional checks on top of the always enforced structural ones,
+// zero value disables a rule
+type Rules struct {
+	MaxUSD        float64  // sanity bound for a single swap
+	RateTolerance float64  // allowed relative difference between Rate and USD/Amount
+	AllowedTokens []string // empty list allows every token
+	// events must have every field the dedupe key is built from, nil checks only event id
+	DedupeKey *dedupe.Keyer
+}
+
+type Validator struct {
+	rules   Rules
+	allowed map[string]struct{}
+}
+
+func New(rules Rules) *Validator {
+	v := &Validator{rules: rules}
+	if len(rules.AllowedTokens) > 0 {
+		v.allowed = make(map[string]struct{}, len(rules.AllowedTokens))
+		for _, token := range rules.AllowedTokens {
+			v.allowed[token] = struct{}{}
+		}
+	}
+	return v
+}
+
+// Validate returns *Error if ev must not be applied
+func (v *Validator) Validate(ev model.SwapEvent) error {
+	if ev.EventID == "" {
+		// every later empty id would be a "duplicate"
+		return reject(ReasonEmptyEventID, "")
+	}
+	if ev.TokenID == "" {
+		return reject(ReasonEmptyToken, "")
+	}
+	if v.allowed != nil {
+		if _, ok := v.allowed[ev.TokenID]; !ok {
+			return reject(ReasonTokenNotAllowed, "%s", ev.TokenID)
+		}
+	}
+	if ev.Side != model.Buy && ev.Side != model.Sell {
+		return reject(ReasonUnknownSide, "%q", ev.Side)
+	}
+	if ev.ExecutedAt.IsZero() {
+		return reject(ReasonNoExecutedAt, "")
+	}
+	if v.rules.DedupeKey != nil {
+		if _, err := v.rules.DedupeKey.Key(ev); err != nil {
+			return reject(ReasonNoDedupeKey, "%v", err)
+		}
+	}
+	if ev.BlockNumber > 0 && ev.BlockHash == "" {
+		// a swap of a known block without hash can't be told apart from its orphaned twin
+		return reject(ReasonNoBlockHash, "block %d", ev.BlockNumber)
+	}
+	if !validNumber(ev.Amount) {
+		return reject(ReasonBadAmount, "%v", ev.Amount)
+	}
+	if !validNumber(ev.USD) {
+		return reject(ReasonBadUSD, "%v", ev.USD)
+	}
+	if !validNumber(ev.Rate) {
+		return reject(ReasonBadRate, "%v", ev.Rate)
+	}
+	if v.rules.MaxUSD > 0 && ev.USD > v.rules.MaxUSD {
+		return reject(ReasonUSDTooLarge, "%v > %v", ev.USD, v.rules.MaxUSD)
+	}
+	if v.rules.RateTolerance > 0 && ev.Amount > 0 && ev.Rate > 0 {
+		implied := ev.USD / ev.Amount
+		if math.Abs(implied-ev.Rate)/ev.Rate > v.rules.RateTolerance {
+			return reject(ReasonRateMismatch, "rate %v, usd/amount %v", ev.Rate, implied)
+		}
+	}
+	return nil
+}
+
+// validNumber rejects NaN, infinities and negative values
+func validNumber(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0) && f >= 0
+}
@@ -0,0 +1,86 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/dedupe"
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+func validEvent() model.SwapEvent {
+	return model.SwapEvent{
+		EventID:    "ev-1",
+		TokenID:    "BTC",
+		Amount:     2.0,
+		USD:        100000.0,
+		Side:       model.Buy,
+		Rate:       50000.0,
+		ExecutedAt: time.Now(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	txKeyer, err := dedupe.New(dedupe.StrategyTx)
+	if err != nil {
+		t.Fatalf("dedupe.New: %v", err)
+	}
+	strict := Rules{
+		MaxUSD:        1_000_000,
+		RateTolerance: 0.01,
+		AllowedTokens: []string{"BTC", "ETH"},
+	}
+
+	tests := []struct {
+		name   string
+		rules  Rules
+		mutate func(ev *model.SwapEvent)
+		want   Reason
+	}{
+		{"valid", strict, func(ev *model.SwapEvent) {}, ""},
+		{"empty event id", Rules{}, func(ev *model.SwapEvent) { ev.EventID = "" }, ReasonEmptyEventID},
+		{"empty token", Rules{}, func(ev *model.SwapEvent) { ev.TokenID = "" }, ReasonEmptyToken},
+		{"unknown side", Rules{}, func(ev *model.SwapEvent) { ev.Side = "hold" }, ReasonUnknownSide},
+		{"zero executed at", Rules{}, func(ev *model.SwapEvent) { ev.ExecutedAt = time.Time{} }, ReasonNoExecutedAt},
+		{"no dedupe key field", Rules{DedupeKey: txKeyer}, func(ev *model.SwapEvent) {}, ReasonNoDedupeKey},
+		{"dedupe key fields", Rules{DedupeKey: txKeyer}, func(ev *model.SwapEvent) { ev.TxHash = "0xabc" }, ""},
+		{"block without hash", Rules{}, func(ev *model.SwapEvent) { ev.BlockNumber = 7 }, ReasonNoBlockHash},
+		{"block with hash", Rules{}, func(ev *model.SwapEvent) { ev.BlockNumber, ev.BlockHash = 7, "0xa" }, ""},
+		{"negative amount", Rules{}, func(ev *model.SwapEvent) { ev.Amount = -1 }, ReasonBadAmount},
+		{"NaN amount", Rules{}, func(ev *model.SwapEvent) { ev.Amount = math.NaN() }, ReasonBadAmount},
+		{"negative usd", Rules{}, func(ev *model.SwapEvent) { ev.USD = -1 }, ReasonBadUSD},
+		{"infinite usd", Rules{}, func(ev *model.SwapEvent) { ev.USD = math.Inf(1) }, ReasonBadUSD},
+		{"NaN rate", Rules{}, func(ev *model.SwapEvent) { ev.Rate = math.NaN() }, ReasonBadRate},
+		{"token not allowed", strict, func(ev *model.SwapEvent) { ev.TokenID = "DOGE" }, ReasonTokenNotAllowed},
+		{"usd too large", strict, func(ev *model.SwapEvent) {
+			ev.Amount, ev.USD = 40, 2_000_000
+		}, ReasonUSDTooLarge},
+		{"rate mismatch", strict, func(ev *model.SwapEvent) { ev.Rate = 40000 }, ReasonRateMismatch},
+		{"rate within tolerance", strict, func(ev *model.SwapEvent) { ev.Rate = 50200 }, ""},
+		{"rules disabled", Rules{}, func(ev *model.SwapEvent) { ev.TokenID, ev.Rate = "DOGE", 1 }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := validEvent()
+			tt.mutate(&ev)
+			err := New(tt.rules).Validate(ev)
+
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Expected valid event, got %v", err)
+				}
+				return
+			}
+			var verr *Error
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected *Error, got %v", err)
+			}
+			if verr.Reason != tt.want {
+				t.Errorf("Expected reason %s, got %s", tt.want, verr.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package webSocket
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// OverflowPolicy decides what happens with a message when client's queue is full
+type OverflowPolicy int
+
+const (
+	// PolicyCoalesce merges queued messages of the token view into a snapshot of the latest state,
+	// client is disconnected if the queue is full of other topics
+	PolicyCoalesce OverflowPolicy = iota
+	// PolicyDropOldest discards the oldest queued message to make room for a new one
+	PolicyDropOldest
+	// PolicyDisconnect closes the client as soon as its queue is full
+	PolicyDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case PolicyCoalesce:
+		return "coalesce"
+	case PolicyDropOldest:
+		return "drop"
+	case PolicyDisconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "coalesce":
+		return PolicyCoalesce, nil
+	case "drop":
+		return PolicyDropOldest, nil
+	case "disconnect":
+		return PolicyDisconnect, nil
+	}
+	return 0, fmt.Errorf("unknown overflow policy: %q", s)
+}
+
+// CloseReason tells why a client was closed
+type CloseReason int
+
+const (
+	CloseNone         CloseReason = iota // client is open
+	CloseUnsubscribed                    // transport is done with the client
+	CloseOverflow                        // client fell behind and its queue overflowed
+	ClosePeerGone                        // peer stopped answering or a write failed
+	CloseShutdown                        // hub is shutting down
+)
+
+// Client is a single subscriber with its own bounded queue.
+// For WebSocket only writePump writes to conn, so gorilla's single writer rule holds,
+// other transports drain the queue themselves with Wake and Take.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+
+	mu      sync.Mutex
+	queue   []update
+	dropped uint64
+	closed  bool
+	reason  CloseReason
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	leaving   chan struct{} // closed on shutdown, writePump drains the queue and says goodbye
+	leaveOnce sync.Once
+}
+
+func newClient(h *Hub, conn *websocket.Conn) *Client {
+	return &Client{
+		hub:     h,
+		conn:    conn,
+		queue:   make([]update, 0, h.opts.QueueSize),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		leaving: make(chan struct{}),
+	}
+}
+
+// send queues update for the client according to hub's overflow policy.
+// Returns false if the client overflowed and must be disconnected.
+func (c *Client) send(u update) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return true
+	}
+	if !c.enqueueLocked(u) {
+		c.mu.Unlock()
+		return false
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default: // writer is already notified
+	}
+	return true
+}
+
+func (c *Client) enqueueLocked(u update) bool {
+	if len(c.queue) < c.hub.opts.QueueSize {
+		c.queue = append(c.queue, u)
+		return true
+	}
+	switch c.hub.opts.Policy {
+	case PolicyCoalesce:
+		// queued updates of the token view are merged into a snapshot of the latest state,
+		// views of a token are numbered separately and never merged
+		topic := model.Topic(u.env.Token, u.env.View)
+		kept := c.queue[:0]
+		for _, q := range c.queue {
+			if model.Topic(q.env.Token, q.env.View) != topic {
+				kept = append(kept, q)
+			}
+		}
+		if len(kept) == len(c.queue) {
+			return false
+		}
+		c.dropped += uint64(len(c.queue) - len(kept))
+		c.queue = append(kept, snapshotUpdate(u.env.Epoch, u.env.Token, u.env.Seq, u.state))
+		return true
+	case PolicyDropOldest:
+		// client sees a gap in seq and may resume with since
+		copy(c.queue, c.queue[1:])
+		c.queue[len(c.queue)-1] = u
+		c.dropped++
+		return true
+	}
+	return false
+}
+
+// Dropped returns number of messages discarded or replaced by the overflow policy
+func (c *Client) Dropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Done is closed when the client is shut down, Reason tells why
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Reason returns why the client was closed, CloseNone while it is open
+func (c *Client) Reason() CloseReason {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+// Wake is signalled when new updates are queued
+func (c *Client) Wake() <-chan struct{} {
+	return c.wake
+}
+
+// Take returns queued updates in order and empties the queue
+func (c *Client) Take() []model.Envelope {
+	updates := c.take()
+	out := make([]model.Envelope, len(updates))
+	for i, u := range updates {
+		out[i] = u.env
+	}
+	return out
+}
+
+func (c *Client) take() []update {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return nil
+	}
+	out := c.queue
+	c.queue = make([]update, 0, c.hub.opts.QueueSize)
+	return out
+}
+
+// writePump is the only goroutine writing to conn: queued messages and keepalive pings
+func (c *Client) writePump() {
+	ping := c.hub.opts.Clock.NewTicker(c.hub.opts.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.leaving:
+			c.leave()
+			return
+		case <-ping.C():
+			deadline := time.Now().Add(c.hub.opts.WriteTimeout)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.hub.markDead(c)
+				return
+			}
+		case <-c.wake:
+			for _, u := range c.take() {
+				if err := c.write(u.env); err != nil {
+					c.hub.markDead(c)
+					return
+				}
+			}
+		}
+	}
+}
+
+// readPump discards incoming messages and detects dead peers,
+// any read including pong extends the deadline
+func (c *Client) readPump() {
+	defer c.hub.markDead(c)
+	pongWait := c.hub.opts.PongWait
+	c.conn.SetReadLimit(maxReadSize)
+	if err := c.conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+		return
+	}
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+		if err := c.conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) write(env model.Envelope) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.hub.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(env)
+}
+
+// goAway starts a graceful close on shutdown. WebSocket clients are closed by writePump
+// once queued updates and the close frame are written, stream clients are closed right away
+// and keep their queue, so the transport can send it before it ends.
+func (c *Client) goAway() {
+	if c.conn == nil {
+		c.close(CloseShutdown)
+		return
+	}
+	c.leaveOnce.Do(func() { close(c.leaving) })
+}
+
+// leave writes what is still queued, then the close frame, and closes the client
+func (c *Client) leave() {
+	for _, u := range c.take() {
+		if err := c.write(u.env); err != nil {
+			break
+		}
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.hub.opts.WriteTimeout))
+	c.close(CloseShutdown)
+}
+
+func (c *Client) close(reason CloseReason) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.reason = reason
+		if reason != CloseShutdown {
+			c.queue = nil
+		}
+		c.mu.Unlock()
+		close(c.done)
+		// unblocks a write stuck on a slow peer
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package webSocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// numbers the update and publishes it atomically, so seq order matches publish order
+// KEYS: seqKey ARGV: channel, stats json
+var publishScript = redis.NewScript(`
+local seq = redis.call("INCR", KEYS[1])
+redis.call("PUBLISH", ARGV[1], seq .. "|" .. ARGV[2])
+return seq
+`)
+
+const defaultPublishTimeout = 2 * time.Second
+
+// Fanout relays stats updates between instances through Redis Pub/Sub.
+// Engine broadcasts to Fanout instead of the local Hub, and every instance,
+// the publisher included, relays updates from Redis to its own Hub.
+// Seq is shared by all instances, so clients may resume on any of them.
+type Fanout struct {
+	cli     *redis.Client
+	hub     *Hub
+	prefix  string
+	timeout time.Duration // single publish, a stalled Redis delays every later flush
+}
+
+type FanoutOption func(*Fanout)
+
+// WithPublishTimeout bounds a single publish, 2s by default
+func WithPublishTimeout(d time.Duration) FanoutOption {
+	return func(f *Fanout) {
+		if d > 0 {
+			f.timeout = d
+		}
+	}
+}
+
+func NewFanout(cli *redis.Client, hub *Hub, prefix string, opts ...FanoutOption) *Fanout {
+	f := &Fanout{
+		cli:     cli,
+		hub:     hub,
+		prefix:  prefix,
+		timeout: defaultPublishTimeout,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// SharedEpoch returns the epoch of seq numbered in Redis under prefix, the first instance sets it.
+// Seq keys and the epoch go away together, so the numbering starting again gets a new epoch.
+func SharedEpoch(ctx context.Context, cli *redis.Client, prefix string) (string, error) {
+	key := prefix + "epoch"
+	if err := cli.SetNX(ctx, key, NewEpoch(), 0).Err(); err != nil {
+		return "", err
+	}
+	return cli.Get(ctx, key).Result()
+}
+
+func (f *Fanout) channel(token string) string { return f.prefix + token }
+func (f *Fanout) seqKey(topic string) string  { return f.prefix + "seq:" + topic }
+
+// Broadcast publishes st on the token channel, every view of the token is numbered separately.
+// The publish is bounded by the publish timeout and ctx.
+func (f *Fanout) Broadcast(ctx context.Context, token string, st model.Stats) {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		log.Println("[error] Failed to encode stats for fanout:", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	err = publishScript.Run(ctx, f.cli,
+		[]string{f.seqKey(model.Topic(token, st.View))}, f.channel(token), raw).Err()
+	if err != nil {
+		log.Println("[error] Failed to publish stats:", err)
+	}
+}
+
+// Run relays published updates to the local Hub until ctx is done
+func (f *Fanout) Run(ctx context.Context) error {
+	sub := f.cli.PSubscribe(ctx, f.prefix+"*")
+	defer func() { _ = sub.Close() }()
+
+	// wait for subscription confirmation so nothing published after Run is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			f.relay(msg)
+		}
+	}
+}
+
+func (f *Fanout) relay(msg *redis.Message) {
+	token := strings.TrimPrefix(msg.Channel, f.prefix)
+	seqStr, raw, ok := strings.Cut(msg.Payload, "|")
+	if !ok {
+		log.Println("[error] Malformed fanout message on", msg.Channel)
+		return
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		log.Println("[error] Malformed fanout seq on", msg.Channel, err)
+		return
+	}
+	var st model.Stats
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		log.Println("[error] Malformed fanout stats on", msg.Channel, err)
+		return
+	}
+	f.hub.Relay(token, seq, st)
+}
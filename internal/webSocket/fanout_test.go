@@ -0,0 +1,183 @@
+package webSocket
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"Dexcelerate_swap_stats/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// waitUpdates waits until client has n queued updates
+func waitUpdates(t *testing.T, c *Client, n int) []update {
+	t.Helper()
+	var got []update
+	deadline := time.Now().Add(2 * time.Second)
+	for len(got) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d updates, got %d", n, len(got))
+		}
+		got = append(got, c.take()...)
+		time.Sleep(5 * time.Millisecond)
+	}
+	return got
+}
+
+func TestFanoutRelaysToEveryInstance(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hubs := []*Hub{NewHub(), NewHub()}
+	fanouts := make([]*Fanout, len(hubs))
+	clients := make([]*Client, len(hubs))
+	for i, hub := range hubs {
+		cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = cli.Close() })
+		fanouts[i] = NewFanout(cli, hub, "stats:")
+		go func(f *Fanout) { _ = f.Run(ctx) }(fanouts[i])
+
+		clients[i] = newClient(hub, nil)
+		hub.Subscribe(clients[i], "BTC", "", 0, model.Stats{Token: "BTC"})
+		clients[i].take() // initial snapshot
+	}
+	// Run subscribes asynchronously
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumPat() < len(hubs) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for fanout subscriptions")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// only the first instance applied events for BTC
+	fanouts[0].Broadcast(ctx, "BTC", statsWithCount(1))
+	fanouts[0].Broadcast(ctx, "BTC", statsWithCount(2))
+
+	for i, c := range clients {
+		got := waitUpdates(t, c, 2)
+		if len(got) != 2 {
+			t.Fatalf("Hub %d: expected exactly 2 updates, got %d", i, len(got))
+		}
+		if got[0].env.Seq != 1 || got[1].env.Seq != 2 {
+			t.Errorf("Hub %d: expected seq 1,2, got %d,%d", i, got[0].env.Seq, got[1].env.Seq)
+		}
+		if got[1].state.BucketMinutes5.Count != 2 {
+			t.Errorf("Hub %d: expected latest state, got %+v", i, got[1].state)
+		}
+	}
+}
+
+func TestFanoutPublishTimeout(t *testing.T) {
+	// accepts connections and never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	cli := redis.NewClient(&redis.Options{Addr: ln.Addr().String(), ContextTimeoutEnabled: true, MaxRetries: -1})
+	t.Cleanup(func() { _ = cli.Close() })
+
+	f := NewFanout(cli, NewHub(), "stats:", WithPublishTimeout(50*time.Millisecond))
+	start := time.Now()
+	f.Broadcast(context.Background(), "BTC", statsWithCount(1))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected publish to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestFanoutBroadcastHonorsContext(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	f := NewFanout(cli, NewHub(), "stats:", WithPublishTimeout(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.Broadcast(ctx, "BTC", statsWithCount(1))
+	if mr.Exists("stats:seq:BTC") {
+		t.Errorf("Expected no publish with a cancelled context")
+	}
+
+	f.Broadcast(context.Background(), "BTC", statsWithCount(2))
+	if got, _ := mr.Get("stats:seq:BTC"); got != "1" {
+		t.Errorf("Expected seq 1 after a publish, got %q", got)
+	}
+}
+
+func TestHubRelayDropsDuplicates(t *testing.T) {
+	hub := NewHub()
+	c := newClient(hub, nil)
+	hub.Subscribe(c, "BTC", "", 0, model.Stats{Token: "BTC"})
+	c.take()
+
+	hub.Relay("BTC", 5, statsWithCount(5))
+	hub.Relay("BTC", 5, statsWithCount(5)) // duplicate
+	hub.Relay("BTC", 4, statsWithCount(4)) // stale
+	hub.Relay("BTC", 6, statsWithCount(6))
+	hub.Relay("BTC", 9, statsWithCount(9)) // gap
+
+	got := c.take()
+	want := []struct {
+		typ model.MessageType
+		seq uint64
+	}{
+		{model.MessageSnapshot, 5},
+		{model.MessageDelta, 6},
+		{model.MessageSnapshot, 9},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d updates, got %d", len(want), len(got))
+	}
+	for i, w := range want {
+		if got[i].env.Type != w.typ || got[i].env.Seq != w.seq {
+			t.Errorf("Expected %s #%d, got %s #%d", w.typ, w.seq, got[i].env.Type, got[i].env.Seq)
+		}
+	}
+}
+
+func TestSharedEpoch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+
+	first, err := SharedEpoch(ctx, cli, "stats:")
+	if err != nil {
+		t.Fatalf("SharedEpoch: %v", err)
+	}
+	second, err := SharedEpoch(ctx, cli, "stats:")
+	if err != nil {
+		t.Fatalf("SharedEpoch: %v", err)
+	}
+	if first == "" || first != second {
+		t.Errorf("Expected every instance to get the same epoch, got %q and %q", first, second)
+	}
+
+	// seq keys are gone with the data, numbering starts over in a new epoch
+	mr.FlushAll()
+	third, err := SharedEpoch(ctx, cli, "stats:")
+	if err != nil {
+		t.Fatalf("SharedEpoch: %v", err)
+	}
+	if third == first {
+		t.Errorf("Expected a new epoch after the data is gone, got %q again", third)
+	}
+}
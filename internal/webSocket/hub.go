@@ -1,53 +1,323 @@
 package webSocket
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
+	"Dexcelerate_swap_stats/internal/clock"
 	"Dexcelerate_swap_stats/internal/model"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	defaultQueueSize    = 64
+	defaultWriteTimeout = 5 * time.Second
+	defaultPingInterval = 30 * time.Second
+	defaultPongWait     = 60 * time.Second
+	maxReadSize         = 512
+)
+
 type Hub struct {
 	Upgrader websocket.Upgrader
 
 	Mu     sync.Mutex
-	Subs   map[string]map[*websocket.Conn]struct{}
-	DeadCh chan *websocket.Conn
+	Subs   map[string]map[*Client]struct{} // by model.Topic of token and view
+	DeadCh chan *Client
+
+	streams map[string]*stream
+	opts    Options
+	closed  bool // set by Shutdown, later subscribers are closed at once
+}
+
+// Options tune per-connection queues of the Hub
+type Options struct {
+	QueueSize    int            // max messages waiting for a single client
+	Policy       OverflowPolicy // what to do when the queue is full
+	WriteTimeout time.Duration  // deadline for a single write to the socket
+	PingInterval time.Duration  // how often the writer pings the peer
+	PongWait     time.Duration  // peer is dead if nothing is read for that long
+	ReplaySize   int            // updates kept per token for resume
+	Epoch        string         // numbering of seq, resume with another epoch gets a snapshot
+	Clock        clock.Clock    // drives keepalive tickers, socket deadlines always use wall time
+}
+
+type Option func(*Options)
+
+func WithQueueSize(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.QueueSize = n
+		}
+	}
+}
+
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(o *Options) { o.Policy = p }
+}
+
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		if d > 0 {
+			o.WriteTimeout = d
+		}
+	}
+}
+
+// WithClock replaces the system clock of keepalive tickers
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		if c != nil {
+			o.Clock = c
+		}
+	}
+}
+
+// WithReplaySize sets how many updates per token are kept for clients resuming with since
+func WithReplaySize(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.ReplaySize = n
+		}
+	}
 }
 
-func NewHub() *Hub {
+// WithEpoch sets the numbering of seq, instances sharing seq share the epoch too, see SharedEpoch
+func WithEpoch(epoch string) Option {
+	return func(o *Options) {
+		if epoch != "" {
+			o.Epoch = epoch
+		}
+	}
+}
+
+// NewEpoch names a fresh numbering of seq after the start time
+func NewEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// WithKeepalive sets ping interval and pong timeout,
+// interval is clamped below the timeout so a healthy peer always has time to answer
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *Options) {
+		if interval > 0 {
+			o.PingInterval = interval
+		}
+		if timeout > 0 {
+			o.PongWait = timeout
+		}
+	}
+}
+
+func NewHub(opts ...Option) *Hub {
+	o := Options{
+		QueueSize:    defaultQueueSize,
+		Policy:       PolicyCoalesce,
+		WriteTimeout: defaultWriteTimeout,
+		PingInterval: defaultPingInterval,
+		PongWait:     defaultPongWait,
+		ReplaySize:   defaultReplaySize,
+		Epoch:        NewEpoch(),
+		Clock:        clock.Real(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.PingInterval >= o.PongWait {
+		o.PingInterval = o.PongWait * 9 / 10
+	}
 	return &Hub{
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
 		},
-		Subs:   make(map[string]map[*websocket.Conn]struct{}),
-		DeadCh: make(chan *websocket.Conn, 1024),
+		Subs:    make(map[string]map[*Client]struct{}),
+		DeadCh:  make(chan *Client, 1024),
+		streams: make(map[string]*stream),
+		opts:    o,
 	}
 }
 
-func (h *Hub) Broadcast(token string, st model.Stats) {
+// NewClient wraps conn and starts its writer and reader goroutines.
+// Client gets nothing until it is subscribed.
+func (h *Hub) NewClient(conn *websocket.Conn) *Client {
+	c := newClient(h, conn)
+	go c.writePump()
+	go c.readPump()
+	return c
+}
+
+// NewStreamClient creates a client without a socket for transports like SSE,
+// the caller drains it with Wake and Take and must call Unsubscribe when done.
+func (h *Hub) NewStreamClient() *Client {
+	return newClient(h, nil)
+}
+
+// Options returns the effective hub options
+func (h *Hub) Options() Options {
+	return h.opts
+}
+
+// Subscribe adds client to subscribers of the token in the view of initial
+// and queues its starting point: updates after since if they are still buffered,
+// otherwise a snapshot. since == 0 or since of another epoch always means a snapshot,
+// initial is the snapshot for a token which has never been broadcast yet.
+func (h *Hub) Subscribe(c *Client, token, epoch string, since uint64, initial model.Stats) {
+	topic := model.Topic(token, initial.View)
+	if epoch != h.opts.Epoch {
+		since = 0 // numbered before a restart, the same seq may mean another state now
+	}
 	h.Mu.Lock()
-	set := h.Subs[token]
+	var ok bool
+	if h.closed {
+		h.Mu.Unlock()
+		c.goAway()
+		return
+	}
+	if st := h.streams[topic]; st == nil {
+		ok = c.send(snapshotUpdate(h.opts.Epoch, token, 0, initial))
+	} else {
+		ok = h.catchUpLocked(c, st, since)
+	}
+	if ok {
+		set := h.Subs[topic]
+		if set == nil {
+			set = make(map[*Client]struct{})
+			h.Subs[topic] = set
+		}
+		set[c] = struct{}{}
+	}
 	h.Mu.Unlock()
-	if len(set) == 0 {
+
+	if !ok {
+		h.drop(c, CloseOverflow)
+	}
+}
+
+func (h *Hub) catchUpLocked(c *Client, st *stream, since uint64) bool {
+	if since > 0 {
+		if updates, ok := st.replay(since, h.opts.QueueSize); ok {
+			for _, u := range updates {
+				if !c.send(u) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return c.send(st.snapshot())
+}
+
+// Broadcast numbers st and queues it for every subscriber of token in st.View,
+// it never blocks on network, so ctx is unused. Clients whose queue overflows are disconnected.
+func (h *Hub) Broadcast(_ context.Context, token string, st model.Stats) {
+	topic := model.Topic(token, st.View)
+	h.Mu.Lock()
+	s := h.streamLocked(topic, token)
+	h.deliverLocked(topic, s.next(st))
+}
+
+// Relay queues an update numbered by another instance,
+// updates with seq not newer than the last one are dropped as duplicates.
+func (h *Hub) Relay(token string, seq uint64, st model.Stats) {
+	topic := model.Topic(token, st.View)
+	h.Mu.Lock()
+	u, ok := h.streamLocked(topic, token).push(seq, st)
+	if !ok {
+		h.Mu.Unlock()
 		return
 	}
-	for c := range set {
-		_ = c.WriteJSON(st)
+	h.deliverLocked(topic, u)
+}
+
+func (h *Hub) streamLocked(topic, token string) *stream {
+	s := h.streams[topic]
+	if s == nil {
+		s = newStream(h.opts.Epoch, token, h.opts.ReplaySize)
+		h.streams[topic] = s
 	}
+	return s
+}
+
+// deliverLocked queues u for topic subscribers and releases h.Mu
+func (h *Hub) deliverLocked(topic string, u update) {
+	// queued under lock, so every client sees updates of a topic in seq order
+	var overflowed []*Client
+	for c := range h.Subs[topic] {
+		if !c.send(u) {
+			overflowed = append(overflowed, c)
+		}
+	}
+	h.Mu.Unlock()
+
+	for _, c := range overflowed {
+		h.drop(c, CloseOverflow)
+	}
+}
+
+// Shutdown closes all clients: WebSocket clients get their queued updates and then
+// a close frame, stream clients see Done and send what is still queued with Take.
+// It waits for WebSocket writers until ctx is done, then cuts the rest.
+// Returns number of closed clients.
+func (h *Hub) Shutdown(ctx context.Context) int {
+	h.Mu.Lock()
+	h.closed = true
+	clients := make(map[*Client]struct{})
+	for _, set := range h.Subs {
+		for c := range set {
+			clients[c] = struct{}{}
+		}
+	}
+	h.Subs = make(map[string]map[*Client]struct{})
+	h.Mu.Unlock()
+
+	for c := range clients {
+		c.goAway()
+	}
+	for c := range clients {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			c.close(CloseShutdown)
+		}
+	}
+	return len(clients)
 }
 
 func (h *Hub) ReapDead() {
 	for c := range h.DeadCh {
-		h.Mu.Lock()
-		for _, set := range h.Subs {
-			delete(set, c)
+		h.drop(c, ClosePeerGone)
+	}
+}
+
+// Unsubscribe removes client from all tokens and closes it
+func (h *Hub) Unsubscribe(c *Client) {
+	h.drop(c, CloseUnsubscribed)
+}
+
+// drop unsubscribes client from all tokens and closes it, safe to call many times,
+// reason of the first close is kept
+func (h *Hub) drop(c *Client, reason CloseReason) {
+	h.Mu.Lock()
+	for topic, set := range h.Subs {
+		delete(set, c)
+		if len(set) == 0 {
+			delete(h.Subs, topic)
 		}
-		h.Mu.Unlock()
-		_ = c.Close()
+	}
+	h.Mu.Unlock()
+	c.close(reason)
+}
+
+// markDead hands client over to the reaper without blocking the caller
+func (h *Hub) markDead(c *Client) {
+	select {
+	case h.DeadCh <- c:
+	default:
+		h.drop(c, ClosePeerGone)
 	}
 }
@@ -1,6 +1,8 @@
 package webSocket
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -8,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"Dexcelerate_swap_stats/internal/clock"
 	"Dexcelerate_swap_stats/internal/model"
 
 	"github.com/gorilla/websocket"
@@ -42,7 +45,7 @@ func TestHubBroadcastEmptySubscriptions(t *testing.T) {
 	}
 
 	// Broadcasting to empty subscriptions should not panic
-	hub.Broadcast("BTC", stats)
+	hub.Broadcast(context.Background(), "BTC", stats)
 }
 
 func TestHubBroadcastWithSubscriptions(t *testing.T) {
@@ -70,12 +73,7 @@ func TestHubBroadcastWithSubscriptions(t *testing.T) {
 	defer conn.Close()
 
 	// Add connection to hub
-	hub.Mu.Lock()
-	if hub.Subs["BTC"] == nil {
-		hub.Subs["BTC"] = make(map[*websocket.Conn]struct{})
-	}
-	hub.Subs["BTC"][conn] = struct{}{}
-	hub.Mu.Unlock()
+	hub.Subscribe(hub.NewClient(conn), "BTC", "", 0, model.Stats{Token: "BTC"})
 
 	stats := model.Stats{
 		Token:     "BTC",
@@ -83,7 +81,7 @@ func TestHubBroadcastWithSubscriptions(t *testing.T) {
 	}
 
 	// Broadcast should not panic
-	hub.Broadcast("BTC", stats)
+	hub.Broadcast(context.Background(), "BTC", stats)
 
 	// Allow some time for the broadcast
 	time.Sleep(50 * time.Millisecond)
@@ -110,9 +108,9 @@ func TestHubReapDead(t *testing.T) {
 	}
 
 	// Add connection to subscriptions
+	client := hub.NewClient(conn)
+	hub.Subscribe(client, "BTC", "", 0, model.Stats{Token: "BTC"})
 	hub.Mu.Lock()
-	hub.Subs["BTC"] = make(map[*websocket.Conn]struct{})
-	hub.Subs["BTC"][conn] = struct{}{}
 	initialCount := len(hub.Subs["BTC"])
 	hub.Mu.Unlock()
 
@@ -127,20 +125,15 @@ func TestHubReapDead(t *testing.T) {
 		defer wg.Done()
 		// Process only one dead connection
 		select {
-		case deadConn := <-hub.DeadCh:
-			hub.Mu.Lock()
-			for _, set := range hub.Subs {
-				delete(set, deadConn)
-			}
-			hub.Mu.Unlock()
-			deadConn.Close()
+		case deadClient := <-hub.DeadCh:
+			hub.drop(deadClient, ClosePeerGone)
 		case <-time.After(2 * time.Second):
 			t.Error("Timeout waiting for dead connection")
 		}
 	}()
 
 	// Mark connection as dead
-	hub.DeadCh <- conn
+	hub.DeadCh <- client
 
 	// Wait for reaper to process
 	wg.Wait()
@@ -188,15 +181,561 @@ func TestHubConcurrentAccess(t *testing.T) {
 			}
 
 			// Simulate adding subscription and broadcasting
-			hub.Mu.Lock()
-			if hub.Subs[token] == nil {
-				hub.Subs[token] = make(map[*websocket.Conn]struct{})
-			}
-			hub.Mu.Unlock()
+			hub.Subscribe(newClient(hub, nil), token, "", 0, model.Stats{Token: token})
 
-			hub.Broadcast(token, stats)
+			hub.Broadcast(context.Background(), token, stats)
 		}(i)
 	}
 
 	wg.Wait()
 }
+
+// newTestClient starts a server whose connections are subscribed to token
+// and returns the dialed client side.
+func newTestClient(t *testing.T, hub *Hub, token string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := hub.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Subscribe(hub.NewClient(conn), token, "", 0, model.Stats{Token: token})
+	}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to test server: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hub.Mu.Lock()
+		n := len(hub.Subs[token])
+		hub.Mu.Unlock()
+		if n > 0 {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for subscription")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// readEnvelope reads the next update and applies it to state
+func readEnvelope(t *testing.T, conn *websocket.Conn, state *model.Stats) model.Envelope {
+	t.Helper()
+	var env model.Envelope
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatalf("Failed to read envelope: %v", err)
+	}
+	switch env.Type {
+	case model.MessageSnapshot:
+		*state = *env.Stats
+	case model.MessageDelta:
+		*state = state.ApplyDelta(*env.Delta, env.UpdatedAt)
+	default:
+		t.Fatalf("Unexpected envelope type %q", env.Type)
+	}
+	return env
+}
+
+func TestClientOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    OverflowPolicy
+		tokens    []string
+		wantOK    bool
+		wantQueue []string
+	}{
+		{"coalesce same token", PolicyCoalesce, []string{"BTC", "ETH", "BTC"}, true, []string{"ETH", "BTC"}},
+		{"coalesce overflow", PolicyCoalesce, []string{"BTC", "ETH", "SOL"}, false, []string{"BTC", "ETH"}},
+		{"drop oldest", PolicyDropOldest, []string{"BTC", "ETH", "SOL"}, true, []string{"ETH", "SOL"}},
+		{"disconnect", PolicyDisconnect, []string{"BTC", "BTC", "BTC"}, false, []string{"BTC", "BTC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(WithQueueSize(2), WithOverflowPolicy(tt.policy))
+			c := newClient(hub, nil)
+
+			ok := true
+			for i, token := range tt.tokens {
+				ok = c.send(snapshotUpdate("", token, uint64(i+1), model.Stats{Token: token}))
+			}
+			if ok != tt.wantOK {
+				t.Errorf("Expected last Send to return %v, got %v", tt.wantOK, ok)
+			}
+
+			got := c.take()
+			if len(got) != len(tt.wantQueue) {
+				t.Fatalf("Expected %d queued messages, got %d", len(tt.wantQueue), len(got))
+			}
+			for i, m := range got {
+				if m.env.Token != tt.wantQueue[i] {
+					t.Errorf("Expected message %d for %s, got %s", i, tt.wantQueue[i], m.env.Token)
+				}
+			}
+		})
+	}
+}
+
+func TestClientCoalesceKeepsViews(t *testing.T) {
+	hub := NewHub(WithQueueSize(2))
+	c := newClient(hub, nil)
+
+	pending := model.Stats{Token: "BTC", View: model.ViewPending}
+	confirmed := model.Stats{Token: "BTC", View: model.ViewConfirmed}
+	c.send(snapshotUpdate("", "BTC", 1, pending))
+	c.send(snapshotUpdate("", "BTC", 1, confirmed))
+	// full queue, the pending update may only replace the pending one
+	if !c.send(snapshotUpdate("", "BTC", 2, pending)) {
+		t.Fatal("Expected the pending update to be coalesced")
+	}
+
+	got := c.take()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 queued messages, got %d", len(got))
+	}
+	if got[0].env.View != model.ViewConfirmed || got[0].env.Seq != 1 {
+		t.Errorf("Expected confirmed #1 kept, got %s #%d", got[0].env.View, got[0].env.Seq)
+	}
+	if got[1].env.View != model.ViewPending || got[1].env.Seq != 2 {
+		t.Errorf("Expected pending #2 last, got %s #%d", got[1].env.View, got[1].env.Seq)
+	}
+	if c.Dropped() != 1 {
+		t.Errorf("Expected 1 coalesced message, got %d", c.Dropped())
+	}
+}
+
+func TestHubCoalesceKeepsLatest(t *testing.T) {
+	hub := NewHub(WithQueueSize(4))
+	c := newClient(hub, nil)
+	s := newStream("", "BTC", 16)
+
+	for i := 0; i < 10; i++ {
+		c.send(s.next(model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: uint64(i)}}))
+	}
+
+	got := c.take()
+	if len(got) > 4 {
+		t.Fatalf("Expected queue to stay bounded, got %d", len(got))
+	}
+	if got[0].env.Type != model.MessageSnapshot {
+		t.Fatalf("Expected coalesced snapshot first, got %s", got[0].env.Type)
+	}
+	state := *got[0].env.Stats
+	for _, u := range got[1:] {
+		state = state.ApplyDelta(*u.env.Delta, u.env.UpdatedAt)
+	}
+	if state.BucketMinutes5.Count != 9 || got[len(got)-1].env.Seq != 10 {
+		t.Errorf("Expected latest state at seq 10, got count %d", state.BucketMinutes5.Count)
+	}
+	if c.Dropped() == 0 {
+		t.Error("Expected coalesced messages to be counted")
+	}
+}
+
+func TestHubDisconnectsSlowConsumer(t *testing.T) {
+	hub := NewHub(WithQueueSize(1), WithOverflowPolicy(PolicyDisconnect))
+
+	// client without writer never drains its queue
+	slow := newClient(hub, nil)
+	hub.Subscribe(slow, "BTC", "", 0, model.Stats{Token: "BTC"})
+
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC"})
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC"})
+
+	select {
+	case <-slow.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected slow client to be disconnected")
+	}
+	if r := slow.Reason(); r != CloseOverflow {
+		t.Errorf("Expected close reason overflow, got %d", r)
+	}
+
+	hub.Mu.Lock()
+	n := len(hub.Subs["BTC"])
+	hub.Mu.Unlock()
+	if n != 0 {
+		t.Errorf("Expected 0 subscriptions after eviction, got %d", n)
+	}
+}
+
+func TestHubSlowConsumerDoesNotBlockOthers(t *testing.T) {
+	hub := NewHub(WithQueueSize(1))
+	// client without writer never drains its queue
+	hub.Subscribe(newClient(hub, nil), "BTC", "", 0, model.Stats{Token: "BTC"})
+	conn := newTestClient(t, hub, "BTC")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: uint64(i)}})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Broadcast blocked on a slow consumer")
+	}
+
+	// coalescing guarantees the latest state is eventually delivered
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var state model.Stats
+	for {
+		readEnvelope(t, conn, &state)
+		if state.BucketMinutes5.Count == 99 {
+			return
+		}
+	}
+}
+
+func TestHubConcurrentBroadcastDelivery(t *testing.T) {
+	const (
+		writers  = 8
+		messages = 50
+	)
+	hub := NewHub(WithQueueSize(writers*messages), WithOverflowPolicy(PolicyDisconnect))
+	conn := newTestClient(t, hub, "BTC")
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", UpdatedAt: time.Now()})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// initial snapshot and then every update in seq order
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var state model.Stats
+	for i := 0; i <= writers*messages; i++ {
+		env := readEnvelope(t, conn, &state)
+		if env.Token != "BTC" {
+			t.Fatalf("Expected token BTC, got %s", env.Token)
+		}
+		if env.Seq != uint64(i) {
+			t.Fatalf("Expected seq %d, got %d", i, env.Seq)
+		}
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{PolicyCoalesce, PolicyDropOldest, PolicyDisconnect} {
+		got, err := ParseOverflowPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseOverflowPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("bogus"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestHubKeepaliveKeepsIdleClient(t *testing.T) {
+	hub := NewHub(WithKeepalive(20*time.Millisecond, 100*time.Millisecond))
+	go hub.ReapDead()
+	conn := newTestClient(t, hub, "BTC")
+
+	pings := make(chan struct{}, 16)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	// reading processes control frames, client never sends data messages
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pings:
+	case <-time.After(time.Second):
+		t.Fatal("Expected server to send ping")
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	hub.Mu.Lock()
+	n := len(hub.Subs["BTC"])
+	hub.Mu.Unlock()
+	if n != 1 {
+		t.Errorf("Expected idle client to stay subscribed, got %d subscriptions", n)
+	}
+}
+
+func TestHubKeepaliveFollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	hub := NewHub(WithClock(clk), WithKeepalive(30*time.Second, time.Hour))
+	go hub.ReapDead()
+	conn := newTestClient(t, hub, "BTC")
+
+	pings := make(chan struct{}, 16)
+	conn.SetPingHandler(func(string) error {
+		pings <- struct{}{}
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// writePump starts its ticker after the subscription is visible
+	deadline := time.Now().Add(2 * time.Second)
+	for clk.Tickers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for keepalive ticker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	clk.Advance(29 * time.Second)
+	select {
+	case <-pings:
+		t.Fatal("Expected no ping before the interval passes")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clk.Advance(time.Second)
+	select {
+	case <-pings:
+	case <-time.After(time.Second):
+		t.Fatal("Expected ping once the fake clock passes the interval")
+	}
+}
+
+func TestHubKeepaliveDropsDeadPeer(t *testing.T) {
+	hub := NewHub(WithKeepalive(20*time.Millisecond, 100*time.Millisecond))
+	go hub.ReapDead()
+	// client never reads, so it never answers pings
+	_ = newTestClient(t, hub, "BTC")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hub.Mu.Lock()
+		n := len(hub.Subs["BTC"])
+		hub.Mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected unresponsive client to be reaped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func statsWithCount(n uint64) model.Stats {
+	return model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: n, USD: float64(n)}}
+}
+
+func TestHubSubscribeResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		since     uint64
+		wantTypes []model.MessageType
+		wantSeqs  []uint64
+	}{
+		{"fresh client", 0, []model.MessageType{model.MessageSnapshot}, []uint64{5}},
+		{"replay buffered", 3, []model.MessageType{model.MessageDelta, model.MessageDelta}, []uint64{4, 5}},
+		{"up to date", 5, nil, nil},
+		{"evicted from buffer", 1, []model.MessageType{model.MessageSnapshot}, []uint64{5}},
+		{"unknown seq", 42, []model.MessageType{model.MessageSnapshot}, []uint64{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(WithReplaySize(3))
+			for i := uint64(1); i <= 5; i++ {
+				hub.Broadcast(context.Background(), "BTC", statsWithCount(i))
+			}
+
+			c := newClient(hub, nil)
+			hub.Subscribe(c, "BTC", hub.Options().Epoch, tt.since, model.Stats{Token: "BTC"})
+
+			got := c.take()
+			if len(got) != len(tt.wantSeqs) {
+				t.Fatalf("Expected %d updates, got %d", len(tt.wantSeqs), len(got))
+			}
+			for i, u := range got {
+				if u.env.Type != tt.wantTypes[i] || u.env.Seq != tt.wantSeqs[i] {
+					t.Errorf("Expected %s #%d, got %s #%d", tt.wantTypes[i], tt.wantSeqs[i], u.env.Type, u.env.Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestHubResumeAfterRestart(t *testing.T) {
+	before := NewHub(WithEpoch("before"))
+	for i := uint64(1); i <= 3; i++ {
+		before.Broadcast(context.Background(), "BTC", statsWithCount(i))
+	}
+
+	// the restarted hub numbers other states with the same seq
+	after := NewHub(WithEpoch("after"))
+	for i := uint64(1); i <= 5; i++ {
+		after.Broadcast(context.Background(), "BTC", statsWithCount(10*i))
+	}
+	c := newClient(after, nil)
+	after.Subscribe(c, "BTC", "before", 3, model.Stats{Token: "BTC"})
+
+	got := c.take()
+	if len(got) != 1 || got[0].env.Type != model.MessageSnapshot || got[0].env.Seq != 5 {
+		t.Fatalf("Expected snapshot #5 for a resume from another epoch, got %v", got)
+	}
+	if got[0].env.Epoch != "after" {
+		t.Errorf("Expected epoch after, got %q", got[0].env.Epoch)
+	}
+}
+
+func TestHubResumeRebuildsState(t *testing.T) {
+	hub := NewHub()
+	conn := newTestClient(t, hub, "BTC")
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var state model.Stats
+	readEnvelope(t, conn, &state) // initial snapshot
+	for i := uint64(1); i <= 3; i++ {
+		hub.Broadcast(context.Background(), "BTC", statsWithCount(i))
+	}
+	var last uint64
+	for last < 3 {
+		last = readEnvelope(t, conn, &state).Seq
+	}
+
+	// updates missed while disconnected are replayed on top of the known state
+	for i := uint64(4); i <= 6; i++ {
+		hub.Broadcast(context.Background(), "BTC", statsWithCount(i))
+	}
+	c := newClient(hub, nil)
+	hub.Subscribe(c, "BTC", hub.Options().Epoch, last, model.Stats{Token: "BTC"})
+	for _, u := range c.take() {
+		if u.env.Type != model.MessageDelta {
+			t.Fatalf("Expected delta, got %s", u.env.Type)
+		}
+		state = state.ApplyDelta(*u.env.Delta, u.env.UpdatedAt)
+	}
+
+	if state.BucketMinutes5 != statsWithCount(6).BucketMinutes5 {
+		t.Errorf("Expected rebuilt state %+v, got %+v", statsWithCount(6).BucketMinutes5, state.BucketMinutes5)
+	}
+}
+
+func TestHubViewsAreSeparateStreams(t *testing.T) {
+	hub := NewHub()
+	pending := hub.NewStreamClient()
+	confirmed := hub.NewStreamClient()
+	hub.Subscribe(pending, "BTC", "", 0, model.Stats{Token: "BTC", View: model.ViewPending})
+	hub.Subscribe(confirmed, "BTC", "", 0, model.Stats{Token: "BTC", View: model.ViewConfirmed})
+	pending.Take()
+	confirmed.Take()
+
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", View: model.ViewPending, BucketMinutes5: model.Bucket{Count: 2}})
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", View: model.ViewPending, BucketMinutes5: model.Bucket{Count: 3}})
+	hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", View: model.ViewConfirmed, BucketMinutes5: model.Bucket{Count: 1}})
+
+	got := pending.Take()
+	if len(got) != 2 || got[1].Seq != 2 || got[1].View != model.ViewPending {
+		t.Errorf("Expected 2 pending updates ending with seq 2, got %+v", got)
+	}
+	got = confirmed.Take()
+	if len(got) != 1 || got[0].Seq != 1 || got[0].View != model.ViewConfirmed {
+		t.Fatalf("Expected 1 confirmed update with seq 1, got %+v", got)
+	}
+	if got[0].Token != "BTC" || got[0].Stats.BucketMinutes5.Count != 1 {
+		t.Errorf("Expected confirmed BTC snapshot with count 1, got %+v", got[0])
+	}
+}
+
+func TestHubShutdownSendsCloseFrame(t *testing.T) {
+	hub := NewHub()
+	go hub.ReapDead()
+	conn := newTestClient(t, hub, "BTC")
+	stream := hub.NewStreamClient()
+	hub.Subscribe(stream, "ETH", "", 0, model.Stats{Token: "ETH"})
+
+	if n := hub.Shutdown(context.Background()); n != 2 {
+		t.Errorf("Expected 2 clients closed, got %d", n)
+	}
+
+	// the initial snapshot may come first, then the close frame
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected close going away, got %v", err)
+	}
+	select {
+	case <-stream.Done():
+	default:
+		t.Error("Expected stream client closed")
+	}
+	if r := stream.Reason(); r != CloseShutdown {
+		t.Errorf("Expected close reason shutdown, got %d", r)
+	}
+
+	late := hub.NewStreamClient()
+	hub.Subscribe(late, "BTC", "", 0, model.Stats{Token: "BTC"})
+	select {
+	case <-late.Done():
+	default:
+		t.Error("Expected client subscribing after shutdown closed")
+	}
+}
+
+func TestHubShutdownWritesQueuedUpdatesFirst(t *testing.T) {
+	hub := NewHub(WithQueueSize(128))
+	go hub.ReapDead()
+	conn := newTestClient(t, hub, "BTC")
+
+	const updates = 50
+	for i := uint64(1); i <= updates; i++ {
+		hub.Broadcast(context.Background(), "BTC", model.Stats{Token: "BTC", BucketMinutes5: model.Bucket{Count: i}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if n := hub.Shutdown(ctx); n != 1 {
+		t.Errorf("Expected 1 client closed, got %d", n)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var last uint64
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("Expected close going away after updates, got %v", err)
+			}
+			break
+		}
+		var env model.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatalf("Failed to decode update: %v", err)
+		}
+		last = env.Seq
+	}
+	if last != updates {
+		t.Errorf("Expected seq %d read before the close frame, got %d", updates, last)
+	}
+}
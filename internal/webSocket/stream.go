@@ -0,0 +1,115 @@
+package webSocket
+
+import (
+	"sort"
+
+	"Dexcelerate_swap_stats/internal/model"
+)
+
+const defaultReplaySize = 256
+
+// update is an envelope with the full state it leads to,
+// state lets the queue turn coalesced deltas into a snapshot
+type update struct {
+	env   model.Envelope
+	state model.Stats
+}
+
+func snapshotUpdate(epoch, token string, seq uint64, st model.Stats) update {
+	return update{
+		env: model.Envelope{
+			Type:      model.MessageSnapshot,
+			Token:     token,
+			View:      st.View,
+			Epoch:     epoch,
+			Seq:       seq,
+			Stats:     &st,
+			UpdatedAt: st.UpdatedAt,
+		},
+		state: st,
+	}
+}
+
+// stream numbers updates of one token view and keeps the latest of them for resume
+type stream struct {
+	epoch   string
+	token   string
+	seq     uint64
+	last    model.Stats
+	history []update // oldest first
+	size    int
+}
+
+func newStream(epoch, token string, size int) *stream {
+	return &stream{epoch: epoch, token: token, size: size}
+}
+
+// next assigns the following sequence number to st
+func (s *stream) next(st model.Stats) update {
+	u, _ := s.push(s.seq+1, st)
+	return u
+}
+
+// push records st under seq numbered elsewhere, stale seq is ignored.
+// An update right after the previous one is a delta, after a gap or
+// as the first update of a stream it is a snapshot.
+func (s *stream) push(seq uint64, st model.Stats) (update, bool) {
+	if seq <= s.seq {
+		return update{}, false
+	}
+	var u update
+	if s.seq == 0 || seq != s.seq+1 {
+		u = snapshotUpdate(s.epoch, s.token, seq, st)
+	} else {
+		d := model.Diff(s.last, st)
+		u = update{
+			env: model.Envelope{
+				Type:      model.MessageDelta,
+				Token:     s.token,
+				View:      st.View,
+				Epoch:     s.epoch,
+				Seq:       seq,
+				Delta:     &d,
+				UpdatedAt: st.UpdatedAt,
+			},
+			state: st,
+		}
+	}
+	s.seq = seq
+	s.last = st
+
+	if len(s.history) == s.size {
+		copy(s.history, s.history[1:])
+		s.history = s.history[:s.size-1]
+	}
+	s.history = append(s.history, u)
+	return u, true
+}
+
+// snapshot returns the current state at the current sequence number
+func (s *stream) snapshot() update {
+	return snapshotUpdate(s.epoch, s.token, s.seq, s.last)
+}
+
+// replay returns updates after since, ok is false if they are not buffered
+// anymore, since is unknown to this stream or there are more than max of them
+func (s *stream) replay(since uint64, max int) (out []update, ok bool) {
+	if since > s.seq {
+		return nil, false
+	}
+	i := sort.Search(len(s.history), func(i int) bool {
+		return s.history[i].env.Seq > since
+	})
+	out = s.history[i:]
+	if len(out) == 0 {
+		return nil, true
+	}
+	// history starts right after since or with a snapshot replacing missed updates
+	if out[0].env.Seq != since+1 && out[0].env.Type != model.MessageSnapshot {
+		return nil, false
+	}
+	if len(out) > max {
+		return nil, false
+	}
+	return out, true
+}